@@ -0,0 +1,168 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Systemd socket activation, see sd_listen_fds(3).
+const (
+	listenFdsStart   = 3
+	listenFdsUnknown = "unknown"
+)
+
+// activation holds the sockets passed by the service manager, consumed
+// from the environment on first use.
+var activation struct {
+	once    sync.Once
+	mu      sync.Mutex
+	sockets []*activatedSocket
+	// others are the descriptors passed that are not listening sockets,
+	// referenced so that their finalizer does not close them.
+	others []*os.File
+}
+
+type activatedSocket struct {
+	name string
+	l    net.Listener
+}
+
+// activatedSockets returns the listening sockets passed through
+// LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES, unsetting them so that child
+// processes do not inherit them. Other descriptors, such as datagram
+// sockets, are left open, and are not inherited either.
+func activatedSockets() []*activatedSocket {
+	activation.once.Do(func() {
+		defer func() {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+			os.Unsetenv("LISTEN_FDNAMES")
+		}()
+		if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+			return
+		}
+		n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || n <= 0 {
+			return
+		}
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < n; i++ {
+			name := listenFdsUnknown
+			if i < len(names) && names[i] != "" {
+				name = names[i]
+			}
+			fd := listenFdsStart + i
+			closeOnExec(fd)
+			f := os.NewFile(uintptr(fd), name)
+			l, err := net.FileListener(f)
+			if err != nil {
+				activation.others = append(activation.others, f)
+				continue
+			}
+			f.Close()
+			activation.sockets = append(activation.sockets, &activatedSocket{name: name, l: l})
+		}
+	})
+	return activation.sockets
+}
+
+// ListenersFromEnv returns the listeners passed by the service manager
+// through systemd socket activation, by name, with the options applied
+// as far as they can be once the sockets are bound: SO_REUSEPORT lets
+// Listen bind more sockets to their ports. The options failing are
+// ignored, except in strict mode. Each listener is only returned once by
+// ListenersFromEnv and ListenFdsWithReuse.
+func ListenersFromEnv(opts ...Option) (map[string][]net.Listener, error) {
+	cfg := newConfig(opts)
+	activation.mu.Lock()
+	defer activation.mu.Unlock()
+
+	res := make(map[string][]net.Listener)
+	for _, s := range activatedSockets() {
+		if s.l == nil {
+			continue
+		}
+		l, err := cfg.activated(s.l)
+		if err != nil {
+			return nil, err
+		}
+		s.l = nil
+		res[s.name] = append(res[s.name], l)
+	}
+	return res, nil
+}
+
+// ListenFdsWithReuse returns a listener for each of addresses, the
+// socket passed by the service manager bound to the address or with the
+// address as name if there is one, a new socket bound to the address by
+// Listen otherwise. The same address may be given several times to shard
+// it between activated and new sockets. see ListenersFromEnv
+func ListenFdsWithReuse(network string, addresses []string, opts ...Option) ([]net.Listener, error) {
+	cfg := newConfig(opts)
+	activation.mu.Lock()
+	defer activation.mu.Unlock()
+
+	var res []net.Listener
+	fail := func(err error) ([]net.Listener, error) {
+		for _, l := range res {
+			l.Close()
+		}
+		return nil, err
+	}
+	sockets := activatedSockets()
+	for _, address := range addresses {
+		var l net.Listener
+		for _, s := range sockets {
+			if s.l != nil && (s.name == address || activatedMatch(network, address, s.l.Addr())) {
+				var err error
+				if l, err = cfg.activated(s.l); err != nil {
+					return fail(err)
+				}
+				s.l = nil
+				break
+			}
+		}
+		if l == nil {
+			var err error
+			if l, err = cfg.listen(context.Background(), network, address); err != nil {
+				return fail(err)
+			}
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// activated applies the options of c to the activated listener l, which
+// is closed on error.
+func (c *config) activated(l net.Listener) (net.Listener, error) {
+	if err := c.adopt(l, l.Addr()); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return c.listener(l), nil
+}
+
+// activatedMatch reports whether addr, the address of an activated
+// socket, is the address to listen on in network.
+func activatedMatch(network, address string, addr net.Addr) bool {
+	if tcp(network) {
+		want, err := net.ResolveTCPAddr(network, address)
+		if err != nil {
+			return false
+		}
+		got, ok := addr.(*net.TCPAddr)
+		if !ok || got.Port != want.Port {
+			return false
+		}
+		if want.IP == nil || want.IP.IsUnspecified() {
+			return got.IP == nil || got.IP.IsUnspecified()
+		}
+		return want.IP.Equal(got.IP)
+	}
+	return addr.Network() == network && addr.String() == address
+}
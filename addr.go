@@ -1,7 +1,12 @@
 package reuse
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"runtime"
+	"strconv"
+	"strings"
 )
 
 var addrMapping = map[string]func(network, address string) (net.Addr, error){
@@ -19,12 +24,98 @@ var addrMapping = map[string]func(network, address string) (net.Addr, error){
 	"unixpacket": resolveUnixAddr,
 }
 
-func ResolveAddr(network, address string) (net.Addr, error) {
-	if v, b := addrMapping[network]; b {
-		return v(network, address)
+// ResolveAddr returns the address of the given network and address,
+// looking up host names with the resolver of the WithResolver option
+// if any. The IPv6 addresses may have a zone, the name or the index of an
+// interface, as in "[fe80::1%eth0]:8080", kept in the Zone field of the
+// address so that the sockets are bound or connected on that interface.
+// The IP networks may name their protocol, as in "ip6:ipv6-icmp". A host
+// naming a network interface, as in "eth0:443", resolves to its current
+// address, see WithInterface.
+func ResolveAddr(network, address string, opts ...Option) (net.Addr, error) {
+	return ResolveAddrContext(context.Background(), network, address, opts...)
+}
+
+// ResolveAddrContext is ResolveAddr using the provided context, whose
+// cancellation aborts the lookup of host names, done with the resolver
+// of the WithResolver option or net.DefaultResolver. The addresses are
+// cached by the cache of the WithAddrCache option if any.
+func ResolveAddrContext(ctx context.Context, network, address string, opts ...Option) (net.Addr, error) {
+	return newConfig(opts).resolveAddr(ctx, network, address)
+}
+
+func (c *config) resolveAddr(ctx context.Context, network, address string) (net.Addr, error) {
+	// The IP networks name their protocol after a colon, as in "ip4:1".
+	base := network
+	if i := strings.IndexByte(network, ':'); i >= 0 && ipRaw(network) {
+		base = network[:i]
+	}
+	v, b := addrMapping[base]
+	if !b {
+		return nil, net.UnknownNetworkError(network)
+	}
+	resolved, err := c.interfaceAddress(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAddrResolution, err)
+	}
+	if c.literalOnly && !unixSocket(base) {
+		if err := literalAddr(base, resolved); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrAddrResolution, err)
+		}
+	}
+	// The interface names follow the addresses of their interface.
+	cache := c.addrCache
+	if unixSocket(base) || resolved != address {
+		cache = nil
+	}
+	if cache != nil {
+		if addr, ok := cache.Get(network, address); ok {
+			return addr, nil
+		}
 	}
-	return nil, net.UnknownNetworkError(network)
 
+	var addr net.Addr
+	switch {
+	case unixSocket(base):
+		addr, err = v(network, resolved)
+	case c.resolver != nil:
+		addr, err = resolveWith(ctx, c.resolver, base, resolved)
+	case ctx.Done() != nil:
+		addr, err = resolveWith(ctx, net.DefaultResolver, base, resolved)
+	default:
+		// Without a context to honor, the net package resolves the
+		// address, checking the protocol of the IP networks.
+		addr, err = v(network, resolved)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAddrResolution, err)
+	}
+	if cache != nil {
+		cache.Put(network, address, addr)
+	}
+	return addr, nil
+}
+
+// literalAddr returns a NotLiteralError if the host of address, an
+// address of the IP, TCP or UDP network, is neither empty nor an IP
+// address.
+func literalAddr(network, address string) error {
+	host := address
+	if !ipRaw(network) {
+		h, _, err := net.SplitHostPort(address)
+		if err != nil {
+			// Left for the resolver to report.
+			return nil
+		}
+		host = h
+	}
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return nil
+	}
+	return &NotLiteralError{Addr: address, Host: host}
 }
 
 func resolveIPAddr(network, address string) (net.Addr, error) {
@@ -39,6 +130,91 @@ func resolveUDPAddr(network, address string) (net.Addr, error) {
 	return net.ResolveUDPAddr(network, address)
 }
 
+// zoneIndex returns the index of the interface of zone, the zone of an
+// IPv6 address naming the interface or giving its index, 0 if zone is
+// empty.
+func zoneIndex(zone string) (uint32, error) {
+	if zone == "" {
+		return 0, nil
+	}
+	if ifi, err := net.InterfaceByName(zone); err == nil {
+		return uint32(ifi.Index), nil
+	}
+	n, err := strconv.ParseUint(zone, 10, 32)
+	if err != nil {
+		return 0, &net.AddrError{Err: "unknown zone", Addr: zone}
+	}
+	return uint32(n), nil
+}
+
+// zoneName returns the zone of the interface of index, its name or, if it
+// cannot be found, its index, "" if index is 0.
+func zoneName(index uint32) string {
+	if index == 0 {
+		return ""
+	}
+	if ifi, err := net.InterfaceByIndex(int(index)); err == nil {
+		return ifi.Name
+	}
+	return strconv.FormatUint(uint64(index), 10)
+}
+
+// abstractUnix reports whether the platform has the abstract namespace of
+// unix sockets, whose names start with a NUL byte, written "@" by the net
+// package, and do not exist in the file system.
+const abstractUnix = runtime.GOOS == "linux" || runtime.GOOS == "android"
+
 func resolveUnixAddr(network, address string) (net.Addr, error) {
+	if strings.HasPrefix(address, "\x00") {
+		address = "@" + address[1:]
+	}
+	if strings.HasPrefix(address, "@") && !abstractUnix {
+		return nil, &net.AddrError{Err: "abstract unix socket not supported", Addr: address}
+	}
 	return net.ResolveUnixAddr(network, address)
 }
+
+// resolveWith resolves an IP, TCP or UDP address with r, preferring IPv4
+// addresses as the net package does.
+func resolveWith(ctx context.Context, r *net.Resolver, network, address string) (net.Addr, error) {
+	host, port := address, 0
+	if !strings.HasPrefix(network, "ip") {
+		h, service, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if port, err = r.LookupPort(ctx, network, service); err != nil {
+			return nil, err
+		}
+		host = h
+	}
+
+	var ip net.IPAddr
+	if host != "" {
+		ips, err := r.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		fam := network[len(network)-1]
+		for _, a := range ips {
+			v4 := a.IP.To4() != nil
+			if fam == '4' && !v4 || fam == '6' && v4 {
+				continue
+			}
+			if ip.IP == nil || v4 && ip.IP.To4() == nil {
+				ip = a
+			}
+		}
+		if ip.IP == nil {
+			return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+		}
+	}
+
+	switch {
+	case tcp(network):
+		return &net.TCPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}, nil
+	case udp(network):
+		return &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}, nil
+	}
+	return &ip, nil
+}
@@ -0,0 +1,82 @@
+package reuse
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// AddrCache caches the addresses resolved by ResolveAddrContext and the
+// local addresses of the Dial functions, see WithAddrCache. The cached
+// addresses are shared and must not be modified.
+type AddrCache interface {
+	// Get returns the address cached for network and address, if any.
+	Get(network, address string) (net.Addr, bool)
+	// Put caches addr as the address of network and address.
+	Put(network, address string, addr net.Addr)
+}
+
+// WithAddrCache makes the resolution of the addresses go through cache,
+// so that the host names are not looked up on each call. The unix socket
+// addresses and the interface names, resolved to the current addresses
+// of the interface, are not cached. see NewAddrCache
+func WithAddrCache(cache AddrCache) Option {
+	return func(c *config) {
+		c.addrCache = cache
+	}
+}
+
+// NewAddrCache returns an AddrCache keeping the addresses for ttl.
+func NewAddrCache(ttl time.Duration) AddrCache {
+	return &ttlAddrCache{ttl: ttl, entries: make(map[addrKey]addrEntry)}
+}
+
+type addrKey struct {
+	network, address string
+}
+
+type addrEntry struct {
+	addr    net.Addr
+	expires time.Time
+}
+
+// ttlAddrCache is the AddrCache of NewAddrCache.
+type ttlAddrCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[addrKey]addrEntry
+	// sweepAt is the number of entries beyond which the expired entries
+	// are removed on Put.
+	sweepAt int
+}
+
+func (c *ttlAddrCache) Get(network, address string) (net.Addr, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := addrKey{network, address}
+	e, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, k)
+		return nil, false
+	}
+	return e.addr, true
+}
+
+func (c *ttlAddrCache) Put(network, address string, addr net.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= c.sweepAt {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweepAt = 2*len(c.entries) + 64
+	}
+	c.entries[addrKey{network, address}] = addrEntry{addr: addr, expires: now.Add(c.ttl)}
+}
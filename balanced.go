@@ -0,0 +1,218 @@
+package reuse
+
+import (
+	"errors"
+	"math"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ListenBalanced binds n listeners with port reuse to address in network,
+// one per CPU if n is 0, and returns a listener accepting from all of
+// them, so that the kernel spreads the connections across n accept queues
+// within the process. The load is only spread on the platforms where
+// port reuse balances, see Capabilities.
+func ListenBalanced(network, address string, n int, opts ...Option) (net.Listener, error) {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	ls := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := Listen(network, address, opts...)
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, err
+		}
+		// Bind all the listeners to the port of the first one.
+		address = l.Addr().String()
+		ls = append(ls, l)
+	}
+	return newBalancedListener(ls, nil), nil
+}
+
+// ListenPinned binds a listener with port reuse and SO_INCOMING_CPU to
+// address in network for each CPU the process may run on, and returns a
+// listener accepting from all of them, the accept loop of each running on
+// a thread pinned to its CPU. The connections are thus accepted on the
+// CPU that received them, maximizing locality for servers handling many
+// packets per second. Linux only, the selection of the listeners by
+// SO_INCOMING_CPU requires Linux 6.2 or later. see WithIncomingCPU
+func ListenPinned(network, address string, opts ...Option) (net.Listener, error) {
+	cpus, err := allowedCPUs()
+	if err != nil {
+		return nil, err
+	}
+	ls := make([]net.Listener, 0, len(cpus))
+	for _, cpu := range cpus {
+		l, err := Listen(network, address, append(opts[:len(opts):len(opts)], WithIncomingCPU(cpu))...)
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, err
+		}
+		address = l.Addr().String()
+		ls = append(ls, l)
+	}
+	return newBalancedListener(ls, cpus), nil
+}
+
+// balancedListener fans in the connections accepted by several
+// listeners.
+type balancedListener struct {
+	ls        []net.Listener
+	counts    []atomic.Uint64
+	accepted  chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// newBalancedListener returns a listener accepting from ls, pinning the
+// accept loop of each to the CPU of the same index in cpus if set.
+func newBalancedListener(ls []net.Listener, cpus []int) *balancedListener {
+	b := &balancedListener{
+		ls:       ls,
+		counts:   make([]atomic.Uint64, len(ls)),
+		accepted: make(chan acceptResult),
+		done:     make(chan struct{}),
+	}
+	for i, l := range ls {
+		cpu := -1
+		if cpus != nil {
+			cpu = cpus[i]
+		}
+		b.wg.Add(1)
+		go b.acceptLoop(l, cpu, &b.counts[i])
+	}
+	return b
+}
+
+// acceptLoop accepts from l until it fails, handing the connections and
+// the final error over to Accept and counting the connections in count.
+// The loop runs on a thread pinned to cpu unless it is negative.
+func (b *balancedListener) acceptLoop(l net.Listener, cpu int, count *atomic.Uint64) {
+	defer b.wg.Done()
+	if cpu >= 0 {
+		// The thread exits with the goroutine rather than running
+		// other goroutines pinned.
+		runtime.LockOSThread()
+		pinThread(cpu)
+	}
+	for {
+		conn, err := l.Accept()
+		if err == nil {
+			count.Add(1)
+		}
+		select {
+		case b.accepted <- acceptResult{conn, err}:
+		case <-b.done:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+	}
+}
+
+// Accept returns the next connection accepted by any of the listeners.
+func (b *balancedListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-b.accepted:
+		return r.conn, r.err
+	case <-b.done:
+		return nil, &net.OpError{Op: "accept", Net: b.Addr().Network(), Addr: b.Addr(), Err: net.ErrClosed}
+	}
+}
+
+// Close closes all the listeners.
+func (b *balancedListener) Close() error {
+	var first error
+	b.closeOnce.Do(func() {
+		close(b.done)
+		for _, l := range b.ls {
+			if err := l.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+		b.wg.Wait()
+	})
+	return first
+}
+
+// Addr returns the address shared by the listeners.
+func (b *balancedListener) Addr() net.Addr {
+	return b.ls[0].Addr()
+}
+
+// AcceptStats describes how the connections accepted by a listener are
+// distributed across its sockets, to check that the kernel balances
+// them.
+type AcceptStats struct {
+	// Counts are the numbers of connections accepted by each socket.
+	Counts []uint64
+
+	// Total is the number of connections accepted.
+	Total uint64
+
+	// Mean and StdDev are the mean and standard deviation of Counts.
+	Mean   float64
+	StdDev float64
+
+	// CV is the coefficient of variation of Counts, StdDev over Mean,
+	// 0 when the connections are evenly spread. With random balancing
+	// it is about sqrt((n-1)/Total) for n sockets.
+	CV float64
+}
+
+// AcceptDistribution returns the distribution of the connections accepted
+// by l, a listener returned by ListenBalanced, across its sockets.
+func AcceptDistribution(l net.Listener) (AcceptStats, error) {
+	b, ok := l.(*balancedListener)
+	if !ok {
+		return AcceptStats{}, errors.New("reuse: listener not created by ListenBalanced")
+	}
+	counts := make([]uint64, len(b.counts))
+	for i := range b.counts {
+		counts[i] = b.counts[i].Load()
+	}
+	return NewAcceptStats(counts), nil
+}
+
+// NewAcceptStats returns the distribution of the per-socket accept counts
+// counts, gathered for instance from the workers of a Prefork.
+func NewAcceptStats(counts []uint64) AcceptStats {
+	s := AcceptStats{Counts: counts}
+	if len(counts) == 0 {
+		return s
+	}
+	for _, c := range counts {
+		s.Total += c
+	}
+	s.Mean = float64(s.Total) / float64(len(counts))
+	var sum float64
+	for _, c := range counts {
+		d := float64(c) - s.Mean
+		sum += d * d
+	}
+	s.StdDev = math.Sqrt(sum / float64(len(counts)))
+	if s.Mean > 0 {
+		s.CV = s.StdDev / s.Mean
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package reuse
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Message is a datagram read or written by a BatchConn, along with its
+// address and control message buffer. see ipv4.Message
+type Message = ipv4.Message
+
+// BatchConn wraps a packet conn, typically returned by ListenPacket, to
+// read and write several datagrams per system call. On Linux it uses
+// recvmmsg and sendmmsg, elsewhere it falls back to one datagram per
+// system call.
+type BatchConn struct {
+	net.PacketConn
+	v4 *ipv4.PacketConn
+	v6 *ipv6.PacketConn
+}
+
+// NewBatchConn returns a BatchConn wrapping c.
+func NewBatchConn(c net.PacketConn) *BatchConn {
+	bc := &BatchConn{PacketConn: c}
+	if ipv4Conn(c) {
+		bc.v4 = ipv4.NewPacketConn(c)
+	} else {
+		bc.v6 = ipv6.NewPacketConn(c)
+	}
+	return bc
+}
+
+// ReadBatch reads up to len(ms) datagrams into ms, returning the number
+// of messages read. flags are the MSG flags of recvmmsg.
+func (c *BatchConn) ReadBatch(ms []Message, flags int) (int, error) {
+	if c.v4 != nil {
+		return c.v4.ReadBatch(ms, flags)
+	}
+	return c.v6.ReadBatch(ms, flags)
+}
+
+// WriteBatch writes the datagrams of ms, returning the number of
+// messages written. flags are the MSG flags of sendmmsg.
+func (c *BatchConn) WriteBatch(ms []Message, flags int) (int, error) {
+	if c.v4 != nil {
+		return c.v4.WriteBatch(ms, flags)
+	}
+	return c.v6.WriteBatch(ms, flags)
+}
@@ -0,0 +1,16 @@
+package reuse
+
+import (
+	"syscall"
+)
+
+// AttachReusePortProg attaches the loaded eBPF program referred to by the
+// file descriptor prog to the SO_REUSEPORT group of an existing socket,
+// such as a listener returned by Listen or a connection returned by
+// ListenPacket. The program then selects the socket of the group
+// receiving each connection or datagram. Linux only.
+func AttachReusePortProg(c syscall.Conn, prog int) error {
+	return sockControl(c, func(fd uintptr) error {
+		return attachReusePortProg(fd, prog)
+	})
+}
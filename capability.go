@@ -0,0 +1,34 @@
+package reuse
+
+// Capabilities describes the port reuse behaviour the running kernel
+// provides for a network.
+type Capabilities struct {
+	// ReuseAddr reports whether SO_REUSEADDR can be set.
+	ReuseAddr bool
+	// ReusePort reports whether SO_REUSEPORT can be set.
+	ReusePort bool
+	// ReusePortLB reports whether the FreeBSD SO_REUSEPORT_LB option
+	// can be set, as strict mode does.
+	ReusePortLB bool
+	// LoadBalanced reports whether the kernel distributes connections and
+	// datagrams between the sockets sharing a port through this package.
+	LoadBalanced bool
+	// ExclusiveAddrUse reports whether the Windows SO_EXCLUSIVEADDRUSE
+	// option can be set, see WithExclusiveAddrUse.
+	ExclusiveAddrUse bool
+	// Hijackable reports whether a socket of another process or user may
+	// bind a port shared through this package and take over its traffic,
+	// as SO_REUSEADDR allows on Windows. Other platforms only share a
+	// port between the sockets of the same user.
+	Hijackable bool
+}
+
+// Probe creates a test socket for the network and reports which of the
+// port reuse options can be set on it. Unlike Enabled it reflects the
+// running kernel rather than the platform the package was compiled for.
+//
+// Known networks are "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6",
+// "unix", "unixgram" and "unixpacket".
+func Probe(network string) (Capabilities, error) {
+	return probe(network)
+}
@@ -0,0 +1,101 @@
+package reuse
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// PortCheck is the result of binding a port by CheckPort.
+type PortCheck struct {
+	// Network is the network bound, "tcp" or "udp".
+	Network string
+	// Addr is the address bound, empty for the wildcard address.
+	Addr string
+	// Reuse reports whether the port was bound with the options of the
+	// check, port reuse being enabled by default, rather than with the
+	// port reuse options disabled.
+	Reuse bool
+	// Err is the error binding the port failed with, wrapping
+	// ErrPortInUse if it is in use, nil if it could be bound.
+	Err error
+}
+
+// PortReport describes whether a port can be bound for TCP and UDP.
+type PortReport struct {
+	// Port is the port checked.
+	Port int
+	// Checks are the results of binding the port on each address, for
+	// TCP and UDP, with and without the port reuse options.
+	Checks []PortCheck
+}
+
+// Available reports whether the port could be bound for both TCP and UDP
+// on all the addresses, with the port reuse options if reuse is set, in
+// which case the port may already be shared by sockets of the same user.
+func (r PortReport) Available(reuse bool) bool {
+	for _, c := range r.Checks {
+		if c.Reuse == reuse && c.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckPort checks whether port can be bound on the wildcard address for
+// both TCP and UDP, for services needing matching ports. see
+// CheckPortAddrs
+func CheckPort(port int, opts ...Option) (PortReport, error) {
+	return CheckPortAddrs(port, nil, opts...)
+}
+
+// CheckPortAddrs checks whether port can be bound on each of addrs, IP
+// addresses or host names, or on the wildcard address if addrs is empty,
+// for both TCP and UDP. The port is bound with the options of opts, port
+// reuse being enabled by default, then with the port reuse options
+// disabled, telling a port free from one shared with other sockets.
+// The sockets are closed at once.
+func CheckPortAddrs(port int, addrs []string, opts ...Option) (PortReport, error) {
+	if port <= 0 || port > 65535 {
+		return PortReport{}, fmt.Errorf("reuse: invalid port %d", port)
+	}
+	if len(addrs) == 0 {
+		addrs = []string{""}
+	}
+	noReuse := append(opts[:len(opts):len(opts)], WithReuseAddr(false), WithReusePort(false))
+
+	ctx := context.Background()
+	r := PortReport{Port: port}
+	for _, addr := range addrs {
+		address := net.JoinHostPort(addr, strconv.Itoa(port))
+		for _, reuse := range []bool{true, false} {
+			o := opts
+			if !reuse {
+				o = noReuse
+			}
+			err := checkBind(ctx, "tcp", address, o)
+			r.Checks = append(r.Checks, PortCheck{Network: "tcp", Addr: addr, Reuse: reuse, Err: err})
+			err = checkBind(ctx, "udp", address, o)
+			r.Checks = append(r.Checks, PortCheck{Network: "udp", Addr: addr, Reuse: reuse, Err: err})
+		}
+	}
+	return r, nil
+}
+
+// checkBind binds address on network, a TCP or UDP network, with opts and
+// closes the socket.
+func checkBind(ctx context.Context, network, address string, opts []Option) error {
+	if tcp(network) {
+		l, err := ListenContext(ctx, network, address, opts...)
+		if err != nil {
+			return err
+		}
+		return l.Close()
+	}
+	pc, err := ListenPacketContext(ctx, network, address, opts...)
+	if err != nil {
+		return err
+	}
+	return pc.Close()
+}
@@ -0,0 +1,87 @@
+package reuse
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// checkBindConflict returns an error wrapping ErrBindConflict if address,
+// about to be bound on the TCP or UDP network, is a wildcard address
+// covering the specific address of a socket bound to the same port, or a
+// specific address covered by the wildcard address of such a socket. The
+// sockets of either kind then share the port, with or without port reuse
+// depending on the platform, the more specific one taking the traffic of
+// its address.
+func checkBindConflict(network, address string, rc syscall.RawConn) error {
+	if !tcp(network) && !udp(network) {
+		return nil
+	}
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil
+	}
+	port, err := strconv.Atoi(service)
+	if err != nil || port == 0 {
+		return nil
+	}
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	switch {
+	// The wildcard address of the networks without suffix has no host.
+	case host == "" && ipv6Network(network):
+		ip = net.IPv6unspecified
+	case host == "":
+		ip = net.IPv4zero
+	case ip == nil:
+		return nil
+	}
+
+	bound, err := boundAddrs(network, port)
+	if err != nil {
+		return err
+	}
+	wildcard := ip.IsUnspecified()
+	// The IPv6 sockets of the networks without suffix are passed with the
+	// suffix 6, the option tells them apart.
+	dual := ip.To4() == nil && !v6Only(rc)
+	var conflicts []string
+	seen := make(map[string]bool)
+	for _, b := range bound {
+		// The sockets of the same address share it by port reuse, the
+		// sockets of other specific addresses do not overlap.
+		if b.IsUnspecified() == wildcard {
+			continue
+		}
+		// The IPv6 wildcard address of the other sockets likely accepts
+		// IPv4 traffic too, as by default.
+		covers := wildcardCovers(b, ip, true)
+		if wildcard {
+			covers = wildcardCovers(ip, b, dual)
+		}
+		if a := net.JoinHostPort(b.String(), service); covers && !seen[a] {
+			seen[a] = true
+			conflicts = append(conflicts, a)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	if wildcard {
+		return fmt.Errorf("%w: %s covers %s, which keep their traffic", ErrBindConflict, address, strings.Join(conflicts, ", "))
+	}
+	return fmt.Errorf("%w: %s is covered by %s, which loses its traffic", ErrBindConflict, address, strings.Join(conflicts, ", "))
+}
+
+// wildcardCovers reports whether the wildcard address w accepts the
+// traffic of the specific address ip, IPv4 traffic included if dual.
+func wildcardCovers(w, ip net.IP, dual bool) bool {
+	if w.To4() != nil {
+		return ip.To4() != nil
+	}
+	return ip.To4() == nil || dual
+}
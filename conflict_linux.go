@@ -0,0 +1,90 @@
+package reuse
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpListen is the state of the listening sockets in /proc/net/tcp.
+const tcpListen = "0A"
+
+// boundAddrs returns the local addresses of the sockets of network bound
+// to port, the listening ones for TCP, read from /proc/net.
+func boundAddrs(network string, port int) ([]net.IP, error) {
+	proto := "udp"
+	if tcp(network) {
+		proto = "tcp"
+	}
+	var addrs []net.IP
+	var read bool
+	var firstErr error
+	for _, name := range []string{proto, proto + "6"} {
+		f, err := os.Open("/proc/net/" + name)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		read = true
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			// sl local_address rem_address st ..., the address in host
+			// byte order by 32-bit word and the port in hexadecimal.
+			fields := strings.Fields(s.Text())
+			if len(fields) < 4 || proto == "tcp" && fields[3] != tcpListen {
+				continue
+			}
+			ip, p, ok := parseProcAddr(fields[1])
+			if ok && p == port {
+				addrs = append(addrs, ip)
+			}
+		}
+		f.Close()
+	}
+	// The IPv6 table is missing if IPv6 is disabled.
+	if !read {
+		return nil, firstErr
+	}
+	return addrs, nil
+}
+
+// v6Only reports whether IPV6_V6ONLY is set on the socket of rc.
+func v6Only(rc syscall.RawConn) bool {
+	var v int
+	var err error
+	rc.Control(func(fd uintptr) {
+		v, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_V6ONLY)
+	})
+	return err == nil && v != 0
+}
+
+// parseProcAddr parses a local address of /proc/net/tcp or udp, or of
+// their IPv6 variants.
+func parseProcAddr(s string) (net.IP, int, bool) {
+	host, service, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, false
+	}
+	port, err := strconv.ParseUint(service, 16, 16)
+	if err != nil {
+		return nil, 0, false
+	}
+	b, err := hex.DecodeString(host)
+	if err != nil || len(b) != net.IPv4len && len(b) != net.IPv6len {
+		return nil, 0, false
+	}
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		binary.NativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(b[i:]))
+	}
+	return ip, int(port), true
+}
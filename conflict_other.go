@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+import (
+	"net"
+	"syscall"
+)
+
+func boundAddrs(network string, port int) ([]net.IP, error) {
+	return nil, unsupportedOption("bind conflict check")
+}
+
+func v6Only(rc syscall.RawConn) bool {
+	return false
+}
@@ -0,0 +1,72 @@
+package reuse
+
+import (
+	"net"
+)
+
+// listener applies the per-connection options of cfg to the accepted
+// connections, calls their accept hooks and reads their PROXY protocol
+// header if required.
+type listener struct {
+	net.Listener
+	cfg         *config
+	acceptHooks bool
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.acceptHooks && l.cfg.acceptHook(conn) != nil {
+			conn.Close()
+			continue
+		}
+		// A connection whose options cannot be set, such as one reset by
+		// its peer already, is dropped rather than failing the listener.
+		// conn closes it.
+		if conn, err = l.cfg.conn(conn); err != nil {
+			continue
+		}
+		if l.cfg.proxyProto {
+			conn = &proxyConn{Conn: conn}
+		}
+		return conn, nil
+	}
+}
+
+// listener returns l wrapped to apply the per-connection options of c,
+// or l itself if there are none.
+func (c *config) listener(l net.Listener) net.Listener {
+	if c.ioUring {
+		l = uringListen(l)
+	}
+	acceptHooks := len(c.hooksAt(HookAccept)) > 0
+	if c.noDelay == nil && !c.proxyProto && !acceptHooks {
+		return l
+	}
+	return &listener{Listener: l, cfg: c, acceptHooks: acceptHooks}
+}
+
+// conn applies the per-connection options of c, which the net package
+// would otherwise override once the connection is established. conn is
+// closed on error.
+func (c *config) conn(conn net.Conn) (net.Conn, error) {
+	if tc, ok := conn.(*net.TCPConn); ok && c.noDelay != nil {
+		if err := tc.SetNoDelay(*c.noDelay); err != nil {
+			tc.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// packetConn returns pc wrapped to apply the options of c, or pc itself if
+// there are none.
+func (c *config) packetConn(pc net.PacketConn) net.PacketConn {
+	if c.ioUring {
+		return uringPacketConnOf(pc)
+	}
+	return pc
+}
@@ -0,0 +1,88 @@
+package reuse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxConnectResponse bounds the size of the response of an HTTP proxy to
+// a CONNECT request.
+const maxConnectResponse = 64 << 10
+
+// DialViaConnectProxy connects to raddr through a tunnel opened with an
+// HTTP CONNECT request to the proxy at proxyAddr, binding the socket
+// facing the proxy to laddr with port reuse, so that the tunneled
+// connections keep a stable source port. see DialViaConnectProxyContext
+func DialViaConnectProxy(network, laddr, proxyAddr, raddr string, opts ...Option) (net.Conn, error) {
+	return DialViaConnectProxyContext(context.Background(), network, laddr, proxyAddr, raddr, opts...)
+}
+
+// DialViaConnectProxyContext connects to raddr through an HTTP CONNECT
+// proxy using the provided context, which also bounds the handshake.
+// network is the TCP network of the connection to the proxy, raddr being
+// resolved by the proxy.
+func DialViaConnectProxyContext(ctx context.Context, network, laddr, proxyAddr, raddr string, opts ...Option) (net.Conn, error) {
+	if !tcp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	nla, err := ResolveAddrContext(ctx, network, laddr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("resolving local addr: %w", err)
+	}
+	d := &Dialer{LocalAddr: nla, Options: opts}
+	conn, err := d.DialContext(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unblock the handshake when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	err = connectTunnel(conn, raddr)
+	if !stop() {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "proxyconnect", Net: network, Source: conn.LocalAddr(), Addr: conn.RemoteAddr(), Err: err}
+	}
+	return conn, nil
+}
+
+// connectTunnel sends a CONNECT request for raddr on conn and reads the
+// response of the proxy without reading past it, the tunneled bytes
+// being left on conn.
+func connectTunnel(conn net.Conn, raddr string) error {
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", raddr, raddr)
+	if _, err := io.WriteString(conn, req); err != nil {
+		return err
+	}
+
+	var head []byte
+	c := make([]byte, 1)
+	for !bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+		if len(head) >= maxConnectResponse {
+			return fmt.Errorf("reuse: proxy response header exceeds %d bytes", maxConnectResponse)
+		}
+		if _, err := io.ReadFull(conn, c); err != nil {
+			return err
+		}
+		head = append(head, c[0])
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(head)), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("reuse: proxy refused CONNECT to %s: %s", raddr, resp.Status)
+	}
+	return nil
+}
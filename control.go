@@ -0,0 +1,98 @@
+package reuse
+
+import (
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Control sets SO_REUSEADDR and SO_REUSEPORT (or the platform equivalent)
+// on the socket. It can be used as the Control function of a
+// net.ListenConfig or net.Dialer.
+func Control(network, address string, c syscall.RawConn) error {
+	return newConfig(nil).control(network, address, c)
+}
+
+// ComposeControl returns a Control function calling each of fns in order,
+// stopping at the first error. Nil functions are skipped, so the result
+// can be used to layer user socket options on top of Control:
+//
+//	lc := net.ListenConfig{Control: reuse.ComposeControl(reuse.Control, setTOS)}
+func ComposeControl(fns ...func(network, address string, c syscall.RawConn) error) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		for _, fn := range fns {
+			if fn == nil {
+				continue
+			}
+			if err := fn(network, address, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ipv6Network reports whether network, as passed to a Control function with the
+// address family suffix resolved, refers to an IPv6 socket.
+func ipv6Network(network string) bool {
+	if i := strings.IndexByte(network, ':'); i >= 0 {
+		network = network[:i]
+	}
+	return strings.HasSuffix(network, "6")
+}
+
+// tcp reports whether network refers to a TCP socket.
+func tcp(network string) bool {
+	return strings.HasPrefix(network, "tcp")
+}
+
+// sockControl calls fn with the file descriptor of the socket underlying c.
+func sockControl(c syscall.Conn, fn func(fd uintptr) error) error {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = fn(fd)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// fakeNet reports whether the net package only provides the in-process
+// network of the WebAssembly platforms, whose sockets have no options and
+// whose dials fail with a Control function.
+const fakeNet = runtime.GOOS == "js" || runtime.GOOS == "wasip1"
+
+func boolint(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// roundDuration returns d in units of unit, rounded up.
+func roundDuration(d, unit time.Duration) int64 {
+	if unit <= 0 {
+		return int64(d)
+	}
+	return int64((d + unit - 1) / unit)
+}
+
+// ipRaw reports whether network refers to a raw IP socket.
+func ipRaw(network string) bool {
+	return strings.HasPrefix(network, "ip")
+}
+
+// unixSocket reports whether network refers to a unix domain socket.
+func unixSocket(network string) bool {
+	return strings.HasPrefix(network, "unix")
+}
+
+// udp reports whether network refers to a UDP socket.
+func udp(network string) bool {
+	return strings.HasPrefix(network, "udp")
+}
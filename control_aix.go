@@ -0,0 +1,34 @@
+package reuse
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	soRcvBufForce = -1
+	soSndBufForce = -1
+)
+
+const (
+	tcpKeepIdle  = unix.TCP_KEEPIDLE
+	tcpKeepIntvl = unix.TCP_KEEPINTVL
+	tcpKeepCnt   = unix.TCP_KEEPCNT
+)
+
+const keepAliveUnit = time.Second
+
+// reusePortBalanced is false as AIX delivers to a single one of the
+// sockets sharing a port rather than distributing between them.
+const reusePortBalanced = false
+
+const soReusePortLB = -1
+
+// AIX lacks IP_RECVTOS. IP_DONTFRAG also applies to the IPv4-mapped
+// traffic of IPv6 sockets.
+const (
+	ipRecvTOS      = -1
+	ipDontFrag     = unix.IP_DONTFRAG
+	dontFragMapped = true
+)
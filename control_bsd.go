@@ -0,0 +1,62 @@
+//go:build aix || dragonfly || freebsd || netbsd || openbsd
+// +build aix dragonfly freebsd netbsd openbsd
+
+package reuse
+
+import "golang.org/x/sys/unix"
+
+// probeReusePortLB reports whether SO_REUSEPORT_LB can be set on fd, on
+// the systems having it.
+func probeReusePortLB(fd int) bool {
+	if soReusePortLB < 0 {
+		return false
+	}
+	return unix.SetsockoptInt(fd, unix.SOL_SOCKET, soReusePortLB, 1) == nil
+}
+
+// setDontFrag sets IPV6_DONTFRAG on IPv6 sockets, and IP_DONTFRAG for
+// their IPv4-mapped traffic on a best effort basis where dontFragMapped is
+// set, or IP_DONTFRAG on IPv4 sockets where the system has it.
+func setDontFrag(network string, fd int, enable bool) error {
+	if !ipv6Network(network) {
+		if ipDontFrag < 0 {
+			return unsupportedOption("IP_DONTFRAG")
+		}
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, ipDontFrag, boolint(enable))
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_DONTFRAG, boolint(enable)); err != nil {
+		return err
+	}
+	if dontFragMapped {
+		unix.SetsockoptInt(fd, unix.IPPROTO_IP, ipDontFrag, boolint(enable))
+	}
+	return nil
+}
+
+func (c *config) setsockoptOS(network string, fd int) error {
+	if opt := c.linuxOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+	if opt := c.darwinOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+	if opt := c.windowsOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+	if c.notSentLowat > 0 {
+		return unsupportedOption("TCP_NOTSENT_LOWAT")
+	}
+	return nil
+}
+
+func attachReusePortProg(fd uintptr, prog int) error {
+	return unsupportedOption("SO_ATTACH_REUSEPORT_EBPF")
+}
+
+func setQuickAck(fd uintptr, enable bool) error {
+	return unsupportedOption("TCP_QUICKACK")
+}
+
+func availableCongestionControls() ([]string, error) {
+	return nil, unsupportedOption("TCP_CONGESTION")
+}
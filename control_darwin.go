@@ -0,0 +1,90 @@
+package reuse
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	soRcvBufForce = -1
+	soSndBufForce = -1
+)
+
+const (
+	tcpKeepIdle  = unix.TCP_KEEPALIVE
+	tcpKeepIntvl = unix.TCP_KEEPINTVL
+	tcpKeepCnt   = unix.TCP_KEEPCNT
+)
+
+const keepAliveUnit = time.Second
+
+// reusePortBalanced is false as Darwin delivers to the most recently
+// bound of the sockets sharing a port.
+const reusePortBalanced = false
+
+const soReusePortLB = -1
+
+func probeReusePortLB(fd int) bool {
+	return false
+}
+
+const ipRecvTOS = unix.IP_RECVTOS
+
+// setDontFrag sets IPV6_DONTFRAG on IPv6 sockets, and IP_DONTFRAG for
+// their IPv4-mapped traffic on a best effort basis, or IP_DONTFRAG on
+// IPv4 sockets.
+func setDontFrag(network string, fd int, enable bool) error {
+	if !ipv6Network(network) {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_DONTFRAG, boolint(enable))
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_DONTFRAG, boolint(enable)); err != nil {
+		return err
+	}
+	unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_DONTFRAG, boolint(enable))
+	return nil
+}
+
+func (c *config) setsockoptOS(network string, fd int) error {
+	if opt := c.linuxOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+	if opt := c.windowsOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+
+	if c.boundIf != "" {
+		ifi, err := net.InterfaceByName(c.boundIf)
+		if err != nil {
+			return err
+		}
+		if ipv6Network(network) {
+			err = unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, ifi.Index)
+		} else {
+			err = unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_BOUND_IF, ifi.Index)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.notSentLowat > 0 && tcp(network) {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_NOTSENT_LOWAT, c.notSentLowat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func attachReusePortProg(fd uintptr, prog int) error {
+	return unsupportedOption("SO_ATTACH_REUSEPORT_EBPF")
+}
+
+func setQuickAck(fd uintptr, enable bool) error {
+	return unsupportedOption("TCP_QUICKACK")
+}
+
+func availableCongestionControls() ([]string, error) {
+	return nil, unsupportedOption("TCP_CONGESTION")
+}
@@ -0,0 +1,35 @@
+package reuse
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	soRcvBufForce = -1
+	soSndBufForce = -1
+)
+
+const (
+	tcpKeepIdle  = unix.TCP_KEEPIDLE
+	tcpKeepIntvl = unix.TCP_KEEPINTVL
+	tcpKeepCnt   = unix.TCP_KEEPCNT
+)
+
+// keepAliveUnit is the unit of the TCP keepalive times, which DragonFly
+// expresses in milliseconds.
+const keepAliveUnit = time.Millisecond
+
+// reusePortBalanced is true as DragonFly distributes the connections and
+// datagrams between the sockets sharing a port through SO_REUSEPORT.
+const reusePortBalanced = true
+
+const soReusePortLB = -1
+
+// DragonFly lacks IP_RECVTOS and IP_DONTFRAG.
+const (
+	ipRecvTOS      = -1
+	ipDontFrag     = -1
+	dontFragMapped = false
+)
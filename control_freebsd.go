@@ -0,0 +1,35 @@
+package reuse
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	soRcvBufForce = -1
+	soSndBufForce = -1
+)
+
+const (
+	tcpKeepIdle  = unix.TCP_KEEPIDLE
+	tcpKeepIntvl = unix.TCP_KEEPINTVL
+	tcpKeepCnt   = unix.TCP_KEEPCNT
+)
+
+const keepAliveUnit = time.Second
+
+// reusePortBalanced is false as FreeBSD delivers to the most recently
+// bound of the sockets sharing a port through SO_REUSEPORT. FreeBSD 12
+// and later balance between the sockets sharing a port through
+// SO_REUSEPORT_LB instead, which strict mode sets.
+const reusePortBalanced = false
+
+const soReusePortLB = unix.SO_REUSEPORT_LB
+
+const ipRecvTOS = unix.IP_RECVTOS
+
+const (
+	ipDontFrag     = unix.IP_DONTFRAG
+	dontFragMapped = false
+)
@@ -0,0 +1,233 @@
+package reuse
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	soRcvBufForce = unix.SO_RCVBUFFORCE
+	soSndBufForce = unix.SO_SNDBUFFORCE
+)
+
+const (
+	tcpKeepIdle  = unix.TCP_KEEPIDLE
+	tcpKeepIntvl = unix.TCP_KEEPINTVL
+	tcpKeepCnt   = unix.TCP_KEEPCNT
+)
+
+const keepAliveUnit = time.Second
+
+// reusePortBalanced reports whether sockets sharing a port through
+// SO_REUSEPORT get incoming connections and datagrams distributed
+// between them by the kernel.
+const reusePortBalanced = true
+
+const soReusePortLB = -1
+
+func probeReusePortLB(fd int) bool {
+	return false
+}
+
+const (
+	skfAdOff = -0x1000
+	skfAdCPU = 36
+)
+
+func (c *config) setsockoptOS(network string, fd int) error {
+	if opt := c.darwinOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+	if opt := c.windowsOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+
+	if c.cpuSteering {
+		if err := attachCPUSteering(fd); err != nil {
+			return err
+		}
+	}
+
+	if c.bindDevice != "" {
+		if err := unix.BindToDevice(fd, c.bindDevice); err != nil {
+			return err
+		}
+	}
+
+	if c.freebind {
+		if err := setIPOption(network, fd, unix.IP_FREEBIND, unix.IPV6_FREEBIND, 1); err != nil {
+			return err
+		}
+	}
+
+	if c.bindNoPort && tcp(network) {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_BIND_ADDRESS_NO_PORT, 1); err != nil {
+			return err
+		}
+	}
+
+	if c.transparent {
+		if err := setIPOption(network, fd, unix.IP_TRANSPARENT, unix.IPV6_TRANSPARENT, 1); err != nil {
+			return err
+		}
+	}
+
+	if c.origDst {
+		if err := setIPOption(network, fd, unix.IP_RECVORIGDSTADDR, unix.IPV6_RECVORIGDSTADDR, 1); err != nil {
+			return err
+		}
+	}
+
+	if c.deferAccept > 0 && tcp(network) {
+		secs := int(roundDuration(c.deferAccept, time.Second))
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_DEFER_ACCEPT, secs); err != nil {
+			return err
+		}
+	}
+
+	if c.quickAck && tcp(network) {
+		if err := setQuickAck(uintptr(fd), true); err != nil {
+			return err
+		}
+	}
+
+	if c.congestion != "" && tcp(network) {
+		err := unix.SetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION, c.congestion)
+		if err == unix.ENOENT {
+			return fmt.Errorf("%w: %s", ErrCongestionUnavailable, c.congestion)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.mark != 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_MARK, int(c.mark)); err != nil {
+			return err
+		}
+	}
+
+	if c.udpSegment > 0 && udp(network) {
+		if err := unix.SetsockoptInt(fd, unix.SOL_UDP, unix.UDP_SEGMENT, c.udpSegment); err != nil {
+			return err
+		}
+	}
+
+	if c.udpGRO && udp(network) {
+		if err := unix.SetsockoptInt(fd, unix.SOL_UDP, unix.UDP_GRO, 1); err != nil {
+			return err
+		}
+	}
+
+	if c.txTime != nil {
+		if err := setTxTime(fd, c.txTime); err != nil {
+			return err
+		}
+	}
+
+	if c.ebpfProg >= 0 {
+		if err := attachReusePortProg(uintptr(fd), c.ebpfProg); err != nil {
+			return err
+		}
+	}
+
+	if c.incomingCPU >= 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_INCOMING_CPU, c.incomingCPU); err != nil {
+			return err
+		}
+	}
+
+	if c.ioUring && c.strict {
+		if _, err := getURing(); err != nil {
+			return fmt.Errorf("%w: io_uring: %v", ErrOptionUnsupported, err)
+		}
+	}
+
+	if c.notSentLowat > 0 && tcp(network) {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_NOTSENT_LOWAT, c.notSentLowat); err != nil {
+			return err
+		}
+	}
+
+	if c.icmpEchoID != nil && ipRaw(network) {
+		if err := attachICMPEchoFilter(fd, *c.icmpEchoID); err != nil {
+			return err
+		}
+	}
+
+	if c.vsockBufSize > 0 && network == "vsock" {
+		if err := unix.SetsockoptUint64(fd, unix.AF_VSOCK, unix.SO_VM_SOCKETS_BUFFER_SIZE, c.vsockBufSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachCPUSteering attaches a program returning the current CPU as the
+// index of the socket in the SO_REUSEPORT group.
+func attachCPUSteering(fd int) error {
+	cpu := int32(skfAdOff + skfAdCPU)
+	filter := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: uint32(cpu)},
+		{Code: unix.BPF_RET | unix.BPF_A},
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	return unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_REUSEPORT_CBPF, &prog)
+}
+
+func attachReusePortProg(fd uintptr, prog int) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ATTACH_REUSEPORT_EBPF, prog)
+}
+
+const ipRecvTOS = unix.IP_RECVTOS
+
+// setDontFrag sets the path MTU discovery mode of IPv6 sockets, and of
+// their IPv4-mapped traffic on a best effort basis, or of IPv4 sockets,
+// to probing, which sets the don't fragment bit regardless of the path
+// MTU cached by the kernel.
+func setDontFrag(network string, fd int, enable bool) error {
+	v4, v6 := unix.IP_PMTUDISC_DONT, unix.IPV6_PMTUDISC_DONT
+	if enable {
+		v4, v6 = unix.IP_PMTUDISC_PROBE, unix.IPV6_PMTUDISC_PROBE
+	}
+	if !ipv6Network(network) {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, v4)
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, v6); err != nil {
+		return err
+	}
+	unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, v4)
+	return nil
+}
+
+// setIPOption sets the IPPROTO_IP option v4 or, on IPv6 sockets, the
+// IPPROTO_IPV6 option v6. Kernels predating the IPv6 variant fall back to
+// the IPv4 option, which also applies to IPv6 sockets.
+func setIPOption(network string, fd, v4, v6, value int) error {
+	if ipv6Network(network) {
+		err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, v6, value)
+		if err != unix.ENOPROTOOPT {
+			return err
+		}
+	}
+	return unix.SetsockoptInt(fd, unix.IPPROTO_IP, v4, value)
+}
+
+func setQuickAck(fd uintptr, enable bool) error {
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_QUICKACK, boolint(enable))
+}
+
+func availableCongestionControls() ([]string, error) {
+	b, err := os.ReadFile("/proc/sys/net/ipv4/tcp_available_congestion_control")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
@@ -0,0 +1,33 @@
+package reuse
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	soRcvBufForce = -1
+	soSndBufForce = -1
+)
+
+const (
+	tcpKeepIdle  = unix.TCP_KEEPIDLE
+	tcpKeepIntvl = unix.TCP_KEEPINTVL
+	tcpKeepCnt   = unix.TCP_KEEPCNT
+)
+
+const keepAliveUnit = time.Second
+
+// reusePortBalanced is false as NetBSD delivers to the most recently
+// bound of the sockets sharing a port.
+const reusePortBalanced = false
+
+const soReusePortLB = -1
+
+// NetBSD lacks IP_RECVTOS and IP_DONTFRAG.
+const (
+	ipRecvTOS      = -1
+	ipDontFrag     = -1
+	dontFragMapped = false
+)
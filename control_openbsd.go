@@ -0,0 +1,28 @@
+package reuse
+
+const (
+	soRcvBufForce = -1
+	soSndBufForce = -1
+)
+
+// OpenBSD only has system wide TCP keepalive times.
+const (
+	tcpKeepIdle  = -1
+	tcpKeepIntvl = -1
+	tcpKeepCnt   = -1
+)
+
+const keepAliveUnit = 0
+
+// reusePortBalanced is false as OpenBSD delivers to the most recently
+// bound of the sockets sharing a port.
+const reusePortBalanced = false
+
+const soReusePortLB = -1
+
+// OpenBSD lacks IP_RECVTOS and IP_DONTFRAG.
+const (
+	ipRecvTOS      = -1
+	ipDontFrag     = -1
+	dontFragMapped = false
+)
@@ -1,11 +1,34 @@
-// +build !windows,!linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+//go:build !aix && !windows && !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !aix,!windows,!linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
 
 package reuse
 
-import (
-	"syscall"
-)
+const reusePortBalanced = false
 
-func Control(network, address string, c syscall.RawConn) error {
+const soReusePortLB = -1
+
+func (c *config) setsockopt(network string, fd uintptr) error {
 	return nil
 }
+
+func probe(network string) (Capabilities, error) {
+	return Capabilities{}, nil
+}
+
+func attachReusePortProg(fd uintptr, prog int) error {
+	return unsupportedOption("SO_ATTACH_REUSEPORT_EBPF")
+}
+
+func setQuickAck(fd uintptr, enable bool) error {
+	return unsupportedOption("TCP_QUICKACK")
+}
+
+func availableCongestionControls() ([]string, error) {
+	return nil, unsupportedOption("TCP_CONGESTION")
+}
+
+func familySuffix(fd uintptr) (string, error) {
+	return "", nil
+}
+
+func closeOnExec(fd int) {}
@@ -1,26 +1,254 @@
-// +build linux darwin dragonfly freebsd netbsd openbsd
+//go:build aix || linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build aix linux darwin dragonfly freebsd netbsd openbsd
 
 package reuse
 
 import (
-	"syscall"
+	"net"
 
 	"golang.org/x/sys/unix"
 )
 
-func Control(network, address string, c syscall.RawConn) (err error) {
-	if err := c.Control(func(fd uintptr) {
-		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
-		if err != nil {
-			return
+func (c *config) setsockopt(network string, fd uintptr) error {
+	if c.reuseAddr {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+			return err
 		}
+	}
 
-		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	if c.reusePort && c.strict && !reusePortBalanced && soReusePortLB >= 0 {
+		// SO_REUSEPORT_LB balances where SO_REUSEPORT does not.
+		if unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, soReusePortLB, 1) != nil {
+			return ErrReuseUnsupported
+		}
+	} else if c.reusePort {
+		err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		if err == unix.ENOPROTOOPT && c.strict {
+			return ErrReuseUnsupported
+		}
+		// Recent Linux kernels only allow SO_REUSEPORT on IP sockets. The
+		// unix sockets, whose names are not shared, do without.
+		if err == unix.EOPNOTSUPP && unixSocket(network) && !c.strict {
+			err = nil
+		}
 		if err != nil {
-			return
+			return err
+		}
+	}
+
+	if c.rcvBuf > 0 {
+		if err := c.setBuf(int(fd), unix.SO_RCVBUF, soRcvBufForce, c.rcvBuf); err != nil {
+			return err
+		}
+	}
+
+	if c.sndBuf > 0 {
+		if err := c.setBuf(int(fd), unix.SO_SNDBUF, soSndBufForce, c.sndBuf); err != nil {
+			return err
+		}
+	}
+
+	if c.keepAlive != nil && tcp(network) {
+		if err := setKeepAlive(int(fd), c.keepAlive); err != nil {
+			return err
+		}
+	}
+
+	if c.maxSeg > 0 && tcp(network) {
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_MAXSEG, c.maxSeg); err != nil {
+			return err
+		}
+	}
+
+	if c.linger != nil {
+		l := unix.Linger{}
+		if *c.linger >= 0 {
+			l.Onoff = 1
+			l.Linger = int32(*c.linger)
+		}
+		if err := unix.SetsockoptLinger(int(fd), unix.SOL_SOCKET, unix.SO_LINGER, &l); err != nil {
+			return err
+		}
+	}
+
+	if c.tos != nil {
+		if err := setTOS(network, int(fd), *c.tos); err != nil {
+			return err
+		}
+	}
+
+	if c.ttl > 0 {
+		if err := setTTL(network, int(fd), c.ttl); err != nil {
+			return err
+		}
+	}
+
+	if c.broadcast != nil && udp(network) {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, boolint(*c.broadcast)); err != nil {
+			return err
+		}
+	}
+
+	if c.dontFrag != nil && udp(network) {
+		if err := setDontFrag(network, int(fd), *c.dontFrag); err != nil && !c.bestEffortDF {
+			return err
+		}
+	}
+
+	if c.recvECN && udp(network) {
+		if err := setRecvECN(network, int(fd)); err != nil && !c.bestEffortECN {
+			return err
+		}
+	}
+
+	if c.hdrIncl && ipRaw(network) && !ipv6Network(network) {
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_HDRINCL, 1); err != nil {
+			return err
+		}
+	}
+
+	return c.setsockoptOS(network, int(fd))
+}
+
+// setBuf sets the buffer size option opt, or with forceBuf the option
+// force exceeding the system limits, falling back to opt when the process
+// lacks the privileges or the platform the option.
+func (c *config) setBuf(fd, opt, force, size int) error {
+	if c.forceBuf && force >= 0 {
+		err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, force, size)
+		if err != unix.EPERM {
+			return err
 		}
-	}); err != nil {
+	}
+	return unix.SetsockoptInt(fd, unix.SOL_SOCKET, opt, size)
+}
+
+// setTOS sets the traffic class of IPv6 sockets, and their IPv4-mapped
+// traffic on a best effort basis, or the type of service of IPv4 sockets.
+func setTOS(network string, fd, tos int) error {
+	if !ipv6Network(network) {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, tos)
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos); err != nil {
 		return err
 	}
-	return err
+	unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, tos)
+	return nil
+}
+
+// setTTL sets the hop limit of IPv6 sockets, and their IPv4-mapped
+// traffic on a best effort basis, or the time to live of IPv4 sockets.
+func setTTL(network string, fd, ttl int) error {
+	if !ipv6Network(network) {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TTL, ttl)
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS, ttl); err != nil {
+		return err
+	}
+	unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TTL, ttl)
+	return nil
+}
+
+// setRecvECN enables the delivery of the traffic class of the datagrams
+// received on IPv6 sockets, and of the type of service of their
+// IPv4-mapped traffic on a best effort basis, or of the type of service
+// of the datagrams received on IPv4 sockets.
+func setRecvECN(network string, fd int) error {
+	if !ipv6Network(network) {
+		if ipRecvTOS < 0 {
+			return unsupportedOption("IP_RECVTOS")
+		}
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, ipRecvTOS, 1)
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_RECVTCLASS, 1); err != nil {
+		return err
+	}
+	if ipRecvTOS >= 0 {
+		unix.SetsockoptInt(fd, unix.IPPROTO_IP, ipRecvTOS, 1)
+	}
+	return nil
+}
+
+func setKeepAlive(fd int, ka *keepAlive) error {
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1); err != nil {
+		return err
+	}
+	opts := []struct {
+		name  string
+		opt   int
+		value int
+	}{
+		{"TCP_KEEPIDLE", tcpKeepIdle, int(roundDuration(ka.idle, keepAliveUnit))},
+		{"TCP_KEEPINTVL", tcpKeepIntvl, int(roundDuration(ka.interval, keepAliveUnit))},
+		{"TCP_KEEPCNT", tcpKeepCnt, ka.count},
+	}
+	for _, o := range opts {
+		if o.value <= 0 {
+			continue
+		}
+		if o.opt < 0 {
+			return unsupportedOption(o.name)
+		}
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, o.opt, o.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func probe(network string) (Capabilities, error) {
+	var family, sotype int
+	switch network {
+	case "tcp", "tcp4":
+		family, sotype = unix.AF_INET, unix.SOCK_STREAM
+	case "tcp6":
+		family, sotype = unix.AF_INET6, unix.SOCK_STREAM
+	case "udp", "udp4":
+		family, sotype = unix.AF_INET, unix.SOCK_DGRAM
+	case "udp6":
+		family, sotype = unix.AF_INET6, unix.SOCK_DGRAM
+	case "unix":
+		family, sotype = unix.AF_UNIX, unix.SOCK_STREAM
+	case "unixgram":
+		family, sotype = unix.AF_UNIX, unix.SOCK_DGRAM
+	case "unixpacket":
+		family, sotype = unix.AF_UNIX, unix.SOCK_SEQPACKET
+	default:
+		return Capabilities{}, net.UnknownNetworkError(network)
+	}
+
+	fd, err := unix.Socket(family, sotype, 0)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	defer unix.Close(fd)
+
+	caps := Capabilities{
+		ReuseAddr: unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1) == nil,
+		ReusePort: unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1) == nil,
+	}
+	caps.ReusePortLB = probeReusePortLB(fd)
+	caps.LoadBalanced = caps.ReusePort && reusePortBalanced
+	return caps, nil
+}
+
+// familySuffix returns the suffix of the networks of the address family
+// of the socket fd, "4" or "6", or an empty string for other families.
+func familySuffix(fd uintptr) (string, error) {
+	sa, err := unix.Getsockname(int(fd))
+	if err != nil {
+		return "", err
+	}
+	switch sa.(type) {
+	case *unix.SockaddrInet4:
+		return "4", nil
+	case *unix.SockaddrInet6:
+		return "6", nil
+	}
+	return "", nil
+}
+
+// closeOnExec sets the close-on-exec flag of fd.
+func closeOnExec(fd int) {
+	unix.CloseOnExec(fd)
 }
@@ -1,16 +1,273 @@
 package reuse
 
 import (
-	"syscall"
+	"net"
+	"time"
+	"unsafe"
 
 	"golang.org/x/sys/windows"
 )
 
-func Control(network, address string, c syscall.RawConn) (err error) {
-	if err := c.Control(func(fd uintptr) {
-		err = windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_REUSEADDR, 1)
-	}); err != nil {
+// reusePortBalanced is false as SO_REUSEADDR on Windows does not
+// distribute connections between the sockets sharing a port.
+const reusePortBalanced = false
+
+const soReusePortLB = -1
+
+func (c *config) setsockopt(network string, fd uintptr) error {
+	if opt := c.linuxOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+	if opt := c.darwinOption(); opt != "" {
+		return unsupportedOption(opt)
+	}
+	if c.notSentLowat > 0 {
+		return unsupportedOption("TCP_NOTSENT_LOWAT")
+	}
+	if c.maxSeg > 0 {
+		return unsupportedOption("TCP_MAXSEG")
+	}
+
+	if c.exclusiveAddr {
+		if err := windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, soExclusiveAddrUse, 1); err != nil {
+			return err
+		}
+	} else if c.reuseAddr || c.reusePort {
+		if err := windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_REUSEADDR, 1); err != nil {
+			return err
+		}
+	}
+
+	if c.reuseUnicastPort {
+		err := windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, soReuseUnicastPort, 1)
+		if err == windows.WSAENOPROTOOPT && !c.strict {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.rcvBuf > 0 {
+		if err := windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_RCVBUF, c.rcvBuf); err != nil {
+			return err
+		}
+	}
+
+	if c.sndBuf > 0 {
+		if err := windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_SNDBUF, c.sndBuf); err != nil {
+			return err
+		}
+	}
+
+	if c.linger != nil {
+		l := windows.Linger{}
+		if *c.linger >= 0 {
+			l.Onoff = 1
+			l.Linger = int32(*c.linger)
+		}
+		if err := windows.SetsockoptLinger(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_LINGER, &l); err != nil {
+			return err
+		}
+	}
+
+	if c.tos != nil {
+		level, opt := windows.IPPROTO_IP, windows.IP_TOS
+		if ipv6Network(network) {
+			level, opt = windows.IPPROTO_IPV6, ipv6TClass
+		}
+		if err := windows.SetsockoptInt(windows.Handle(fd), level, opt, *c.tos); err != nil {
+			return err
+		}
+	}
+
+	if c.ttl > 0 {
+		level, opt := windows.IPPROTO_IP, windows.IP_TTL
+		if ipv6Network(network) {
+			level, opt = windows.IPPROTO_IPV6, windows.IPV6_UNICAST_HOPS
+		}
+		if err := windows.SetsockoptInt(windows.Handle(fd), level, opt, c.ttl); err != nil {
+			return err
+		}
+	}
+
+	if c.broadcast != nil && udp(network) {
+		if err := windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_BROADCAST, boolint(*c.broadcast)); err != nil {
+			return err
+		}
+	}
+
+	if c.dontFrag != nil && udp(network) {
+		if err := setIPOption(network, windows.Handle(fd), ipDontFragment, ipv6DontFrag, boolint(*c.dontFrag)); err != nil && !c.bestEffortDF {
+			return err
+		}
+	}
+
+	if c.recvECN && udp(network) {
+		if err := setIPOption(network, windows.Handle(fd), ipRecvECN, ipv6RecvECN, 1); err != nil && !c.bestEffortECN {
+			return err
+		}
+	}
+
+	if c.hdrIncl && ipRaw(network) && !ipv6Network(network) {
+		if err := windows.SetsockoptInt(windows.Handle(fd), windows.IPPROTO_IP, windows.IP_HDRINCL, 1); err != nil {
+			return err
+		}
+	}
+
+	if c.udpConnReset != nil && udp(network) {
+		if err := setUDPConnReset(windows.Handle(fd), *c.udpConnReset); err != nil {
+			return err
+		}
+	}
+
+	if c.keepAlive != nil && tcp(network) {
+		if err := setKeepAlive(windows.Handle(fd), c.keepAlive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const ipv6TClass = 39
+
+// Socket options of the Windows SDK missing from x/sys.
+const (
+	soReuseUnicastPort = 0x3007
+	soExclusiveAddrUse = ^windows.SO_REUSEADDR
+)
+
+// IP options of the Windows SDK missing from x/sys.
+const (
+	ipDontFragment = 14
+	ipv6DontFrag   = 14
+	ipRecvECN      = 50
+	ipv6RecvECN    = 50
+)
+
+// setIPOption sets the IPPROTO_IPV6 option v6 on IPv6 sockets, and the
+// IPPROTO_IP option v4 for their IPv4-mapped traffic on a best effort
+// basis, or v4 on IPv4 sockets.
+func setIPOption(network string, fd windows.Handle, v4, v6, value int) error {
+	if !ipv6Network(network) {
+		return windows.SetsockoptInt(fd, windows.IPPROTO_IP, v4, value)
+	}
+	if err := windows.SetsockoptInt(fd, windows.IPPROTO_IPV6, v6, value); err != nil {
+		return err
+	}
+	windows.SetsockoptInt(fd, windows.IPPROTO_IP, v4, value)
+	return nil
+}
+
+// setUDPConnReset enables or disables the WSAECONNRESET errors reported
+// by the reads of a UDP socket after an ICMP port unreachable message.
+func setUDPConnReset(fd windows.Handle, enable bool) error {
+	flag := uint32(boolint(enable))
+	var n uint32
+	return windows.WSAIoctl(fd, windows.SIO_UDP_CONNRESET, (*byte)(unsafe.Pointer(&flag)), uint32(unsafe.Sizeof(flag)), nil, 0, &n, nil, 0)
+}
+
+// TCP keepalive options available starting with Windows 10 version 1709.
+const (
+	tcpKeepIdle  = 3
+	tcpKeepIntvl = 17
+	tcpKeepCnt   = 16
+)
+
+func setKeepAlive(fd windows.Handle, ka *keepAlive) error {
+	if err := windows.SetsockoptInt(fd, windows.SOL_SOCKET, windows.SO_KEEPALIVE, 1); err != nil {
 		return err
 	}
-	return
+	if ka.idle > 0 {
+		if err := windows.SetsockoptInt(fd, windows.IPPROTO_TCP, tcpKeepIdle, int(roundDuration(ka.idle, time.Second))); err != nil {
+			return err
+		}
+	}
+	if ka.interval > 0 {
+		if err := windows.SetsockoptInt(fd, windows.IPPROTO_TCP, tcpKeepIntvl, int(roundDuration(ka.interval, time.Second))); err != nil {
+			return err
+		}
+	}
+	if ka.count > 0 {
+		if err := windows.SetsockoptInt(fd, windows.IPPROTO_TCP, tcpKeepCnt, ka.count); err != nil {
+			return err
+		}
+	}
+	return nil
 }
+
+func probe(network string) (Capabilities, error) {
+	var family, sotype int
+	switch network {
+	case "tcp", "tcp4":
+		family, sotype = windows.AF_INET, windows.SOCK_STREAM
+	case "tcp6":
+		family, sotype = windows.AF_INET6, windows.SOCK_STREAM
+	case "udp", "udp4":
+		family, sotype = windows.AF_INET, windows.SOCK_DGRAM
+	case "udp6":
+		family, sotype = windows.AF_INET6, windows.SOCK_DGRAM
+	case "unix":
+		family, sotype = windows.AF_UNIX, windows.SOCK_STREAM
+	case "unixgram":
+		family, sotype = windows.AF_UNIX, windows.SOCK_DGRAM
+	case "unixpacket":
+		family, sotype = windows.AF_UNIX, windows.SOCK_SEQPACKET
+	default:
+		return Capabilities{}, net.UnknownNetworkError(network)
+	}
+
+	fd, err := windows.Socket(family, sotype, 0)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	defer windows.Closesocket(fd)
+
+	// SO_EXCLUSIVEADDRUSE cannot be set together with SO_REUSEADDR, so it
+	// is probed on another socket.
+	exclusive := false
+	if xfd, err := windows.Socket(family, sotype, 0); err == nil {
+		exclusive = windows.SetsockoptInt(xfd, windows.SOL_SOCKET, soExclusiveAddrUse, 1) == nil
+		windows.Closesocket(xfd)
+	}
+
+	reuseAddr := windows.SetsockoptInt(fd, windows.SOL_SOCKET, windows.SO_REUSEADDR, 1) == nil
+	return Capabilities{
+		ReuseAddr:        reuseAddr,
+		ReusePort:        reuseAddr,
+		ExclusiveAddrUse: exclusive,
+		Hijackable:       reuseAddr,
+	}, nil
+}
+
+func attachReusePortProg(fd uintptr, prog int) error {
+	return unsupportedOption("SO_ATTACH_REUSEPORT_EBPF")
+}
+
+func setQuickAck(fd uintptr, enable bool) error {
+	return unsupportedOption("TCP_QUICKACK")
+}
+
+func availableCongestionControls() ([]string, error) {
+	return nil, unsupportedOption("TCP_CONGESTION")
+}
+
+// familySuffix returns the suffix of the networks of the address family
+// of the socket fd, "4" or "6", or an empty string for other families.
+func familySuffix(fd uintptr) (string, error) {
+	sa, err := windows.Getsockname(windows.Handle(fd))
+	if err != nil {
+		return "", err
+	}
+	switch sa.(type) {
+	case *windows.SockaddrInet4:
+		return "4", nil
+	case *windows.SockaddrInet6:
+		return "6", nil
+	}
+	return "", nil
+}
+
+// closeOnExec does nothing, the handles not being inherited unless
+// marked so.
+func closeOnExec(fd int) {}
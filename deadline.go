@@ -0,0 +1,48 @@
+package reuse
+
+import (
+	"sync"
+	"time"
+)
+
+// readDeadline is the read deadline of the conns of this package whose
+// reads wait on channels filled by a read loop rather than on a socket.
+type readDeadline struct {
+	mu      sync.Mutex
+	t       time.Time
+	changed chan struct{}
+}
+
+func newReadDeadline() *readDeadline {
+	return &readDeadline{changed: make(chan struct{})}
+}
+
+// set sets the deadline to t, waking the reads waiting on the previous
+// deadline.
+func (d *readDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.t = t
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// wait returns a channel receiving when the deadline is reached, nil if
+// there is none, and a channel closed when the deadline is changed.
+// expired reports whether the deadline has already been reached. stop
+// releases the resources of the timeout channel.
+func (d *readDeadline) wait() (timeout <-chan time.Time, changed <-chan struct{}, stop func(), expired bool) {
+	d.mu.Lock()
+	t, changed := d.t, d.changed
+	d.mu.Unlock()
+
+	if t.IsZero() {
+		return nil, changed, func() {}, false
+	}
+	wait := time.Until(t)
+	if wait <= 0 {
+		return nil, changed, func() {}, true
+	}
+	timer := time.NewTimer(wait)
+	return timer.C, changed, func() { timer.Stop() }, false
+}
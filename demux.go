@@ -0,0 +1,267 @@
+package reuse
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// demuxBacklog is the number of new peers waiting to be accepted.
+	demuxBacklog = 16
+	// demuxQueue is the number of datagrams queued per peer.
+	demuxQueue = 64
+	// maxDatagram is the size of the largest datagram read.
+	maxDatagram = 65535
+)
+
+// ErrDemuxClosed is returned by the methods of a closed Demux and of its
+// connections.
+var ErrDemuxClosed = errors.New("reuse: demux closed")
+
+// Demux shares a single packet conn, typically returned by ListenPacket,
+// between per peer connections: it hands out a net.Conn per remote
+// address whose Read returns the datagrams of that peer and whose Write
+// sends to it. This allows datagram servers to reuse connection oriented
+// code while sharing a single reused port.
+//
+// Demux implements net.Listener, Accept returning the connection of each
+// new peer. Datagrams from new peers are dropped while the accept
+// backlog is full, as are the datagrams of a peer whose connection is
+// not read fast enough.
+type Demux struct {
+	pc net.PacketConn
+
+	mu     sync.Mutex
+	conns  map[string]*demuxConn
+	accept chan *demuxConn
+	done   chan struct{}
+	err    error
+}
+
+// NewDemux returns a Demux reading from pc. The Demux owns pc, closing it
+// when closed.
+func NewDemux(pc net.PacketConn) *Demux {
+	d := &Demux{
+		pc:     pc,
+		conns:  make(map[string]*demuxConn),
+		accept: make(chan *demuxConn, demuxBacklog),
+		done:   make(chan struct{}),
+	}
+	go d.readLoop()
+	return d
+}
+
+// Accept waits for and returns the connection of the next new peer.
+func (d *Demux) Accept() (net.Conn, error) {
+	select {
+	case c := <-d.accept:
+		return c, nil
+	case <-d.done:
+		return nil, d.closeErr()
+	}
+}
+
+// Dial returns the connection of the peer raddr, creating it if the peer
+// has none yet. A connection created by Dial is not returned by Accept.
+func (d *Demux) Dial(raddr net.Addr) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conns == nil {
+		return nil, d.err
+	}
+	key := raddr.String()
+	if c, ok := d.conns[key]; ok {
+		return c, nil
+	}
+	c := newDemuxConn(d, raddr)
+	d.conns[key] = c
+	return c, nil
+}
+
+// Addr returns the local address of the underlying packet conn.
+func (d *Demux) Addr() net.Addr {
+	return d.pc.LocalAddr()
+}
+
+// Close closes the underlying packet conn and all the peer connections.
+func (d *Demux) Close() error {
+	d.shutdown(ErrDemuxClosed)
+	return d.pc.Close()
+}
+
+func (d *Demux) closeErr() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+func (d *Demux) shutdown(err error) {
+	d.mu.Lock()
+	if d.conns == nil {
+		d.mu.Unlock()
+		return
+	}
+	conns := d.conns
+	d.conns = nil
+	d.err = err
+	close(d.done)
+	d.mu.Unlock()
+
+	for _, c := range conns {
+		c.shutdown()
+	}
+}
+
+func (d *Demux) readLoop() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := d.pc.ReadFrom(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			d.shutdown(err)
+			return
+		}
+
+		d.mu.Lock()
+		if d.conns == nil {
+			d.mu.Unlock()
+			return
+		}
+		key := addr.String()
+		c, ok := d.conns[key]
+		if !ok {
+			if len(d.accept) == cap(d.accept) {
+				d.mu.Unlock()
+				continue
+			}
+			c = newDemuxConn(d, addr)
+			d.conns[key] = c
+			d.accept <- c
+		}
+		d.mu.Unlock()
+
+		c.deliver(append([]byte(nil), buf[:n]...))
+	}
+}
+
+func (d *Demux) remove(c *demuxConn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conns[c.raddr.String()] == c {
+		delete(d.conns, c.raddr.String())
+	}
+}
+
+// demuxConn is the connection of a single peer of a Demux.
+type demuxConn struct {
+	d     *Demux
+	raddr net.Addr
+	queue chan []byte
+
+	mu       sync.Mutex
+	closed   chan struct{}
+	deadline *readDeadline
+}
+
+func newDemuxConn(d *Demux, raddr net.Addr) *demuxConn {
+	return &demuxConn{
+		d:        d,
+		raddr:    raddr,
+		queue:    make(chan []byte, demuxQueue),
+		closed:   make(chan struct{}),
+		deadline: newReadDeadline(),
+	}
+}
+
+func (c *demuxConn) deliver(b []byte) {
+	select {
+	case c.queue <- b:
+	default:
+	}
+}
+
+func (c *demuxConn) Read(b []byte) (int, error) {
+	for {
+		n, retry, err := c.read(b)
+		if !retry {
+			return n, err
+		}
+	}
+}
+
+// read waits for a datagram until the read deadline, returning retry if
+// the deadline was changed meanwhile.
+func (c *demuxConn) read(b []byte) (n int, retry bool, err error) {
+	timeout, changed, stop, expired := c.deadline.wait()
+	defer stop()
+	if expired {
+		return 0, false, os.ErrDeadlineExceeded
+	}
+
+	select {
+	case p := <-c.queue:
+		return copy(b, p), false, nil
+	case <-c.closed:
+		return 0, false, net.ErrClosed
+	case <-c.d.done:
+		return 0, false, c.d.closeErr()
+	case <-timeout:
+		return 0, false, os.ErrDeadlineExceeded
+	case <-changed:
+		return 0, true, nil
+	}
+}
+
+func (c *demuxConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	return c.d.pc.WriteTo(b, c.raddr)
+}
+
+func (c *demuxConn) Close() error {
+	c.d.remove(c)
+	c.shutdown()
+	return nil
+}
+
+func (c *demuxConn) shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+}
+
+func (c *demuxConn) LocalAddr() net.Addr {
+	return c.d.pc.LocalAddr()
+}
+
+func (c *demuxConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *demuxConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *demuxConn) SetReadDeadline(t time.Time) error {
+	c.deadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline is a no-op, as writes to the shared packet conn do not
+// block on a single peer.
+func (c *demuxConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
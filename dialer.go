@@ -0,0 +1,95 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Dialer contains options for connecting to an address from a socket
+// with SO_REUSEPORT and SO_REUSEADDR option set. It mirrors net.Dialer,
+// see there for the documentation of the fields.
+//
+// The zero value for each field is equivalent to dialing without that
+// option.
+type Dialer struct {
+	Timeout       time.Duration
+	Deadline      time.Time
+	LocalAddr     net.Addr
+	FallbackDelay time.Duration
+	KeepAlive     time.Duration
+	Resolver      *net.Resolver
+
+	// Control and ControlContext are called after the reuse options
+	// have been applied to the socket. If both are set, both are called,
+	// Control first.
+	Control        func(network, address string, c syscall.RawConn) error
+	ControlContext func(ctx context.Context, network, address string, c syscall.RawConn) error
+
+	// Options are the socket options applied to every dialed socket.
+	Options []Option
+
+	mptcp    bool
+	mptcpSet bool
+}
+
+// MultipathTCP reports whether MPTCP will be used. see
+// net.Dialer.MultipathTCP
+func (d *Dialer) MultipathTCP() bool {
+	if d.mptcpSet {
+		return d.mptcp
+	}
+	var nd net.Dialer
+	return nd.MultipathTCP()
+}
+
+// SetMultipathTCP directs the Dial methods to use, or not use, MPTCP, if
+// supported by the operating system. see net.Dialer.SetMultipathTCP
+func (d *Dialer) SetMultipathTCP(use bool) {
+	d.mptcp = use
+	d.mptcpSet = true
+}
+
+// Dial connects to the address on the named network. see net.Dialer.Dial
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using the
+// provided context. see net.Dialer.DialContext
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	cfg := newConfig(d.Options)
+	return cfg.dial(ctx, d.netDialer(cfg), network, address)
+}
+
+func (d *Dialer) netDialer(cfg *config) *net.Dialer {
+	nd := cfg.dialer(d.LocalAddr)
+	nd.Timeout = d.Timeout
+	nd.Deadline = d.Deadline
+	nd.FallbackDelay = d.FallbackDelay
+	if cfg.keepAlive == nil {
+		nd.KeepAlive = d.KeepAlive
+	}
+	if d.Resolver != nil {
+		nd.Resolver = d.Resolver
+	}
+	if d.mptcpSet {
+		nd.SetMultipathTCP(d.mptcp)
+	}
+	if fakeNet {
+		return nd
+	}
+	control := ComposeControl(nd.Control, d.Control)
+	nd.Control = nil
+	nd.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+		if err := control(network, address, c); err != nil {
+			return err
+		}
+		if d.ControlContext != nil {
+			return d.ControlContext(ctx, network, address, c)
+		}
+		return nil
+	}
+	return nd
+}
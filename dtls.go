@@ -0,0 +1,93 @@
+package reuse
+
+import (
+	"context"
+	"net"
+)
+
+// ListenDTLS listens at the given UDP network and address, returning a
+// listener accepting the secure datagram connections established by
+// server over the connection of each new peer, see Demux. server is a
+// DTLS implementation, such as pion/dtls:
+//
+//	l, _ := reuse.ListenDTLS("udp", "0.0.0.0:4444", func(c net.Conn) (net.Conn, error) {
+//		return dtls.Server(c, config)
+//	})
+//
+// Handshakes run concurrently, Accept returning the connections whose
+// handshake succeeded. server is responsible for timing out handshakes.
+func ListenDTLS(network, address string, server func(net.Conn) (net.Conn, error), opts ...Option) (net.Listener, error) {
+	pc, err := ListenPacketContext(context.Background(), network, address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	l := &dtlsListener{
+		d:      NewDemux(pc),
+		server: server,
+		conns:  make(chan net.Conn),
+	}
+	go l.acceptLoop()
+	return l, nil
+}
+
+// DialDTLS dials the given UDP network and address from laddr, returning
+// the secure datagram connection established by client, a DTLS
+// implementation such as pion/dtls, over it. see ListenDTLS
+func DialDTLS(network, laddr, raddr string, client func(net.Conn) (net.Conn, error), opts ...Option) (net.Conn, error) {
+	conn, err := Dial(network, laddr, raddr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := client(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return sc, nil
+}
+
+type dtlsListener struct {
+	d      *Demux
+	server func(net.Conn) (net.Conn, error)
+	conns  chan net.Conn
+}
+
+func (l *dtlsListener) acceptLoop() {
+	for {
+		c, err := l.d.Accept()
+		if err != nil {
+			return
+		}
+		go l.handshake(c)
+	}
+}
+
+func (l *dtlsListener) handshake(c net.Conn) {
+	sc, err := l.server(c)
+	if err != nil {
+		c.Close()
+		return
+	}
+	select {
+	case l.conns <- sc:
+	case <-l.d.done:
+		sc.Close()
+	}
+}
+
+func (l *dtlsListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.d.done:
+		return nil, l.d.closeErr()
+	}
+}
+
+func (l *dtlsListener) Close() error {
+	return l.d.Close()
+}
+
+func (l *dtlsListener) Addr() net.Addr {
+	return l.d.Addr()
+}
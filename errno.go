@@ -0,0 +1,27 @@
+//go:build !plan9
+// +build !plan9
+
+package reuse
+
+import (
+	"errors"
+	"syscall"
+)
+
+// The errors of the system calls checked to classify the failures of the
+// sockets.
+var (
+	errAddrInUse    error = syscall.EADDRINUSE
+	errAddrNotAvail error = syscall.EADDRNOTAVAIL
+	errConnRefused  error = syscall.ECONNREFUSED
+)
+
+// acceptPermanent reports whether err, returned by Accept, means the
+// listener cannot accept anymore, its socket being gone or not listening,
+// rather than failing for a connection or a lack of resources.
+func acceptPermanent(err error) bool {
+	return errors.Is(err, syscall.EBADF) ||
+		errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.ENOTSOCK) ||
+		errors.Is(err, syscall.EOPNOTSUPP)
+}
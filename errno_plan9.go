@@ -0,0 +1,17 @@
+package reuse
+
+import "errors"
+
+// Plan 9 reports the failures of the system calls as strings, which are
+// not classified.
+var (
+	errAddrInUse    = errors.New("address in use")
+	errAddrNotAvail = errors.New("address not available")
+	errConnRefused  = errors.New("connection refused")
+)
+
+// acceptPermanent reports whether err, returned by Accept, means the
+// listener cannot accept anymore. The errors of Plan 9 are retried.
+func acceptPermanent(err error) bool {
+	return false
+}
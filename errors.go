@@ -0,0 +1,78 @@
+package reuse
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// The errors of the Listen and Dial functions wrap one of the following
+// errors, describing their kind, together with the underlying error,
+// typically a syscall.Errno, so that both can be tested with errors.Is:
+//
+//	if errors.Is(err, reuse.ErrPortInUse) { ... }
+//	if errors.Is(err, syscall.EADDRINUSE) { ... }
+
+// ErrPortInUse is returned when the local address is already in use by a
+// socket that does not share it, for instance one without port reuse or
+// owned by another user.
+var ErrPortInUse = errors.New("reuse: address already in use")
+
+// ErrAddrResolution is returned when an address cannot be resolved.
+var ErrAddrResolution = errors.New("reuse: cannot resolve address")
+
+// ErrControlFailed is returned when the socket options cannot be set on
+// a socket, which is then closed.
+var ErrControlFailed = errors.New("reuse: setting socket options failed")
+
+// ErrReuseUnsupported is returned in strict mode when the platform cannot
+// guarantee that SO_REUSEPORT load-balances between the sockets sharing
+// a port.
+var ErrReuseUnsupported = errors.New("reuse: load-balancing port reuse is not supported on this platform")
+
+// ErrOptionUnsupported is returned when a requested socket option is not
+// available on the platform.
+var ErrOptionUnsupported = errors.New("reuse: socket option not supported on this platform")
+
+func unsupportedOption(name string) error {
+	return fmt.Errorf("%w: %s", ErrOptionUnsupported, name)
+}
+
+// ErrCongestionUnavailable is returned when the requested TCP congestion
+// control algorithm is not available on the running kernel.
+var ErrCongestionUnavailable = errors.New("reuse: congestion control algorithm not available")
+
+// ErrDialSelf is returned when a TCP connection would connect a socket to
+// itself: the local and remote addresses are the same, so the 4-tuple of
+// the connection clashes with itself. Dial from another local port.
+var ErrDialSelf = errors.New("reuse: cannot dial self, the local and remote addresses are the same")
+
+// ErrBindConflict is returned, with the WithConflictCheck option, when
+// a wildcard address would be bound to the port of a socket bound to a
+// specific address, or the other way round.
+var ErrBindConflict = errors.New("reuse: wildcard and specific address binds conflict")
+
+// NotLiteralError is returned, wrapped with ErrAddrResolution, when the
+// host of a local address is not an IP literal and the WithLiteralOnly
+// option forbids looking it up.
+type NotLiteralError struct {
+	Addr string // the address
+	Host string // its host, neither an IP address nor an interface name
+}
+
+func (e *NotLiteralError) Error() string {
+	return "reuse: host " + e.Host + " of address " + e.Addr + " is not an IP literal"
+}
+
+// classify wraps the underlying error of err, as returned by a listen or
+// a dial, with the error of its kind.
+func classify(err error) error {
+	oe, ok := err.(*net.OpError)
+	if !ok {
+		return err
+	}
+	if errors.Is(oe.Err, errAddrInUse) && !errors.Is(oe.Err, ErrPortInUse) {
+		oe.Err = fmt.Errorf("%w: %w", ErrPortInUse, oe.Err)
+	}
+	return err
+}
@@ -0,0 +1,374 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultDiscoverTimeout bounds the discovery of an AddrDiscoverer.
+const defaultDiscoverTimeout = 5 * time.Second
+
+// Confidence of each source of external addresses, combined when
+// several sources agree on an address.
+const (
+	// confidenceLocal is the confidence in a public address of the host.
+	confidenceLocal = 0.9
+	// confidenceMapping is the confidence in a port mapping.
+	confidenceMapping = 0.9
+	// confidenceSTUN is the confidence in the reflexive address of a
+	// single STUN server, which only holds for other destinations if the
+	// mapping is endpoint independent.
+	confidenceSTUN = 0.6
+	// confidenceGatewayIP is the confidence in the external address of
+	// the gateway with the local port, NATs not always preserving ports.
+	confidenceGatewayIP = 0.3
+	// confidenceDisagreeing scales the confidence of the reflexive
+	// addresses of STUN servers disagreeing with each other, a sign of
+	// mappings per destination.
+	confidenceDisagreeing = 0.5
+	// confidencePrivate scales the confidence of private or shared
+	// addresses, such as those of a gateway behind a carrier-grade NAT.
+	confidencePrivate = 0.2
+)
+
+// ExternalAddr is an address a listener may be reachable at from outside
+// its NATs, as discovered by an AddrDiscoverer.
+type ExternalAddr struct {
+	// Addr is the external address and port.
+	Addr net.Addr
+
+	// Sources are the sources that reported the address: "local",
+	// "stun", "pcp", "nat-pmp" or "gateway".
+	Sources []string
+
+	// Confidence is the confidence in the address, between 0 and 1.
+	Confidence float64
+}
+
+// AddrDiscoverer discovers how a listener is reachable from outside its
+// NATs by combining the addresses of the host, the reflexive addresses
+// learnt through STUN from the port of the listener and the mappings of
+// the gateway through PCP or NAT-PMP.
+//
+// The zero value for each field selects its default.
+type AddrDiscoverer struct {
+	// STUNServers are the STUN servers queried, over UDP for UDP
+	// listeners and over TCP for TCP listeners.
+	STUNServers []string
+
+	// Mapper is the port mapper of the gateway. By default it is
+	// discovered by DiscoverMapper, without failing the discovery if
+	// there is none.
+	Mapper Mapper
+
+	// MapPort creates a port mapping for the listener, left in place for
+	// MapLifetime. Otherwise only the external address of the gateway is
+	// learnt. See PortMapManager to keep the mapping.
+	MapPort     bool
+	MapLifetime time.Duration
+
+	// Timeout bounds the discovery, 5s by default.
+	Timeout time.Duration
+
+	// Options are the socket options of the sockets dialed from the port
+	// of the listener to the STUN servers.
+	Options []Option
+}
+
+// DiscoverExternalAddr discovers the external addresses of the listener
+// bound to addr, as returned by Addr or LocalAddr, querying stunServers.
+// see AddrDiscoverer
+func DiscoverExternalAddr(ctx context.Context, addr net.Addr, stunServers ...string) ([]ExternalAddr, error) {
+	d := &AddrDiscoverer{STUNServers: stunServers}
+	return d.Discover(ctx, addr)
+}
+
+// Discover discovers the external addresses of the listener bound to
+// addr, which must have been created with port reuse so that the STUN
+// queries can be sent from its port. The addresses are returned by
+// decreasing confidence, the error is only set if none was found.
+func (d *AddrDiscoverer) Discover(ctx context.Context, addr net.Addr) ([]ExternalAddr, error) {
+	protocol, port, err := mappedPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = defaultDiscoverTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		found []ExternalAddr
+		errs  []error
+		wg    sync.WaitGroup
+	)
+	report := func(a ExternalAddr, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		found = append(found, a)
+	}
+
+	ip := addrIP(addr)
+	if ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+		report(ExternalAddr{Addr: addr, Sources: []string{"local"}, Confidence: scoreIP(ip, confidenceLocal)}, nil)
+	}
+
+	var stun []ExternalAddr
+	for _, server := range d.STUNServers {
+		server := server
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mapped, err := d.stunBinding(ctx, protocol, addr, server)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("STUN %s: %w", server, err))
+				return
+			}
+			stun = append(stun, ExternalAddr{Addr: mapped, Sources: []string{"stun"}})
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		report(d.gateway(ctx, protocol, port))
+	}()
+	wg.Wait()
+
+	// Reflexive addresses differing between servers are mapped per
+	// destination and unlikely to be reachable by others.
+	agree := true
+	for _, a := range stun {
+		agree = agree && a.Addr.String() == stun[0].Addr.String()
+	}
+	for _, a := range stun {
+		a.Confidence = scoreIP(addrIP(a.Addr), confidenceSTUN)
+		if !agree {
+			a.Confidence *= confidenceDisagreeing
+		}
+		found = append(found, a)
+	}
+
+	res := mergeExternalAddrs(found)
+	if len(res) == 0 {
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		return nil, errors.New("reuse: no external address found")
+	}
+	return res, nil
+}
+
+// gateway returns the external address of the gateway, with the mapped
+// port if a mapping is requested.
+func (d *AddrDiscoverer) gateway(ctx context.Context, protocol string, port int) (ExternalAddr, error) {
+	mapper := d.Mapper
+	if mapper == nil {
+		m, err := DiscoverMapper(ctx)
+		if err != nil {
+			return ExternalAddr{}, err
+		}
+		mapper = m
+	}
+	source := mapperSource(mapper)
+
+	if d.MapPort {
+		lifetime := d.MapLifetime
+		if lifetime <= 0 {
+			lifetime = defaultMapLifetime
+		}
+		m, err := mapper.MapPort(ctx, protocol, port, port, lifetime)
+		if err != nil {
+			return ExternalAddr{}, err
+		}
+		return ExternalAddr{
+			Addr:       m.ExternalAddr(),
+			Sources:    []string{source},
+			Confidence: scoreIP(m.ExternalIP, confidenceMapping),
+		}, nil
+	}
+
+	ip, err := mapper.ExternalIP(ctx)
+	if err != nil {
+		return ExternalAddr{}, err
+	}
+	m := &Mapping{Protocol: protocol, ExternalIP: ip, ExternalPort: port}
+	return ExternalAddr{
+		Addr:       m.ExternalAddr(),
+		Sources:    []string{"gateway"},
+		Confidence: scoreIP(ip, confidenceGatewayIP),
+	}, nil
+}
+
+// stunBinding returns the reflexive address of a socket dialed from addr
+// to server, over TCP for TCP listeners.
+func (d *AddrDiscoverer) stunBinding(ctx context.Context, protocol string, addr net.Addr, server string) (net.Addr, error) {
+	cfg := newConfig(d.Options)
+	conn, err := cfg.dial(ctx, cfg.dialer(addr), protocol, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Unblock the reads when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	req := newSTUNRequest()
+	var resp *stunMessage
+	if protocol == "tcp" {
+		resp, err = stunStreamRoundTrip(conn, req)
+	} else {
+		resp, err = stunDatagramRoundTrip(conn, req)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.typ == stunBindingError {
+		return nil, resp.errorCode()
+	}
+	mapped, err := resp.mappedAddr()
+	if err != nil {
+		return nil, err
+	}
+	if protocol == "tcp" {
+		return &net.TCPAddr{IP: mapped.IP, Port: mapped.Port}, nil
+	}
+	return mapped, nil
+}
+
+// stunDatagramRoundTrip sends req on the connected UDP socket conn with
+// retransmissions, returning the response to it.
+func stunDatagramRoundTrip(conn net.Conn, req *stunMessage) (*stunMessage, error) {
+	b := req.marshal()
+	buf := make([]byte, maxDatagram)
+	rto := stunRTO
+	for i := 0; i < stunRetries; i++ {
+		if _, err := conn.Write(b); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(rto))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if m, ok := parseSTUN(buf[:n]); ok && m.txid == req.txid {
+				return m, nil
+			}
+		}
+		rto *= 2
+	}
+	return nil, ErrSTUNTimeout
+}
+
+// stunStreamRoundTrip sends req on the TCP connection conn, returning the
+// response to it.
+func stunStreamRoundTrip(conn net.Conn, req *stunMessage) (*stunMessage, error) {
+	if _, err := conn.Write(req.marshal()); err != nil {
+		return nil, err
+	}
+	for {
+		b := make([]byte, stunHeaderSize)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+		size := int(b[2])<<8 | int(b[3])
+		b = append(b, make([]byte, size)...)
+		if _, err := io.ReadFull(conn, b[stunHeaderSize:]); err != nil {
+			return nil, err
+		}
+		m, ok := parseSTUN(b)
+		if !ok {
+			return nil, errors.New("reuse: malformed STUN message")
+		}
+		if m.txid == req.txid {
+			return m, nil
+		}
+	}
+}
+
+// mergeExternalAddrs merges the addresses reported by several sources,
+// combining their confidence as independent evidence, and sorts them by
+// decreasing confidence.
+func mergeExternalAddrs(addrs []ExternalAddr) []ExternalAddr {
+	var res []ExternalAddr
+	index := make(map[string]int)
+	for _, a := range addrs {
+		key := a.Addr.String()
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(res)
+			res = append(res, a)
+			continue
+		}
+		r := &res[i]
+		r.Sources = append(r.Sources, a.Sources...)
+		r.Confidence = 1 - (1-r.Confidence)*(1-a.Confidence)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Confidence > res[j].Confidence
+	})
+	return res
+}
+
+// scoreIP scales confidence down for private and shared addresses, which
+// are not reachable from the Internet.
+func scoreIP(ip net.IP, confidence float64) float64 {
+	if ip.IsPrivate() || isSharedAddr(ip) || ip.IsLinkLocalUnicast() {
+		return confidence * confidencePrivate
+	}
+	return confidence
+}
+
+// sharedNet is the shared address space of carrier-grade NATs, see RFC
+// 6598.
+var sharedNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+func isSharedAddr(ip net.IP) bool {
+	return sharedNet.Contains(ip)
+}
+
+func mapperSource(m Mapper) string {
+	switch m.(type) {
+	case *PCPClient:
+		return "pcp"
+	case *NATPMPClient:
+		return "nat-pmp"
+	}
+	return "gateway"
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
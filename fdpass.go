@@ -0,0 +1,134 @@
+package reuse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// maxPassedFds is the maximum number of descriptors sent in a message.
+const maxPassedFds = 16
+
+// SendSockets sends the sockets, listeners or conns such as those
+// returned by Listen, ListenPacket and Dial, over the unix socket c as
+// SCM_RIGHTS in a single message, for the peer to receive them with
+// ReceiveListeners, ReceiveConns or ReceivePacketConns. The sockets stay
+// open and usable in the sending process, sharing their port and options
+// with the receiver.
+func SendSockets(c *net.UnixConn, socks ...io.Closer) error {
+	if len(socks) == 0 || len(socks) > maxPassedFds {
+		return fmt.Errorf("reuse: cannot send %d sockets, between 1 and %d are sent at once", len(socks), maxPassedFds)
+	}
+	fds := make([]int, 0, len(socks))
+	for _, s := range socks {
+		f, err := ExportFile(s)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fds = append(fds, int(f.Fd()))
+	}
+	oob, err := unixRights(fds...)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.WriteMsgUnix([]byte{byte(len(fds))}, oob, nil)
+	return err
+}
+
+// ReceiveListeners receives the listeners of a message sent by
+// SendSockets on the unix socket c.
+func ReceiveListeners(c *net.UnixConn) ([]net.Listener, error) {
+	files, err := receiveFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	var res []net.Listener
+	for _, f := range files {
+		l, err := net.FileListener(f)
+		if err != nil {
+			for _, l := range res {
+				l.Close()
+			}
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// ReceiveConns receives the conns of a message sent by SendSockets on the
+// unix socket c.
+func ReceiveConns(c *net.UnixConn) ([]net.Conn, error) {
+	files, err := receiveFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	var res []net.Conn
+	for _, f := range files {
+		conn, err := net.FileConn(f)
+		if err != nil {
+			for _, conn := range res {
+				conn.Close()
+			}
+			return nil, err
+		}
+		res = append(res, conn)
+	}
+	return res, nil
+}
+
+// ReceivePacketConns receives the packet conns of a message sent by
+// SendSockets on the unix socket c.
+func ReceivePacketConns(c *net.UnixConn) ([]net.PacketConn, error) {
+	files, err := receiveFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	var res []net.PacketConn
+	for _, f := range files {
+		pc, err := net.FilePacketConn(f)
+		if err != nil {
+			for _, pc := range res {
+				pc.Close()
+			}
+			return nil, err
+		}
+		res = append(res, pc)
+	}
+	return res, nil
+}
+
+// receiveFiles receives the descriptors of a message on c. The net
+// package duplicates them when wrapping them, the files are to be closed.
+func receiveFiles(c *net.UnixConn) ([]*os.File, error) {
+	b := make([]byte, 1)
+	oob := make([]byte, fdsOOBSize(maxPassedFds))
+	_, oobn, _, _, err := c.ReadMsgUnix(b, oob)
+	if err != nil {
+		return nil, err
+	}
+	fds, err := parseUnixRights(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	if len(fds) == 0 {
+		return nil, errors.New("reuse: no descriptors received")
+	}
+	files := make([]*os.File, len(fds))
+	for i, fd := range fds {
+		files[i] = os.NewFile(uintptr(fd), "passed-socket")
+	}
+	return files, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !aix && !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !aix,!linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package reuse
+
+func fdsOOBSize(n int) int {
+	return 0
+}
+
+func unixRights(fds ...int) ([]byte, error) {
+	return nil, unsupportedOption("SCM_RIGHTS")
+}
+
+func parseUnixRights(oob []byte) ([]int, error) {
+	return nil, unsupportedOption("SCM_RIGHTS")
+}
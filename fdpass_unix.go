@@ -0,0 +1,35 @@
+//go:build aix || linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build aix linux darwin dragonfly freebsd netbsd openbsd
+
+package reuse
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func fdsOOBSize(n int) int {
+	return unix.CmsgSpace(n * 4)
+}
+
+func unixRights(fds ...int) ([]byte, error) {
+	return unix.UnixRights(fds...), nil
+}
+
+func parseUnixRights(oob []byte) ([]int, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	for i := range msgs {
+		rights, err := unix.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		for _, fd := range rights {
+			unix.CloseOnExec(fd)
+		}
+		fds = append(fds, rights...)
+	}
+	return fds, nil
+}
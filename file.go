@@ -0,0 +1,111 @@
+package reuse
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// ExportFile returns a duplicate of the descriptor of s, a listener, conn
+// or packet conn such as those returned by Listen, ListenPacket and Dial,
+// to pass it to a child process through exec.Cmd.ExtraFiles or to a
+// library taking raw descriptors. The socket options, port reuse among
+// them, belong to the socket and are kept. Closing the file does not
+// close s.
+func ExportFile(s io.Closer) (*os.File, error) {
+	if l, ok := s.(*listener); ok {
+		s = l.Listener
+	}
+	f, ok := s.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("reuse: cannot export the descriptor of %T", s)
+	}
+	return f.File()
+}
+
+// ListenerFromFile returns a listener for the listening socket f,
+// typically exported by ExportFile, applying opts to it as far as they
+// can be once the socket is bound. The options failing are ignored,
+// except in strict mode. f is not closed.
+func ListenerFromFile(f *os.File, opts ...Option) (net.Listener, error) {
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newConfig(opts)
+	if err := cfg.adopt(l, l.Addr()); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return cfg.listener(l), nil
+}
+
+// ConnFromFile returns a conn for the connected socket f, applying opts
+// to it. see ListenerFromFile
+func ConnFromFile(f *os.File, opts ...Option) (net.Conn, error) {
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newConfig(opts)
+	if err := cfg.adopt(conn, conn.LocalAddr()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return cfg.conn(conn)
+}
+
+// PacketConnFromFile returns a packet conn for the datagram socket f,
+// applying opts to it. see ListenerFromFile
+func PacketConnFromFile(f *os.File, opts ...Option) (net.PacketConn, error) {
+	pc, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newPacketConfig(opts)
+	if err := cfg.adopt(pc, pc.LocalAddr()); err != nil {
+		pc.Close()
+		return nil, err
+	}
+	return cfg.packetConn(pc), nil
+}
+
+// adopt applies the options of c to s, a socket bound to addr created
+// elsewhere. Errors are only returned in strict mode, some options not
+// applying once a socket is bound. The hooks of HookBind are not called
+// and the bind conflicts not checked, the socket being bound already.
+func (c *config) adopt(s interface{}, addr net.Addr) error {
+	sc, ok := s.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err == nil {
+		err = c.controlHooks(adoptedNetwork(addr.Network(), rc), addr.String(), rc)
+	}
+	if c.strict {
+		return err
+	}
+	return nil
+}
+
+// adoptedNetwork returns network, the network of the address of an IP
+// socket, with the suffix of the address family of the socket of rc, as
+// the options differ between IPv4 and IPv6 sockets. An IPv6 socket may
+// have an IPv4-mapped address, telling nothing of its family.
+func adoptedNetwork(network string, rc syscall.RawConn) string {
+	if !tcp(network) && !udp(network) && !ipRaw(network) || ipv6Network(network) || strings.HasSuffix(network, "4") {
+		return network
+	}
+	var suffix string
+	var err error
+	if cerr := rc.Control(func(fd uintptr) {
+		suffix, err = familySuffix(fd)
+	}); cerr != nil || err != nil {
+		return network
+	}
+	return network + suffix
+}
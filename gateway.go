@@ -0,0 +1,98 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrNoGateway is returned when the default gateway of the host cannot be
+// determined.
+var ErrNoGateway = errors.New("reuse: default gateway not found")
+
+// guessGateway returns the first address of the network of the first
+// private IPv4 address of the host, the address home gateways use by
+// convention.
+func guessGateway() (net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || !ipnet.IP.IsPrivate() {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip == nil {
+			continue
+		}
+		gw := ip.Mask(ipnet.Mask)
+		gw[3]++
+		return gw, nil
+	}
+	return nil, ErrNoGateway
+}
+
+const (
+	// gatewayPort is the port of the NAT-PMP and PCP servers of gateways.
+	gatewayPort = 5351
+	// gatewayRTO is the initial retransmission timeout of requests to
+	// gateways, doubled on each retransmission.
+	gatewayRTO = 250 * time.Millisecond
+	// gatewayRetries is the number of requests sent before giving up.
+	gatewayRetries = 9
+)
+
+// gatewayExchange sends the request returned by build, given the local
+// address of the socket, to the port mapping server of gw with
+// retransmissions, until accept returns true or an error for a response,
+// returning timeoutErr if none is accepted.
+func gatewayExchange(ctx context.Context, gw net.IP, build func(laddr *net.UDPAddr) []byte, timeoutErr error, accept func(resp []byte) (bool, error)) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(gw.String(), strconv.Itoa(gatewayPort)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	req := build(conn.LocalAddr().(*net.UDPAddr))
+
+	// Unblock the reads when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buf := make([]byte, 1100)
+	rto := gatewayRTO
+	for i := 0; i < gatewayRetries; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(rto))
+		for {
+			n, err := conn.Read(buf)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			ok, err := accept(buf[:n])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return buf[:n], nil
+			}
+		}
+		rto *= 2
+	}
+	return nil, timeoutErr
+}
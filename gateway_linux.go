@@ -0,0 +1,40 @@
+package reuse
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strings"
+)
+
+// defaultGateway returns the IPv4 gateway of the default route, read from
+// /proc/net/route.
+func defaultGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return guessGateway()
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Iface Destination Gateway Flags ..., in host byte order.
+		fields := strings.Fields(s.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.NativeEndian.PutUint32(ip, binary.BigEndian.Uint32(b))
+		if ip.IsUnspecified() {
+			continue
+		}
+		return ip, nil
+	}
+	return guessGateway()
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+import "net"
+
+// defaultGateway guesses the gateway from the addresses of the host, the
+// routing table not being portably available.
+func defaultGateway() (net.IP, error) {
+	return guessGateway()
+}
@@ -1,5 +1,8 @@
 module github.com/portmapping/go-reuse
 
-go 1.14
+go 1.21
 
-require golang.org/x/sys v0.0.0-20200501145240-bc7a7d42d5c3
+require (
+	golang.org/x/net v0.20.0
+	golang.org/x/sys v0.16.0
+)
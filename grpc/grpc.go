@@ -0,0 +1,51 @@
+// Package grpc provides gRPC helpers built on package reuse, so that
+// gRPC services shard a port across processes and clients pin their
+// source port. It does not depend on google.golang.org/grpc: the
+// listeners are given to grpc.Server.Serve and the dialers to
+// grpc.WithContextDialer.
+//
+//	l, err := reusegrpc.NewGRPCListener(":50051")
+//	...
+//	srv.Serve(l)
+//
+//	conn, err := grpc.Dial(target,
+//		grpc.WithContextDialer(reusegrpc.ContextDialer(":40000")))
+package grpc
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	reuse "github.com/portmapping/go-reuse"
+)
+
+// NewGRPCListener listens on the TCP address with port reuse, for
+// grpc.Server.Serve.
+func NewGRPCListener(address string, opts ...reuse.Option) (net.Listener, error) {
+	return reuse.Listen("tcp", address, opts...)
+}
+
+// ContextDialer returns a dialer for grpc.WithContextDialer connecting
+// from the local address laddr, such as ":40000" to pin the source port,
+// with port reuse. laddr may be empty for an ephemeral port. Addresses of
+// the form "unix:path" or "unix://path" are dialed over unix sockets,
+// which have no port to reuse.
+func ContextDialer(laddr string, opts ...reuse.Option) func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		if strings.HasPrefix(addr, "unix:") {
+			path := strings.TrimPrefix(strings.TrimPrefix(addr, "unix:"), "//")
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		d := &reuse.Dialer{Options: opts}
+		if laddr != "" {
+			la, err := reuse.ResolveAddrContext(ctx, "tcp", laddr, opts...)
+			if err != nil {
+				return nil, err
+			}
+			d.LocalAddr = la
+		}
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
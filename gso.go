@@ -0,0 +1,35 @@
+package reuse
+
+import (
+	"net"
+)
+
+// WriteSegmented writes b to addr as datagrams of segSize bytes, the last
+// one possibly shorter, segmented by the kernel or the NIC (UDP GSO)
+// rather than with one system call per datagram. Linux only.
+func WriteSegmented(c *net.UDPConn, b []byte, addr *net.UDPAddr, segSize int) (int, error) {
+	oob, err := segmentOOB(segSize)
+	if err != nil {
+		return 0, err
+	}
+	n, _, err := c.WriteMsgUDP(b, oob, addr)
+	return n, err
+}
+
+// ReadCoalesced reads into b the datagrams coalesced by the kernel on a
+// socket created with WithUDPGRO, returning the number of bytes read,
+// the size of the coalesced datagrams, the last one possibly shorter, and
+// their source address. segSize is 0 if a single datagram was read.
+// Linux only.
+func ReadCoalesced(c *net.UDPConn, b []byte) (n, segSize int, addr *net.UDPAddr, err error) {
+	if groOOBSize == 0 {
+		return 0, 0, nil, unsupportedOption("UDP_GRO")
+	}
+	oob := make([]byte, groOOBSize)
+	n, oobn, _, addr, err := c.ReadMsgUDP(b, oob)
+	if err != nil {
+		return n, 0, addr, err
+	}
+	segSize, err = parseGRO(oob[:oobn])
+	return n, segSize, addr, err
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+const groOOBSize = 0
+
+func segmentOOB(segSize int) ([]byte, error) {
+	return nil, unsupportedOption("UDP_SEGMENT")
+}
+
+func parseGRO(oob []byte) (int, error) {
+	return 0, unsupportedOption("UDP_GRO")
+}
@@ -0,0 +1,256 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultResolutionDelay is how long a DualStackDialer waits for the
+	// IPv6 addresses once the IPv4 ones are resolved, see RFC 8305
+	// section 3.
+	defaultResolutionDelay = 50 * time.Millisecond
+	// defaultAttemptDelay is the delay between the connection attempts
+	// of a DualStackDialer, see RFC 8305 section 5.
+	defaultAttemptDelay = 250 * time.Millisecond
+)
+
+// DualStackDialer connects to the addresses of a host name racing IPv4
+// and IPv6 attempts, as described by RFC 8305 (Happy Eyeballs v2), while
+// binding each attempt to the local address of its family with port
+// reuse. net.Dialer only races both families when it has no local
+// address, as a single local address cannot serve both.
+//
+// The zero value for each field selects its default.
+type DualStackDialer struct {
+	// LocalAddr4 and LocalAddr6 are the local addresses of the IPv4 and
+	// IPv6 attempts. A nil address dials from an ephemeral port.
+	LocalAddr4 net.Addr
+	LocalAddr6 net.Addr
+
+	// ResolutionDelay is how long to wait for the IPv6 addresses once
+	// the IPv4 ones are resolved before attempting IPv4, 50ms by default.
+	ResolutionDelay time.Duration
+
+	// AttemptDelay is how long to wait for an attempt before starting the
+	// next one in parallel, 250ms by default. A failed attempt starts the
+	// next one right away.
+	AttemptDelay time.Duration
+
+	// Timeout bounds the whole dial, without limit by default.
+	Timeout time.Duration
+
+	// Resolver looks up the host names, by default the resolver of the
+	// WithResolver option or net.DefaultResolver.
+	Resolver *net.Resolver
+
+	// Options are the socket options applied to every attempt.
+	Options []Option
+}
+
+// Dial connects to the address on the named network. see
+// DualStackDialer.DialContext
+func (d *DualStackDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using the
+// provided context. network is "tcp" or "udp", attempting both families,
+// or one of their variants restricted to a family.
+//
+// The addresses are attempted alternating the families, IPv6 first. The
+// first connection established is returned, the others being closed.
+func (d *DualStackDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var want4, want6 bool
+	switch network {
+	case "tcp", "udp":
+		want4, want6 = true, true
+	case "tcp4", "udp4":
+		want4 = true
+	case "tcp6", "udp6":
+		want6 = true
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	base := network[:3]
+
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	r := d.Resolver
+	if r == nil {
+		r = newConfig(d.Options).resolver
+	}
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	port, err := r.LookupPort(ctx, base, service)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	dctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var queue4, queue6 []net.IP
+	lookups := make(chan dualStackLookup, 2)
+	pending := 0
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil && want4 {
+			queue4 = append(queue4, ip)
+		} else if ip.To4() == nil && want6 {
+			queue6 = append(queue6, ip)
+		}
+	} else {
+		for _, fam := range []string{"ip4", "ip6"} {
+			if (fam == "ip4" && !want4) || (fam == "ip6" && !want6) {
+				continue
+			}
+			pending++
+			go func(fam string) {
+				ips, err := r.LookupIP(dctx, fam, host)
+				lookups <- dualStackLookup{ipv6: fam == "ip6", ips: ips, err: err}
+			}(fam)
+		}
+	}
+
+	results := make(chan dualStackAttempt)
+	inflight := 0
+	defer func() {
+		// Close the connections of the attempts that lost the race.
+		go func(n int) {
+			for i := 0; i < n; i++ {
+				if res := <-results; res.conn != nil {
+					res.conn.Close()
+				}
+			}
+		}(inflight)
+	}()
+
+	var (
+		firstErr error
+		timer    *time.Timer
+		timerC   <-chan time.Time
+		prefer6  = true
+		launch   = true
+		// ready is set once attempts may start: the IPv6 addresses are
+		// resolved, or the resolution delay has passed after the IPv4
+		// ones.
+		ready = pending == 0
+	)
+	setTimer := func(delay time.Duration) {
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.NewTimer(delay)
+		timerC = timer.C
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		if ready && launch && len(queue4)+len(queue6) > 0 {
+			var ip net.IP
+			var laddr net.Addr
+			if len(queue6) > 0 && (prefer6 || len(queue4) == 0) {
+				ip, queue6, laddr, prefer6 = queue6[0], queue6[1:], d.LocalAddr6, false
+			} else {
+				ip, queue4, laddr, prefer6 = queue4[0], queue4[1:], d.LocalAddr4, true
+			}
+			inflight++
+			go func() {
+				fam := base + "4"
+				if ip.To4() == nil {
+					fam = base + "6"
+				}
+				dialer := &Dialer{LocalAddr: laddr, Options: d.Options}
+				conn, err := dialer.DialContext(dctx, fam, net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+				results <- dualStackAttempt{conn: conn, err: err}
+			}()
+			launch = false
+			delay := d.AttemptDelay
+			if delay <= 0 {
+				delay = defaultAttemptDelay
+			}
+			setTimer(delay)
+		}
+		if inflight == 0 && pending == 0 && len(queue4)+len(queue6) == 0 {
+			if firstErr == nil {
+				firstErr = &net.DNSError{Err: "no suitable address found", Name: host}
+			}
+			if isDNSError(firstErr) {
+				firstErr = &net.OpError{Op: "dial", Net: network, Err: firstErr}
+			}
+			return nil, firstErr
+		}
+
+		select {
+		case res := <-lookups:
+			pending--
+			if res.err != nil && firstErr == nil {
+				firstErr = res.err
+			}
+			if res.ipv6 {
+				queue6 = append(queue6, res.ips...)
+			} else {
+				queue4 = append(queue4, res.ips...)
+			}
+			if !ready && (res.ipv6 || pending == 0) {
+				ready = true
+				if timer != nil {
+					timer.Stop()
+					timerC = nil
+				}
+			} else if !ready {
+				delay := d.ResolutionDelay
+				if delay <= 0 {
+					delay = defaultResolutionDelay
+				}
+				setTimer(delay)
+			}
+		case <-timerC:
+			timerC = nil
+			ready, launch = true, true
+		case res := <-results:
+			inflight--
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if firstErr == nil || isDNSError(firstErr) {
+				firstErr = res.err
+			}
+			launch = true
+		case <-ctx.Done():
+			return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+		}
+	}
+}
+
+type dualStackLookup struct {
+	ipv6 bool
+	ips  []net.IP
+	err  error
+}
+
+type dualStackAttempt struct {
+	conn net.Conn
+	err  error
+}
+
+// isDNSError reports whether err is a lookup error, which the errors of
+// the connection attempts supersede.
+func isDNSError(err error) bool {
+	_, ok := err.(*net.DNSError)
+	return ok
+}
@@ -0,0 +1,117 @@
+package reuse
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// HookPoint is a point in the lifecycle of a socket at which hooks are
+// called.
+type HookPoint int
+
+const (
+	// HookSocket is once the socket is created, before its options are
+	// set.
+	HookSocket HookPoint = iota
+	// HookBind is before the socket binds its local address, once its
+	// options are set: listening sockets and dialing sockets with a local
+	// address.
+	HookBind
+	// HookConnect is before a dialing socket connects, after HookBind if
+	// it binds.
+	HookConnect
+	// HookAccept is once a connection is accepted, with its remote
+	// address. A connection whose hook fails is closed and not returned
+	// by Accept.
+	HookAccept
+)
+
+// Hook is called at a HookPoint with the network and the address of the
+// socket, as passed to the Control function of a net.Dialer or a
+// net.ListenConfig, so that integrations such as sandboxing, marking or
+// auditing act on the sockets of this package. An error fails the listen
+// or the dial.
+type Hook func(network, address string, c syscall.RawConn) error
+
+type hook struct {
+	point HookPoint
+	fn    Hook
+}
+
+var (
+	hooksMu sync.Mutex
+	// globalHooks is replaced rather than modified, so that the slices
+	// read by the sockets being created stay valid.
+	globalHooks []*hook
+)
+
+// RegisterHook registers h to be called at point for the sockets of every
+// Listen and Dial function, before the hooks of WithHook. The accept
+// hooks only apply to the listeners created once registered. It returns
+// a function unregistering h.
+func RegisterHook(point HookPoint, h Hook) (unregister func()) {
+	e := &hook{point: point, fn: h}
+	hooksMu.Lock()
+	globalHooks = append(globalHooks[:len(globalHooks):len(globalHooks)], e)
+	hooksMu.Unlock()
+
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		hooks := make([]*hook, 0, len(globalHooks))
+		for _, g := range globalHooks {
+			if g != e {
+				hooks = append(hooks, g)
+			}
+		}
+		globalHooks = hooks
+	}
+}
+
+// WithHook adds h to be called at point for the sockets of the call,
+// after the hooks of RegisterHook.
+func WithHook(point HookPoint, h Hook) Option {
+	return func(c *config) {
+		c.hooks = append(c.hooks, &hook{point: point, fn: h})
+	}
+}
+
+// hooksAt returns the registered hooks and the hooks of c for point.
+func (c *config) hooksAt(point HookPoint) []Hook {
+	hooksMu.Lock()
+	global := globalHooks
+	hooksMu.Unlock()
+
+	var fns []Hook
+	for _, hooks := range [][]*hook{global, c.hooks} {
+		for _, h := range hooks {
+			if h.point == point {
+				fns = append(fns, h.fn)
+			}
+		}
+	}
+	return fns
+}
+
+func (c *config) runHooks(point HookPoint, network, address string, rc syscall.RawConn) error {
+	for _, fn := range c.hooksAt(point) {
+		if err := fn(network, address, rc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acceptHook calls the accept hooks of c for conn.
+func (c *config) acceptHook(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return c.runHooks(HookAccept, conn.LocalAddr().Network(), conn.RemoteAddr().String(), rc)
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	reuse "github.com/portmapping/go-reuse"
+)
+
+// ErrTupleInUse is returned by a LocalAddrDialer without fallback when
+// its local address is already connected to the destination.
+var ErrTupleInUse = errors.New("reuse/http: local address already connected to the destination")
+
+// LocalAddrDialer dials the connections of an http.Transport from a fixed
+// local address and port, with port reuse so that other sockets may share
+// it:
+//
+//	d := &reusehttp.LocalAddrDialer{LocalAddr: "192.0.2.1:40000"}
+//	client := &http.Client{Transport: &http.Transport{DialContext: d.DialContext}}
+//
+// Two connections from the same address to the same destination would
+// share their 4-tuple, which the kernel refuses, as it does while a
+// closed connection lingers in TIME_WAIT. The transport opening
+// connections concurrently, a LocalAddrDialer dials a single connection
+// per destination from LocalAddr and the others from an ephemeral port of
+// the same IP address, unless NoFallback is set.
+type LocalAddrDialer struct {
+	// LocalAddr is the local address and port, such as "192.0.2.1:40000"
+	// or ":40000".
+	LocalAddr string
+
+	// Options are the socket options of the connections.
+	Options []reuse.Option
+
+	// NoFallback makes the dials fail with ErrTupleInUse rather than
+	// use an ephemeral port.
+	NoFallback bool
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// DialContext returns a function dialing from laddr for the DialContext
+// field of http.Transport. see LocalAddrDialer
+func DialContext(laddr string, opts ...reuse.Option) func(ctx context.Context, network, address string) (net.Conn, error) {
+	d := &LocalAddrDialer{LocalAddr: laddr, Options: opts}
+	return d.DialContext
+}
+
+// DialContext connects to address in network, a TCP network, from the
+// local address of d.
+func (d *LocalAddrDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	la, err := reuse.ResolveAddrContext(ctx, network, d.LocalAddr, d.Options...)
+	if err != nil {
+		return nil, err
+	}
+	tla, ok := la.(*net.TCPAddr)
+	if !ok {
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	key := network + " " + address
+	if d.acquire(key) {
+		conn, err := d.dial(ctx, network, address, tla)
+		if err == nil {
+			return &trackedConn{Conn: conn, release: func() { d.release(key) }}, nil
+		}
+		d.release(key)
+		if !errors.Is(err, errAddrNotAvail) && !errors.Is(err, errAddrInUse) {
+			return nil, err
+		}
+	}
+	if d.NoFallback {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: la, Err: ErrTupleInUse}
+	}
+	return d.dial(ctx, network, address, &net.TCPAddr{IP: tla.IP, Zone: tla.Zone})
+}
+
+func (d *LocalAddrDialer) dial(ctx context.Context, network, address string, laddr *net.TCPAddr) (net.Conn, error) {
+	rd := &reuse.Dialer{LocalAddr: laddr, Options: d.Options}
+	return rd.DialContext(ctx, network, address)
+}
+
+// acquire reserves the local address for the destination key, reporting
+// whether it was free.
+func (d *LocalAddrDialer) acquire(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.active == nil {
+		d.active = make(map[string]bool)
+	}
+	if d.active[key] {
+		return false
+	}
+	d.active[key] = true
+	return true
+}
+
+func (d *LocalAddrDialer) release(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.active, key)
+}
+
+// trackedConn releases the local address for its destination once
+// closed.
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,12 @@
+//go:build !plan9
+// +build !plan9
+
+package http
+
+import "syscall"
+
+// The errors of connect when the 4-tuple of a connection is in use.
+var (
+	errAddrInUse    error = syscall.EADDRINUSE
+	errAddrNotAvail error = syscall.EADDRNOTAVAIL
+)
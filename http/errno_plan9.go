@@ -0,0 +1,10 @@
+package http
+
+import "errors"
+
+// Plan 9 reports the failures of the system calls as strings, which are
+// not classified.
+var (
+	errAddrInUse    = errors.New("address in use")
+	errAddrNotAvail = errors.New("address not available")
+)
@@ -0,0 +1,51 @@
+// Package http provides net/http helpers listening through package reuse,
+// so that several instances of an HTTP service bind the same port and a
+// new version can be started before the old one is stopped.
+package http
+
+import (
+	"net/http"
+
+	reuse "github.com/portmapping/go-reuse"
+)
+
+// ListenAndServe listens on the TCP address addr with port reuse and
+// serves HTTP requests with handler. see net/http.ListenAndServe
+func ListenAndServe(addr string, handler http.Handler, opts ...reuse.Option) error {
+	return ListenAndServeServer(&http.Server{Addr: addr, Handler: handler}, opts...)
+}
+
+// ListenAndServeTLS is like ListenAndServe but serves HTTPS requests. see
+// net/http.ListenAndServeTLS
+func ListenAndServeTLS(addr, certFile, keyFile string, handler http.Handler, opts ...reuse.Option) error {
+	return ListenAndServeServerTLS(&http.Server{Addr: addr, Handler: handler}, certFile, keyFile, opts...)
+}
+
+// ListenAndServeServer listens on srv.Addr with port reuse and serves
+// HTTP requests with srv, which can then be shut down gracefully. see
+// net/http.Server.ListenAndServe
+func ListenAndServeServer(srv *http.Server, opts ...reuse.Option) error {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	l, err := reuse.Listen("tcp", addr, opts...)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+// ListenAndServeServerTLS is like ListenAndServeServer but serves HTTPS
+// requests. see net/http.Server.ListenAndServeTLS
+func ListenAndServeServerTLS(srv *http.Server, certFile, keyFile string, opts ...reuse.Option) error {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+	l, err := reuse.Listen("tcp", addr, opts...)
+	if err != nil {
+		return err
+	}
+	return srv.ServeTLS(l, certFile, keyFile)
+}
@@ -0,0 +1,31 @@
+package reuse
+
+import (
+	"net"
+	"strings"
+)
+
+// ListenICMP listens for ICMP messages on address with the options of
+// opts, so that tools such as ping and traceroute share their sockets
+// across processes.
+//
+// For the non-privileged datagram sockets of Linux, network is "udp4" or
+// "udp6" and address an IP address or a host name. The messages are read
+// and written without IP header through a *net.UDPConn, the port of whose
+// addresses is the echo identifier. The sockets are available to the
+// groups of the net.ipv4.ping_group_range sysctl.
+//
+// For the privileged raw sockets, network is "ip4" or "ip6" followed by a
+// colon and an ICMP protocol number or name, such as "ip4:icmp" or
+// "ip6:ipv6-icmp", and address an IP address. The messages are read
+// without IP header, and written without one unless WithHeaderIncluded
+// is set. see ListenPacket
+func ListenICMP(network, address string, opts ...Option) (net.PacketConn, error) {
+	switch {
+	case network == "udp4" || network == "udp6":
+		return newPacketConfig(opts).listenICMPDatagram(network, address)
+	case strings.HasPrefix(network, "ip4:") || strings.HasPrefix(network, "ip6:"):
+		return ListenPacket(network, address, opts...)
+	}
+	return nil, net.UnknownNetworkError(network)
+}
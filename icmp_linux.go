@@ -0,0 +1,103 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func (c *config) listenICMPDatagram(network, address string) (net.PacketConn, error) {
+	family, proto, ipnet := unix.AF_INET, unix.IPPROTO_ICMP, "ip4"
+	if network == "udp6" {
+		family, proto, ipnet = unix.AF_INET6, unix.IPPROTO_ICMPV6, "ip6"
+	}
+	a, err := c.resolveAddr(context.Background(), ipnet, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+	laddr := a.(*net.IPAddr)
+
+	s, err := unix.Socket(family, unix.SOCK_DGRAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Addr: laddr, Err: os.NewSyscallError("socket", err)}
+	}
+	f := os.NewFile(uintptr(s), "icmp")
+	defer f.Close()
+	rc, err := f.SyscallConn()
+	if err == nil {
+		// The socket is named after its protocol rather than UDP, whose
+		// options do not apply.
+		err = c.control("icmp"+ipnet[2:], address, rc)
+	}
+	if err == nil {
+		err = sockControl(f, func(fd uintptr) error {
+			port := 0
+			if c.icmpEchoID != nil {
+				port = int(*c.icmpEchoID)
+			}
+			var sa unix.Sockaddr
+			if family == unix.AF_INET {
+				sa4 := &unix.SockaddrInet4{Port: port}
+				copy(sa4.Addr[:], laddr.IP.To4())
+				sa = sa4
+			} else {
+				zone, err := zoneIndex(laddr.Zone)
+				if err != nil {
+					return err
+				}
+				sa6 := &unix.SockaddrInet6{Port: port, ZoneId: zone}
+				copy(sa6.Addr[:], laddr.IP.To16())
+				sa = sa6
+			}
+			return os.NewSyscallError("bind", unix.Bind(int(fd), sa))
+		})
+	}
+	if err != nil {
+		return nil, classify(&net.OpError{Op: "listen", Net: network, Addr: laddr, Err: err})
+	}
+	return net.FilePacketConn(f)
+}
+
+// ICMP echo reply types.
+const (
+	icmpEchoReply   = 0
+	icmpv6EchoReply = 129
+)
+
+// attachICMPEchoFilter attaches a program to the raw socket fd dropping the
+// ICMP echo replies whose identifier is not id. The sockets of another
+// protocol are left as is.
+func attachICMPEchoFilter(fd int, id uint16) error {
+	proto, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_PROTOCOL)
+	if err != nil {
+		return err
+	}
+	// X is the offset of the message: past the header on IPv4 sockets,
+	// which read it, and 0 on IPv6 sockets.
+	var loadOffset unix.SockFilter
+	var reply uint32
+	switch proto {
+	case unix.IPPROTO_ICMP:
+		loadOffset, reply = unix.SockFilter{Code: unix.BPF_LDX | unix.BPF_B | unix.BPF_MSH, K: 0}, icmpEchoReply
+	case unix.IPPROTO_ICMPV6:
+		loadOffset, reply = unix.SockFilter{Code: unix.BPF_LDX | unix.BPF_IMM, K: 0}, icmpv6EchoReply
+	default:
+		return nil
+	}
+	filter := []unix.SockFilter{
+		loadOffset,
+		{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_IND, K: 0},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: reply, Jt: 0, Jf: 3},
+		{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_IND, K: 4},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: uint32(id), Jt: 1, Jf: 0},
+		{Code: unix.BPF_RET | unix.BPF_K, K: 0},
+		{Code: unix.BPF_RET | unix.BPF_K, K: 0xffffffff},
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	return unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+import (
+	"net"
+)
+
+func (c *config) listenICMPDatagram(network, address string) (net.PacketConn, error) {
+	return nil, &net.OpError{Op: "listen", Net: network, Err: unsupportedOption("ICMP datagram socket")}
+}
@@ -0,0 +1,143 @@
+package reuse
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ifaceNamesTTL is how long the names of the interfaces are kept to tell
+// the hosts naming an interface from the host names.
+const ifaceNamesTTL = time.Second
+
+// ifaceNames caches the names of the network interfaces, so that the
+// hosts of the addresses are not each checked by listing the interfaces.
+var ifaceNames struct {
+	sync.Mutex
+	names   map[string]bool
+	expires time.Time
+}
+
+// interfaceAddress returns address with its host replaced by an address
+// of a network interface for network: the interface named by the host or,
+// with the WithInterface option, that interface if the host is empty or
+// unspecified. The other addresses are returned as is.
+func (c *config) interfaceAddress(network, address string) (string, error) {
+	base := network
+	if i := strings.IndexByte(network, ':'); i >= 0 && ipRaw(network) {
+		base = network[:i]
+	}
+	if !tcp(base) && !udp(base) && !ipRaw(base) {
+		return address, nil
+	}
+
+	host, port := address, ""
+	if !ipRaw(base) {
+		if address == "" {
+			port = "0"
+		} else if h, p, err := net.SplitHostPort(address); err == nil {
+			host, port = h, p
+		} else {
+			// Left for the resolver to report.
+			return address, nil
+		}
+	}
+
+	var name string
+	family := base
+	switch ip := net.ParseIP(host); {
+	case host == "" || ip != nil && ip.IsUnspecified():
+		if c.iface == "" {
+			return address, nil
+		}
+		// An unspecified address of a family selects the addresses of
+		// that family on the networks without suffix.
+		if ip != nil && !strings.HasSuffix(base, "4") && !strings.HasSuffix(base, "6") {
+			if ip.To4() != nil {
+				family += "4"
+			} else {
+				family += "6"
+			}
+		}
+		name = c.iface
+	case ip == nil && !strings.Contains(host, "%"):
+		if !isInterfaceName(host) {
+			return address, nil
+		}
+		name = host
+	default:
+		return address, nil
+	}
+
+	ip, zone, err := c.interfaceIP(family, name)
+	if err != nil {
+		return "", err
+	}
+	host = ip.String()
+	if zone != "" {
+		host += "%" + zone
+	}
+	if ipRaw(base) {
+		return host, nil
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// interfaceIP returns the address for network of the interface named
+// name, along with its zone if it is an IPv6 link-local address. The
+// addresses of the family preferred by the WithPreferIPv6 option come
+// first, then those that are not link-local.
+func (c *config) interfaceIP(network, name string) (net.IP, string, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, "", &net.AddrError{Err: "no such network interface", Addr: name}
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, "", err
+	}
+	var best net.IP
+	rank := -1
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || !familyMatch(network, ipnet.IP) || ipnet.IP.IsMulticast() || ipnet.IP.IsUnspecified() {
+			continue
+		}
+		r := 0
+		if (ipnet.IP.To4() == nil) == c.preferIPv6 {
+			r += 2
+		}
+		if !ipnet.IP.IsLinkLocalUnicast() {
+			r++
+		}
+		if r > rank {
+			best, rank = ipnet.IP, r
+		}
+	}
+	if best == nil {
+		return nil, "", &net.AddrError{Err: "no suitable address on interface", Addr: name}
+	}
+	if best.To4() == nil && best.IsLinkLocalUnicast() {
+		return best, ifi.Name, nil
+	}
+	return best, "", nil
+}
+
+// isInterfaceName reports whether host is the name of a network interface.
+func isInterfaceName(host string) bool {
+	ifaceNames.Lock()
+	defer ifaceNames.Unlock()
+	if now := time.Now(); now.After(ifaceNames.expires) {
+		ifs, err := net.Interfaces()
+		if err != nil {
+			return false
+		}
+		ifaceNames.names = make(map[string]bool, len(ifs))
+		for _, ifi := range ifs {
+			ifaceNames.names[ifi.Name] = true
+		}
+		ifaceNames.expires = now.Add(ifaceNamesTTL)
+	}
+	return ifaceNames.names[host]
+}
@@ -0,0 +1,189 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+)
+
+// defaultInterfaceInterval is how often an InterfaceListenConfig checks
+// the addresses of the interfaces.
+const defaultInterfaceInterval = 5 * time.Second
+
+// InterfaceEvent describes a listener added or removed by the listener of
+// an InterfaceListenConfig.
+type InterfaceEvent struct {
+	// Interface is the name of the interface of the address.
+	Interface string
+	// Addr is the local address listened on, nil if Err is set.
+	Addr net.Addr
+	// Up reports whether the listener was added, as the address appeared,
+	// or removed, as it disappeared.
+	Up bool
+	// Err is the error listening on the address failed with, the address
+	// being tried again at the next check.
+	Err error
+}
+
+// InterfaceListenConfig listens on a port with a listener per unicast
+// address of the network interfaces, adding and removing listeners as
+// the addresses come and go, so that a service follows the interfaces
+// of a host without binding the wildcard address:
+//
+//	lc := &reuse.InterfaceListenConfig{Port: 8080, OnChange: logChange}
+//	l, err := lc.Listen(ctx)
+//
+// The zero value for each field selects its default.
+type InterfaceListenConfig struct {
+	// Network is the TCP network listened on, "tcp" by default.
+	Network string
+
+	// Port is the port listened on. A port of 0 selects the ephemeral
+	// port of the first listener for all of them.
+	Port int
+
+	// Match selects the interfaces listened on, all the interfaces up by
+	// default.
+	Match func(net.Interface) bool
+
+	// Interval is how often the addresses of the interfaces are checked,
+	// 5s by default.
+	Interval time.Duration
+
+	// Monitor, if set, has the addresses checked as it reports changes
+	// rather than every Interval.
+	Monitor *NetworkMonitor
+
+	// OnChange is called as the listeners are added and removed, and as
+	// adding one fails.
+	OnChange func(InterfaceEvent)
+
+	// Options are the socket options of the listeners.
+	Options []Option
+}
+
+// Listen listens on the addresses of the interfaces, returning their
+// aggregate listener. The listeners follow the interfaces until it is
+// closed. ctx only bounds the initial listeners, which fail the call if
+// one of them fails.
+func (lc *InterfaceListenConfig) Listen(ctx context.Context) (*MultiListener, error) {
+	network := lc.Network
+	if network == "" {
+		network = "tcp"
+	}
+	if !tcp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	w := &ifaceWatcher{
+		lc:      lc,
+		network: network,
+		port:    lc.Port,
+		cfg:     newConfig(lc.Options),
+		m:       newMultiListener(network),
+		bound:   make(map[ifaceAddr]net.Listener),
+	}
+	if err := w.sync(ctx, true); err != nil {
+		w.m.Close()
+		return nil, err
+	}
+	go w.run()
+	return w.m, nil
+}
+
+// ifaceWatcher adds and removes the listeners of an InterfaceListenConfig.
+type ifaceWatcher struct {
+	lc      *InterfaceListenConfig
+	network string
+	port    int
+	cfg     *config
+	m       *MultiListener
+	bound   map[ifaceAddr]net.Listener
+}
+
+func (w *ifaceWatcher) run() {
+	if w.lc.Monitor != nil {
+		changed := make(chan struct{}, 1)
+		unsubscribe := w.lc.Monitor.Subscribe(func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+		defer unsubscribe()
+		for {
+			select {
+			case <-changed:
+				w.sync(context.Background(), false)
+			case <-w.m.done:
+				return
+			}
+		}
+	}
+
+	interval := w.lc.Interval
+	if interval <= 0 {
+		interval = defaultInterfaceInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.sync(context.Background(), false)
+		case <-w.m.done:
+			return
+		}
+	}
+}
+
+// sync listens on the addresses of the interfaces not listened on yet and
+// closes the listeners of the addresses gone. With initial set, the first
+// error is returned.
+func (w *ifaceWatcher) sync(ctx context.Context, initial bool) error {
+	addrs, err := interfaceAddrs(w.network, w.lc.Match)
+	if err != nil {
+		if initial {
+			return &net.OpError{Op: "listen", Net: w.network, Err: err}
+		}
+		return nil
+	}
+	current := make(map[ifaceAddr]bool, len(addrs))
+	for _, a := range addrs {
+		current[a] = true
+	}
+	for a, l := range w.bound {
+		if !current[a] {
+			addr := l.Addr()
+			w.m.remove(l)
+			delete(w.bound, a)
+			w.notify(InterfaceEvent{Interface: a.iface, Addr: addr})
+		}
+	}
+	for _, a := range addrs {
+		if _, ok := w.bound[a]; ok {
+			continue
+		}
+		l, err := w.cfg.listen(ctx, w.network, net.JoinHostPort(a.addr, strconv.Itoa(w.port)))
+		if err != nil {
+			if initial {
+				return err
+			}
+			w.notify(InterfaceEvent{Interface: a.iface, Err: err})
+			continue
+		}
+		if ta, ok := l.Addr().(*net.TCPAddr); ok && w.port == 0 {
+			w.port = ta.Port
+		}
+		w.bound[a] = l
+		w.m.add(l)
+		w.notify(InterfaceEvent{Interface: a.iface, Addr: l.Addr(), Up: true})
+	}
+	return nil
+}
+
+func (w *ifaceWatcher) notify(ev InterfaceEvent) {
+	if w.lc.OnChange != nil {
+		w.lc.OnChange(ev)
+	}
+}
@@ -13,8 +13,11 @@
 //  l2, _ := greuse.Listen("tcp", "127.0.0.1:1235")
 //  c, _ := greuse.Dial("tcp", "127.0.0.1:1234", "127.0.0.1:1235")
 //
+//  // tune the socket options per call.
+//  l3, _ := greuse.Listen("tcp", "127.0.0.1:1236", greuse.WithReuseAddr(false), greuse.WithRcvBuf(1<<20))
+//
 // Note: can't dial self because tcp/ip stacks use 4-tuples to identify connections,
-// and doing so would clash.
+// and doing so would clash. Dial returns ErrDialSelf instead.
 package reuse
 
 import (
@@ -27,197 +30,282 @@ import (
 
 var (
 	// Enabled returns whether or not SO_REUSEPORT or equivalent behaviour is
-	// enabled in the OS.
-	Enabled      = false
-	listenConfig = net.ListenConfig{
-		Control: Control,
-	}
+	// enabled in the OS. See Probe for the options available on the
+	// running kernel.
+	Enabled = false
 )
 
 // Listen listens at the given network and address. see net.Listen
 // Returns a net.Listener created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func Listen(network, address string) (net.Listener, error) {
-	return listenConfig.Listen(context.Background(), network, address)
+func Listen(network, address string, opts ...Option) (net.Listener, error) {
+	return ListenContext(context.Background(), network, address, opts...)
+}
+
+// ListenContext listens at the given network and address using the provided
+// context. see net.ListenConfig.Listen
+// Returns a net.Listener created from a file discriptor for a socket
+// with SO_REUSEPORT and SO_REUSEADDR option set.
+func ListenContext(ctx context.Context, network, address string, opts ...Option) (net.Listener, error) {
+	return newConfig(opts).listen(ctx, network, address)
 }
 
 // ListenTLS listens at the given network and address. see net.Listen
 // Returns a net.Listener created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func ListenTLS(network, address string, config *tls.Config) (net.Listener, error) {
-	listen, err := listenConfig.Listen(context.Background(), network, address)
+func ListenTLS(network, address string, config *tls.Config, opts ...Option) (net.Listener, error) {
+	listen, err := ListenContext(context.Background(), network, address, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return tls.NewListener(listen, config), nil
 }
 
-// ListenTCP listens at the given network and address. see net.Listen
-// Returns a net.Listener created from a file discriptor for a socket
-// with SO_REUSEPORT and SO_REUSEADDR option set.
-func ListenTCP(network string, laddr *net.TCPAddr) (*net.TCPListener, error) {
-	t, err := net.ListenTCP(network, laddr)
-	if err != nil {
-		return nil, err
+// ListenTCP listens at the given network and address. see net.ListenTCP
+// Returns a *net.TCPListener created from a file discriptor for a socket
+// with SO_REUSEPORT and SO_REUSEADDR option set before it is bound. The
+// options applying to the accepted connections, such as WithNoDelay or
+// WithProxyProtocol, need the listener of Listen.
+func ListenTCP(network string, laddr *net.TCPAddr, opts ...Option) (*net.TCPListener, error) {
+	if !tcp(network) {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	address := ""
+	if laddr != nil {
+		address = laddr.String()
 	}
-	conn, err := t.SyscallConn()
+	l, err := newConfig(opts).listenConfig().Listen(context.Background(), network, address)
 	if err != nil {
-		return nil, err
+		return nil, classify(err)
 	}
-	err = Control(network, "", conn)
-	return t, err
+	return l.(*net.TCPListener), nil
 }
 
-// ListenIP listens at the given network and address. see net.Listen
-// Returns a net.Listener created from a file discriptor for a socket
-// with SO_REUSEPORT and SO_REUSEADDR option set.
-func ListenIP(network string, laddr *net.IPAddr) (*net.IPConn, error) {
-	i, err := net.ListenIP(network, laddr)
-	if err != nil {
-		return nil, err
+// ListenIP listens at the given network and address. see net.ListenIP
+// Returns a *net.IPConn created from a file discriptor for a socket
+// with SO_REUSEPORT and SO_REUSEADDR option set before it is bound.
+func ListenIP(network string, laddr *net.IPAddr, opts ...Option) (*net.IPConn, error) {
+	if !ipRaw(network) {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	address := ""
+	if laddr != nil {
+		address = laddr.String()
 	}
-	conn, err := i.SyscallConn()
+	pc, err := newPacketConfig(opts).listenConfig().ListenPacket(context.Background(), network, address)
 	if err != nil {
-		return nil, err
+		return nil, classify(err)
 	}
-	err = Control(network, "", conn)
-	return i, err
+	return pc.(*net.IPConn), nil
 }
 
-// ListenUnix listens at the given network and address. see net.Listen
-// Returns a net.Listener created from a file discriptor for a socket
-// with SO_REUSEPORT and SO_REUSEADDR option set.
-func ListenUnix(network string, laddr *net.UnixAddr) (*net.UnixListener, error) {
-	u, err := net.ListenUnix(network, laddr)
-	if err != nil {
-		return nil, err
+// ListenUnix listens at the given network and address. see net.ListenUnix
+// Returns a *net.UnixListener created from a file discriptor for a socket
+// with SO_REUSEPORT and SO_REUSEADDR option set before it is bound.
+func ListenUnix(network string, laddr *net.UnixAddr, opts ...Option) (*net.UnixListener, error) {
+	if network != "unix" && network != "unixpacket" {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	cfg := newConfig(opts)
+	address := ""
+	if laddr != nil {
+		if err := cfg.removeStaleSocket(network, laddr.Name); err != nil {
+			return nil, &net.OpError{Op: "listen", Net: network, Addr: laddr, Err: err}
+		}
+		address = laddr.Name
 	}
-	conn, err := u.SyscallConn()
+	l, err := cfg.listenConfig().Listen(context.Background(), network, address)
 	if err != nil {
-		return nil, err
+		return nil, classify(err)
 	}
-	err = Control(network, "", conn)
-	return u, err
+	return l.(*net.UnixListener), nil
 }
 
 // ListenPacket listens at the given network and address. see net.ListenPacket
 // Returns a net.Listener created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func ListenPacket(network, address string) (net.PacketConn, error) {
-	return listenConfig.ListenPacket(context.Background(), network, address)
+func ListenPacket(network, address string, opts ...Option) (net.PacketConn, error) {
+	return ListenPacketContext(context.Background(), network, address, opts...)
+}
+
+// ListenPacketContext listens at the given network and address using the
+// provided context. see net.ListenConfig.ListenPacket
+// Returns a net.PacketConn created from a file discriptor for a socket
+// with SO_REUSEPORT and SO_REUSEADDR option set.
+func ListenPacketContext(ctx context.Context, network, address string, opts ...Option) (net.PacketConn, error) {
+	cfg := newPacketConfig(opts)
+	return cfg.listenPacketWith(ctx, cfg.listenConfig(), network, address)
 }
 
 // DialTimeOut dials the given network and address. see net.Dialer.Dial
 // Returns a net.Conn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func DialTimeOut(network, laddr, raddr string, timeout time.Duration) (net.Conn, error) {
-	nla, err := ResolveAddr(network, laddr)
-	if err != nil {
-		return nil, fmt.Errorf("resolving local addr: %w", err)
+func DialTimeOut(network, laddr, raddr string, timeout time.Duration, opts ...Option) (net.Conn, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: nla,
-		Timeout:   timeout,
+	cfg := newConfig(opts)
+	nla, err := cfg.resolveAddr(ctx, network, laddr)
+	if err != nil {
+		return nil, fmt.Errorf("resolving local addr: %w", err)
 	}
+	d := cfg.dialer(nla)
+	d.Timeout = timeout
 
-	return d.Dial(network, raddr)
+	return cfg.dial(ctx, d, network, raddr)
 }
 
 // Dial dials the given network and address. see net.Dialer.Dial
 // Returns a net.Conn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func Dial(network, laddr, raddr string) (net.Conn, error) {
-	nla, err := ResolveAddr(network, laddr)
+func Dial(network, laddr, raddr string, opts ...Option) (net.Conn, error) {
+	return DialContext(context.Background(), network, laddr, raddr, opts...)
+}
+
+// DialContext dials the given network and address using the provided
+// context. see net.Dialer.DialContext
+// Returns a net.Conn created from a file discriptor for a socket
+// with SO_REUSEPORT and SO_REUSEADDR option set.
+func DialContext(ctx context.Context, network, laddr, raddr string, opts ...Option) (net.Conn, error) {
+	cfg := newConfig(opts)
+	nla, err := cfg.resolveAddr(ctx, network, laddr)
 	if err != nil {
 		return nil, fmt.Errorf("resolving local addr: %w", err)
 	}
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: nla,
-	}
-	return d.Dial(network, raddr)
+	d := cfg.dialer(nla)
+	return cfg.dial(ctx, d, network, raddr)
 }
 
 // DialTLS dials the given network and address. see net.Dialer.Dial
 // Returns a net.Conn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func DialTLS(network, laddr, raddr string, config *tls.Config) (net.Conn, error) {
-	nla, err := ResolveAddr(network, laddr)
+func DialTLS(network, laddr, raddr string, config *tls.Config, opts ...Option) (net.Conn, error) {
+	nla, err := ResolveAddr(network, laddr, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("resolving local addr: %w", err)
 	}
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: nla,
+	cfg := newConfig(opts)
+	d := cfg.dialer(nla)
+	conn, err := cfg.dial(context.Background(), d, network, raddr)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(raddr)
+		if err != nil {
+			host = raddr
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+	tc := tls.Client(conn, config)
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
 	}
-	return tls.DialWithDialer(&d, network, raddr, config)
+	return tc, nil
 }
 
-// DialTCP dials the given network and tcp address. see net.Dialer.Dial
-// Returns a net.Conn created from a file discriptor for a socket
+// DialTCP dials the given network and tcp address. see net.DialTCP
+// Returns a *net.TCPConn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func DialTCP(network string, laddr *net.TCPAddr, raddr *net.TCPAddr) (net.Conn, error) {
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: laddr,
+func DialTCP(network string, laddr *net.TCPAddr, raddr *net.TCPAddr, opts ...Option) (*net.TCPConn, error) {
+	if !tcp(network) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	cfg := newConfig(opts)
+	var la net.Addr
+	if laddr != nil {
+		la = laddr
+	}
+	d := cfg.dialer(la)
+	conn, err := cfg.dial(context.Background(), d, network, raddr.String())
+	if err != nil {
+		return nil, err
 	}
-	return d.Dial(network, raddr.String())
+	return conn.(*net.TCPConn), nil
 }
 
 // DialAddr dials the given network and address. see net.Dialer.Dial
 // Returns a net.Conn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func DialAddr(network string, laddr net.Addr, raddr net.Addr) (net.Conn, error) {
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: laddr,
-	}
-	return d.Dial(network, raddr.String())
+func DialAddr(network string, laddr net.Addr, raddr net.Addr, opts ...Option) (net.Conn, error) {
+	cfg := newConfig(opts)
+	d := cfg.dialer(laddr)
+	return cfg.dial(context.Background(), d, network, raddr.String())
 }
 
-// DialIP dials the given network and ip address. see net.Dialer.Dial
-// Returns a net.Conn created from a file discriptor for a socket
+// DialIP dials the given network and ip address. see net.DialIP
+// Returns a *net.IPConn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func DialIP(network string, laddr *net.IPAddr, raddr *net.IPAddr) (net.Conn, error) {
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: laddr,
+func DialIP(network string, laddr *net.IPAddr, raddr *net.IPAddr, opts ...Option) (*net.IPConn, error) {
+	if !ipRaw(network) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
 	}
-	return d.Dial(network, raddr.String())
+	cfg := newConfig(opts)
+	var la net.Addr
+	if laddr != nil {
+		la = laddr
+	}
+	d := cfg.dialer(la)
+	conn, err := cfg.dial(context.Background(), d, network, raddr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.IPConn), nil
 }
 
-// DialUDP dials the given network and udp address. see net.Dialer.Dial
-// Returns a net.Conn created from a file discriptor for a socket
+// DialUDP dials the given network and udp address. see net.DialUDP
+// Returns a *net.UDPConn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func DialUDP(network string, laddr *net.UDPAddr, raddr *net.UDPAddr) (net.Conn, error) {
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: laddr,
-	}
-	return d.Dial(network, raddr.String())
+func DialUDP(network string, laddr *net.UDPAddr, raddr *net.UDPAddr, opts ...Option) (*net.UDPConn, error) {
+	return DialTimeOutUDP(network, laddr, raddr, 0, opts...)
 }
 
-// DialTimeOutUDP dials the given network and udp address. see net.Dialer.Dial
-// Returns a net.Conn created from a file discriptor for a socket
+// DialTimeOutUDP dials the given network and udp address. see net.DialUDP
+// Returns a *net.UDPConn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func DialTimeOutUDP(network string, laddr *net.UDPAddr, raddr *net.UDPAddr, timeout time.Duration) (net.Conn, error) {
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: laddr,
-		Timeout:   timeout,
+func DialTimeOutUDP(network string, laddr *net.UDPAddr, raddr *net.UDPAddr, timeout time.Duration, opts ...Option) (*net.UDPConn, error) {
+	if !udp(network) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	cfg := newConfig(opts)
+	var la net.Addr
+	if laddr != nil {
+		la = laddr
 	}
-	return d.Dial(network, raddr.String())
+	d := cfg.dialer(la)
+	d.Timeout = timeout
+	conn, err := cfg.dial(context.Background(), d, network, raddr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
 }
 
-// DialUnix dials the given network and unix address. see net.Dialer.Dial
-// Returns a net.Conn created from a file discriptor for a socket
+// DialUnix dials the given network and unix address. see net.DialUnix
+// Returns a *net.UnixConn created from a file discriptor for a socket
 // with SO_REUSEPORT and SO_REUSEADDR option set.
-func DialUnix(network string, laddr *net.UnixAddr, raddr *net.UnixAddr) (net.Conn, error) {
-	d := net.Dialer{
-		Control:   Control,
-		LocalAddr: laddr,
+func DialUnix(network string, laddr *net.UnixAddr, raddr *net.UnixAddr, opts ...Option) (*net.UnixConn, error) {
+	if !unixSocket(network) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	cfg := newConfig(opts)
+	var la net.Addr
+	if laddr != nil {
+		la = laddr
+	}
+	d := cfg.dialer(la)
+	conn, err := cfg.dial(context.Background(), d, network, raddr.String())
+	if err != nil {
+		return nil, err
 	}
-	return d.Dial(network, raddr.String())
+	return conn.(*net.UnixConn), nil
 }
@@ -0,0 +1,43 @@
+package reuse
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestDialMismatchedNetwork(t *testing.T) {
+	tcpAddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	udpAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	ipAddr := &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	unixAddr := &net.UnixAddr{Name: "/nonexistent", Net: "unix"}
+
+	tests := []struct {
+		name string
+		dial func() (net.Conn, error)
+	}{
+		{name: "DialTCP udp", dial: func() (net.Conn, error) { return DialTCP("udp", nil, tcpAddr) }},
+		{name: "DialTCP unix", dial: func() (net.Conn, error) { return DialTCP("unix", nil, tcpAddr) }},
+		{name: "DialUDP tcp", dial: func() (net.Conn, error) { return DialUDP("tcp", nil, udpAddr) }},
+		{name: "DialUDP ip4:icmp", dial: func() (net.Conn, error) { return DialUDP("ip4:icmp", nil, udpAddr) }},
+		{name: "DialTimeOutUDP tcp", dial: func() (net.Conn, error) { return DialTimeOutUDP("tcp", nil, udpAddr, 0) }},
+		{name: "DialIP udp", dial: func() (net.Conn, error) { return DialIP("udp", nil, ipAddr) }},
+		{name: "DialIP tcp", dial: func() (net.Conn, error) { return DialIP("tcp", nil, ipAddr) }},
+		{name: "DialUnix tcp", dial: func() (net.Conn, error) { return DialUnix("tcp", nil, unixAddr) }},
+		{name: "DialUnix udp", dial: func() (net.Conn, error) { return DialUnix("udp", nil, unixAddr) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := tt.dial()
+			if err == nil {
+				conn.Close()
+				t.Fatal("dial succeeded")
+			}
+			var oe *net.OpError
+			var une net.UnknownNetworkError
+			if !errors.As(err, &oe) || oe.Op != "dial" || !errors.As(err, &une) {
+				t.Errorf("dial error = %v, want an unknown network dial error", err)
+			}
+		})
+	}
+}
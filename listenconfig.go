@@ -0,0 +1,67 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ListenConfig contains options for listening to an address on a socket
+// with SO_REUSEPORT and SO_REUSEADDR option set. It mirrors
+// net.ListenConfig, see there for the documentation of the fields.
+type ListenConfig struct {
+	// Control is called after the reuse options have been applied to
+	// the socket.
+	Control func(network, address string, c syscall.RawConn) error
+
+	KeepAlive time.Duration
+
+	// Options are the socket options applied to every listening socket.
+	Options []Option
+
+	mptcp    bool
+	mptcpSet bool
+}
+
+// MultipathTCP reports whether MPTCP will be used. see
+// net.ListenConfig.MultipathTCP
+func (lc *ListenConfig) MultipathTCP() bool {
+	if lc.mptcpSet {
+		return lc.mptcp
+	}
+	var nlc net.ListenConfig
+	return nlc.MultipathTCP()
+}
+
+// SetMultipathTCP directs the Listen method to use, or not use, MPTCP,
+// if supported by the operating system. see net.ListenConfig.SetMultipathTCP
+func (lc *ListenConfig) SetMultipathTCP(use bool) {
+	lc.mptcp = use
+	lc.mptcpSet = true
+}
+
+// Listen announces on the local network address. see net.ListenConfig.Listen
+func (lc *ListenConfig) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	cfg := newConfig(lc.Options)
+	return cfg.listenWith(ctx, lc.netListenConfig(cfg), network, address)
+}
+
+// ListenPacket announces on the local network address. see
+// net.ListenConfig.ListenPacket
+func (lc *ListenConfig) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	cfg := newPacketConfig(lc.Options)
+	return cfg.listenPacketWith(ctx, lc.netListenConfig(cfg), network, address)
+}
+
+func (lc *ListenConfig) netListenConfig(cfg *config) *net.ListenConfig {
+	nlc := cfg.listenConfig()
+	if cfg.keepAlive == nil {
+		nlc.KeepAlive = lc.KeepAlive
+	}
+	if lc.mptcpSet {
+		nlc.SetMultipathTCP(lc.mptcp)
+	}
+	nlc.Control = ComposeControl(cfg.control, lc.Control)
+	return nlc
+}
@@ -0,0 +1,336 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults of PortMapManager.
+const (
+	defaultMapLifetime     = 2 * time.Hour
+	defaultMapPollInterval = time.Minute
+)
+
+const (
+	// mapRequestTimeout bounds each request of a PortMapManager.
+	mapRequestTimeout = 30 * time.Second
+	// mapRetryDelay is the delay before retrying a failed renewal.
+	mapRetryDelay = 30 * time.Second
+)
+
+// ErrManagerClosed is returned by the methods of a closed PortMapManager.
+var ErrManagerClosed = errors.New("reuse: port map manager closed")
+
+// PortMapManager keeps the ports of the listeners of the host mapped on
+// the gateway: it renews the mappings halfway through their lifetime,
+// re-establishes them as soon as it detects that the gateway rebooted
+// and lost them, and notifies the caller when their external address or
+// port changes.
+//
+// The zero value for each field selects its default.
+type PortMapManager struct {
+	// Mapper creates the mappings. By default it is discovered by
+	// DiscoverMapper on the first Add.
+	Mapper Mapper
+
+	// Lifetime is the lifetime requested for the mappings, 2 hours by
+	// default.
+	Lifetime time.Duration
+
+	// PollInterval is the interval the gateway is polled at to detect
+	// reboots, 1 minute by default. Mappers other than NATPMPClient and
+	// PCPClient are not polled.
+	PollInterval time.Duration
+
+	// OnChange is called with the renewed mapping when its external
+	// address or port changed.
+	OnChange func(m *Mapping)
+
+	// OnError is called with the errors of the renewals, which are
+	// retried.
+	OnError func(err error)
+
+	mu      sync.Mutex
+	entries map[string]*mapEntry
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	closed  bool
+}
+
+type mapEntry struct {
+	mu      sync.Mutex
+	mapping *Mapping
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Add maps the port of addr, the address of a TCP or UDP listener
+// typically created by Listen or ListenPacket, as MapPort does, and keeps
+// it mapped until Remove or Close.
+func (pm *PortMapManager) Add(ctx context.Context, addr net.Addr) (*Mapping, error) {
+	protocol, port, err := mappedPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := pm.mapper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, err := mapper.MapPort(ctx, protocol, port, port, pm.lifetime())
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.closed {
+		mapper.UnmapPort(ctx, m)
+		return nil, ErrManagerClosed
+	}
+	key := mapKey(addr)
+	if old, ok := pm.entries[key]; ok {
+		close(old.stop)
+	}
+	e := &mapEntry{
+		mapping: m,
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	pm.entries[key] = e
+	pm.wg.Add(1)
+	go pm.renewLoop(mapper, e)
+	return m, nil
+}
+
+// Remove stops renewing the mapping of addr and deletes it.
+func (pm *PortMapManager) Remove(ctx context.Context, addr net.Addr) error {
+	pm.mu.Lock()
+	e, ok := pm.entries[mapKey(addr)]
+	if ok {
+		delete(pm.entries, mapKey(addr))
+	}
+	mapper := pm.Mapper
+	pm.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	close(e.stop)
+	<-e.done
+	return mapper.UnmapPort(ctx, e.current())
+}
+
+// Close stops renewing the mappings and deletes them, returning the first
+// error.
+func (pm *PortMapManager) Close() error {
+	pm.mu.Lock()
+	if pm.closed {
+		pm.mu.Unlock()
+		return nil
+	}
+	pm.closed = true
+	entries := pm.entries
+	pm.entries = nil
+	mapper := pm.Mapper
+	if pm.cancel != nil {
+		pm.cancel()
+	}
+	pm.mu.Unlock()
+
+	for _, e := range entries {
+		close(e.stop)
+	}
+	pm.wg.Wait()
+
+	var first error
+	for _, e := range entries {
+		ctx, cancel := context.WithTimeout(context.Background(), mapRequestTimeout)
+		err := mapper.UnmapPort(ctx, e.current())
+		cancel()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// mapper returns the Mapper of pm, discovering it and starting the
+// reboot detection on first use.
+func (pm *PortMapManager) mapper(ctx context.Context) (Mapper, error) {
+	pm.mu.Lock()
+	closed, mapper := pm.closed, pm.Mapper
+	pm.mu.Unlock()
+	if closed {
+		return nil, ErrManagerClosed
+	}
+	// Discover the gateway without holding the lock, its requests taking
+	// seconds to time out.
+	if mapper == nil {
+		m, err := DiscoverMapper(ctx)
+		if err != nil {
+			return nil, err
+		}
+		mapper = m
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.closed {
+		return nil, ErrManagerClosed
+	}
+	// Keep the Mapper of a concurrent discovery, if any.
+	if pm.Mapper == nil {
+		pm.Mapper = mapper
+	}
+	if pm.entries == nil {
+		pm.entries = make(map[string]*mapEntry)
+		pm.ctx, pm.cancel = context.WithCancel(context.Background())
+		if ep, ok := pm.Mapper.(epocher); ok {
+			pm.wg.Add(1)
+			go pm.pollLoop(ep)
+		}
+	}
+	return pm.Mapper, nil
+}
+
+func (pm *PortMapManager) lifetime() time.Duration {
+	if pm.Lifetime > 0 {
+		return pm.Lifetime
+	}
+	return defaultMapLifetime
+}
+
+// renewLoop renews the mapping of e halfway through its lifetime, or
+// right away when kicked, until e is stopped.
+func (pm *PortMapManager) renewLoop(mapper Mapper, e *mapEntry) {
+	defer pm.wg.Done()
+	defer close(e.done)
+
+	delay := renewDelay(e.current())
+	for {
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-e.kick:
+			t.Stop()
+		case <-e.stop:
+			t.Stop()
+			return
+		}
+
+		old := e.current()
+		ctx, cancel := context.WithTimeout(pm.ctx, mapRequestTimeout)
+		m, err := renewMapping(ctx, mapper, old, pm.lifetime())
+		cancel()
+		if err != nil {
+			if pm.ctx.Err() != nil {
+				return
+			}
+			if pm.OnError != nil {
+				pm.OnError(err)
+			}
+			delay = mapRetryDelay
+			continue
+		}
+
+		e.mu.Lock()
+		e.mapping = m
+		e.mu.Unlock()
+		if (!m.ExternalIP.Equal(old.ExternalIP) || m.ExternalPort != old.ExternalPort) && pm.OnChange != nil {
+			pm.OnChange(m)
+		}
+		delay = renewDelay(m)
+	}
+}
+
+// pollLoop polls the epoch of the gateway, re-establishing all the
+// mappings when it went back in time, meaning the gateway rebooted or
+// reset its mappings, see RFC 6886 section 3.6.
+func (pm *PortMapManager) pollLoop(ep epocher) {
+	defer pm.wg.Done()
+
+	interval := pm.PollInterval
+	if interval <= 0 {
+		interval = defaultMapPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last uint32
+	var lastAt time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-pm.ctx.Done():
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(pm.ctx, mapRequestTimeout)
+		epoch, err := ep.epoch(ctx)
+		cancel()
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		if !lastAt.IsZero() {
+			expected := int64(last) + int64(now.Sub(lastAt)*7/8/time.Second)
+			if int64(epoch) < expected-2 {
+				pm.kickAll()
+			}
+		}
+		last, lastAt = epoch, now
+	}
+}
+
+// kickAll renews all the mappings right away.
+func (pm *PortMapManager) kickAll() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, e := range pm.entries {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// renewDelay returns the delay before renewing m, halfway through its
+// lifetime.
+func renewDelay(m *Mapping) time.Duration {
+	if m.Lifetime <= 0 {
+		return mapRetryDelay
+	}
+	return m.Lifetime / 2
+}
+
+func (e *mapEntry) current() *Mapping {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.mapping
+}
+
+// epocher is implemented by the Mappers able to report the epoch of the
+// gateway.
+type epocher interface {
+	epoch(ctx context.Context) (uint32, error)
+}
+
+// renewMapping renews m for lifetime, keeping the identity of the
+// mapping for the Mappers of this package.
+func renewMapping(ctx context.Context, mapper Mapper, m *Mapping, lifetime time.Duration) (*Mapping, error) {
+	if r, ok := mapper.(interface {
+		renew(context.Context, *Mapping, time.Duration) (*Mapping, error)
+	}); ok {
+		return r.renew(ctx, m, lifetime)
+	}
+	return mapper.MapPort(ctx, m.Protocol, m.InternalPort, m.ExternalPort, lifetime)
+}
+
+func mapKey(addr net.Addr) string {
+	return addr.Network() + " " + addr.String()
+}
@@ -0,0 +1,44 @@
+package reuse
+
+import (
+	"net"
+)
+
+// MDNSPort is the mDNS port.
+const MDNSPort = 5353
+
+var (
+	// MDNSGroupIPv4 is the IPv4 mDNS multicast group.
+	MDNSGroupIPv4 = net.IPv4(224, 0, 0, 251)
+	// MDNSGroupIPv6 is the IPv6 mDNS multicast group.
+	MDNSGroupIPv6 = net.ParseIP("ff02::fb")
+)
+
+// ListenMDNS listens on the mDNS port for network, "udp4" or "udp6", with
+// SO_REUSEPORT and SO_REUSEADDR option set, so that it coexists with the
+// other mDNS responders of the host, and joins the mDNS group on each of
+// ifis, or on every up multicast capable interface if ifis is empty.
+// Joining the group on some of the interfaces may fail, ListenMDNS only
+// fails if it joined none.
+//
+// The multicast TTL is set to 255 and the loopback enabled, as required
+// by RFC 6762.
+func ListenMDNS(network string, ifis []*net.Interface, opts ...Option) (net.PacketConn, error) {
+	group := MDNSGroupIPv4
+	if network == "udp6" {
+		group = MDNSGroupIPv6
+	}
+	c, err := listenMulticast(network, MDNSPort, group, ifis, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := SetMulticastTTL(c, 255); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := SetMulticastLoopback(c, true); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,22 @@
+package reuse
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// mptcpOptionError returns err, an error setting the options of the
+// socket fd, reporting the options MPTCP sockets do not support on the
+// running kernel as such.
+func mptcpOptionError(fd uintptr, err error) error {
+	if !errors.Is(err, unix.EOPNOTSUPP) && !errors.Is(err, unix.ENOPROTOOPT) {
+		return err
+	}
+	proto, perr := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PROTOCOL)
+	if perr != nil || proto != unix.IPPROTO_MPTCP {
+		return err
+	}
+	return fmt.Errorf("%w: %w on an MPTCP socket", ErrOptionUnsupported, err)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+func mptcpOptionError(fd uintptr, err error) error {
+	return err
+}
@@ -0,0 +1,135 @@
+package reuse
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// JoinGroup joins the multicast group on the interface ifi, or the
+// system default multicast interface if ifi is nil, on c, typically a
+// connection returned by ListenPacket. Combined with the reuse options
+// several processes can join the same group on the same port.
+func JoinGroup(c net.PacketConn, ifi *net.Interface, group net.IP) error {
+	if group.To4() != nil {
+		return ipv4.NewPacketConn(c).JoinGroup(ifi, &net.UDPAddr{IP: group})
+	}
+	return ipv6.NewPacketConn(c).JoinGroup(ifi, &net.UDPAddr{IP: group})
+}
+
+// LeaveGroup leaves the multicast group on the interface ifi, or the
+// system default multicast interface if ifi is nil, on c.
+func LeaveGroup(c net.PacketConn, ifi *net.Interface, group net.IP) error {
+	if group.To4() != nil {
+		return ipv4.NewPacketConn(c).LeaveGroup(ifi, &net.UDPAddr{IP: group})
+	}
+	return ipv6.NewPacketConn(c).LeaveGroup(ifi, &net.UDPAddr{IP: group})
+}
+
+// SetMulticastInterface sets the interface multicast datagrams are sent
+// from on c.
+func SetMulticastInterface(c net.PacketConn, ifi *net.Interface) error {
+	if ipv4Conn(c) {
+		return ipv4.NewPacketConn(c).SetMulticastInterface(ifi)
+	}
+	ipv4.NewPacketConn(c).SetMulticastInterface(ifi)
+	return ipv6.NewPacketConn(c).SetMulticastInterface(ifi)
+}
+
+// SetMulticastLoopback sets whether multicast datagrams sent on c are
+// looped back to the sockets of the host that joined the group.
+func SetMulticastLoopback(c net.PacketConn, enable bool) error {
+	if ipv4Conn(c) {
+		return ipv4.NewPacketConn(c).SetMulticastLoopback(enable)
+	}
+	ipv4.NewPacketConn(c).SetMulticastLoopback(enable)
+	return ipv6.NewPacketConn(c).SetMulticastLoopback(enable)
+}
+
+// SetMulticastTTL sets the time to live, or hop limit for IPv6, of the
+// multicast datagrams sent on c.
+func SetMulticastTTL(c net.PacketConn, ttl int) error {
+	if ipv4Conn(c) {
+		return ipv4.NewPacketConn(c).SetMulticastTTL(ttl)
+	}
+	ipv4.NewPacketConn(c).SetMulticastTTL(ttl)
+	return ipv6.NewPacketConn(c).SetMulticastHopLimit(ttl)
+}
+
+// ipv4Conn reports whether c is bound to an IPv4 address. The IPv4
+// options of IPv6 sockets, which also carry IPv4-mapped traffic, are set
+// on a best effort basis.
+func ipv4Conn(c net.PacketConn) bool {
+	switch a := c.LocalAddr().(type) {
+	case *net.UDPAddr:
+		return a.IP.To4() != nil
+	case *net.IPAddr:
+		return a.IP.To4() != nil
+	}
+	return false
+}
+
+// listenMulticast listens on the wildcard address of network, "udp4" or
+// "udp6", at port and joins group on each of ifis, or on every up
+// multicast capable interface if ifis is empty.
+func listenMulticast(network string, port int, group net.IP, ifis []*net.Interface, opts []Option) (net.PacketConn, error) {
+	var host string
+	switch network {
+	case "udp4":
+		host = "0.0.0.0"
+	case "udp6":
+		host = "::"
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	if len(ifis) == 0 {
+		all, err := multicastInterfaces()
+		if err != nil {
+			return nil, err
+		}
+		ifis = all
+	}
+
+	c, err := ListenPacket(network, net.JoinHostPort(host, strconv.Itoa(port)), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	joined := 0
+	var jerr error
+	for _, ifi := range ifis {
+		if err := JoinGroup(c, ifi, group); err != nil {
+			jerr = fmt.Errorf("joining %v on %s: %w", group, ifi.Name, err)
+			continue
+		}
+		joined++
+	}
+	if joined == 0 {
+		c.Close()
+		if jerr == nil {
+			jerr = errors.New("reuse: no multicast interface")
+		}
+		return nil, jerr
+	}
+	return c, nil
+}
+
+// multicastInterfaces returns the up multicast capable interfaces.
+func multicastInterfaces() ([]*net.Interface, error) {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var ifis []*net.Interface
+	for i := range all {
+		if all[i].Flags&net.FlagUp != 0 && all[i].Flags&net.FlagMulticast != 0 {
+			ifis = append(ifis, &all[i])
+		}
+	}
+	return ifis, nil
+}
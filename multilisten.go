@@ -0,0 +1,223 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// MultiListener aggregates the listeners of several local addresses into
+// a single net.Listener, Accept returning the connections of all of them.
+type MultiListener struct {
+	network string
+	accepts chan multiAccept
+	done    chan struct{}
+
+	mu sync.Mutex
+	ls []net.Listener
+}
+
+type multiAccept struct {
+	conn net.Conn
+	err  error
+}
+
+func newMultiListener(network string) *MultiListener {
+	return &MultiListener{
+		network: network,
+		accepts: make(chan multiAccept),
+		done:    make(chan struct{}),
+	}
+}
+
+// ListenAll listens on port at each of addrs, IP addresses or host names,
+// with the default options. see ListenAllContext
+func ListenAll(network string, port int, addrs ...string) (*MultiListener, error) {
+	return ListenAllContext(context.Background(), network, port, addrs)
+}
+
+// ListenAllContext listens on port at each of addrs on a TCP network with
+// the options of opts, or at every unicast address of the interfaces up
+// if addrs is empty, so that a service listens on the addresses of its
+// choice rather than on the wildcard address. A port of 0 selects the
+// ephemeral port of the first listener for all of them. The listeners
+// are closed if one of them fails.
+func ListenAllContext(ctx context.Context, network string, port int, addrs []string, opts ...Option) (*MultiListener, error) {
+	if !tcp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	if len(addrs) == 0 {
+		ifAddrs, err := interfaceAddrs(network, nil)
+		if err != nil {
+			return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+		}
+		for _, a := range ifAddrs {
+			addrs = append(addrs, a.addr)
+		}
+		if len(addrs) == 0 {
+			return nil, &net.OpError{Op: "listen", Net: network, Err: &net.AddrError{Err: "no suitable address found"}}
+		}
+	}
+
+	cfg := newConfig(opts)
+	m := newMultiListener(network)
+	for _, addr := range addrs {
+		l, err := cfg.listen(ctx, network, net.JoinHostPort(addr, strconv.Itoa(port)))
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		if ta, ok := l.Addr().(*net.TCPAddr); ok && port == 0 {
+			port = ta.Port
+		}
+		m.add(l)
+	}
+	return m, nil
+}
+
+// ifaceAddr is a unicast address of a network interface.
+type ifaceAddr struct {
+	iface string
+	addr  string
+}
+
+// interfaceAddrs returns the unicast addresses for network of the
+// interfaces up, or of those match accepts if not nil, the IPv6
+// link-local addresses with the zone of their interface.
+func interfaceAddrs(network string, match func(net.Interface) bool) ([]ifaceAddr, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var addrs []ifaceAddr
+	for _, ifi := range ifs {
+		if ifi.Flags&net.FlagUp == 0 || match != nil && !match(ifi) {
+			continue
+		}
+		ifAddrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range ifAddrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || !familyMatch(network, ipnet.IP) {
+				continue
+			}
+			addr := ipnet.IP.String()
+			if ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+				addr += "%" + ifi.Name
+			}
+			addrs = append(addrs, ifaceAddr{iface: ifi.Name, addr: addr})
+		}
+	}
+	return addrs, nil
+}
+
+// familyMatch reports whether ip belongs to the address family of network,
+// either family matching a network without suffix.
+func familyMatch(network string, ip net.IP) bool {
+	switch network[len(network)-1] {
+	case '4':
+		return ip.To4() != nil
+	case '6':
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// Accept waits for and returns the next connection accepted by one of
+// the listeners.
+func (m *MultiListener) Accept() (net.Conn, error) {
+	select {
+	case a := <-m.accepts:
+		return a.conn, a.err
+	case <-m.done:
+		return nil, &net.OpError{Op: "accept", Net: m.network, Addr: m.Addr(), Err: net.ErrClosed}
+	}
+}
+
+// Close closes the listeners. The connections accepted but not yet
+// returned by Accept are closed.
+func (m *MultiListener) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.done:
+		return &net.OpError{Op: "close", Net: m.network, Err: net.ErrClosed}
+	default:
+	}
+	close(m.done)
+	var errs []error
+	for _, l := range m.ls {
+		errs = append(errs, l.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Addr returns the address of the first listener, nil if there is none.
+func (m *MultiListener) Addr() net.Addr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.ls) == 0 {
+		return nil
+	}
+	return m.ls[0].Addr()
+}
+
+// Addrs returns the addresses of the listeners.
+func (m *MultiListener) Addrs() []net.Addr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	addrs := make([]net.Addr, len(m.ls))
+	for i, l := range m.ls {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// add adds l to the listeners of m, closing it if m is closed.
+func (m *MultiListener) add(l net.Listener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.done:
+		l.Close()
+		return
+	default:
+	}
+	m.ls = append(m.ls, l)
+	go m.serve(l)
+}
+
+// remove closes l and removes it from the listeners of m.
+func (m *MultiListener) remove(l net.Listener) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, ml := range m.ls {
+		if ml == l {
+			m.ls = append(m.ls[:i:i], m.ls[i+1:]...)
+			return l.Close()
+		}
+	}
+	return nil
+}
+
+// serve passes the connections accepted by l to Accept until l is closed.
+func (m *MultiListener) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil && errors.Is(err, net.ErrClosed) {
+			return
+		}
+		select {
+		case m.accepts <- multiAccept{conn: conn, err: err}:
+		case <-m.done:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// STUN attributes of RFC 5780.
+const (
+	stunAttrChangeRequest = 0x0003
+	stunAttrOtherAddress  = 0x802c
+
+	stunChangeIP   = 0x4
+	stunChangePort = 0x2
+)
+
+// natTestTimeout is the time waited for the response to each NAT
+// behavior test, the absence of a response being an outcome of the
+// filtering tests.
+const natTestTimeout = 3 * time.Second
+
+// ErrNATDiscoveryUnsupported is returned when the STUN server does not
+// support the NAT behavior discovery of RFC 5780, by lacking an
+// alternate address.
+var ErrNATDiscoveryUnsupported = errors.New("reuse: STUN server does not support NAT behavior discovery")
+
+// NATBehavior is the mapping or filtering behavior of a NAT, see RFC
+// 4787.
+type NATBehavior int
+
+const (
+	// EndpointIndependent NATs map, or let in, every destination,
+	// or source, through the same mapping.
+	EndpointIndependent NATBehavior = iota + 1
+	// AddressDependent NATs use a mapping per destination, or only let
+	// in sources, with the same address.
+	AddressDependent
+	// AddressAndPortDependent NATs use a mapping per destination, or
+	// only let in sources, with the same address and port.
+	AddressAndPortDependent
+)
+
+func (b NATBehavior) String() string {
+	switch b {
+	case EndpointIndependent:
+		return "endpoint independent"
+	case AddressDependent:
+		return "address dependent"
+	case AddressAndPortDependent:
+		return "address and port dependent"
+	}
+	return "unknown"
+}
+
+// NATType is the behavior of the NATs between a socket and the Internet,
+// as discovered by DetectNAT.
+type NATType struct {
+	// NAT reports whether the socket is behind a NAT, that is whether
+	// its mapped address is not one of the addresses of the host.
+	NAT bool
+
+	// MappedAddr is the address the socket is mapped to.
+	MappedAddr *net.UDPAddr
+
+	// Mapping is the mapping behavior of the NAT.
+	Mapping NATBehavior
+
+	// Filtering is the filtering behavior of the NAT.
+	Filtering NATBehavior
+}
+
+// Symmetric reports whether the NAT uses a mapping per destination,
+// preventing the reflexive address learnt through STUN from being used
+// by peers. Hole punching through such NATs requires port prediction.
+func (t *NATType) Symmetric() bool {
+	return t.Mapping != EndpointIndependent
+}
+
+// DetectNAT discovers the mapping and filtering behavior of the NATs
+// between c and server, a STUN server supporting RFC 5780, by sending
+// binding requests to the alternate addresses of the server and asking
+// it to answer from them. As it runs on c, the result applies to the
+// socket shared with the application traffic.
+func (c *STUNConn) DetectNAT(ctx context.Context, server string) (*NATType, error) {
+	primary, err := net.ResolveUDPAddr(c.network(), server)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test I: the mapped and alternate addresses.
+	resp, err := c.natTest(ctx, primary, 0)
+	if err != nil {
+		return nil, err
+	}
+	mapped, err := resp.mappedAddr()
+	if err != nil {
+		return nil, err
+	}
+	v, ok := resp.attr(stunAttrOtherAddress)
+	if !ok {
+		return nil, ErrNATDiscoveryUnsupported
+	}
+	other, err := resp.addr(v, false)
+	if err != nil {
+		return nil, err
+	}
+	if other.IP.Equal(primary.IP) || other.Port == primary.Port {
+		return nil, ErrNATDiscoveryUnsupported
+	}
+
+	t := &NATType{MappedAddr: mapped}
+	t.NAT, err = c.natted(mapped)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Mapping, err = c.detectMapping(ctx, mapped, primary, other)
+	if err != nil {
+		return nil, err
+	}
+	t.Filtering, err = c.detectFiltering(ctx, primary)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// detectMapping runs the mapping tests II and III, comparing the
+// addresses mapped for the alternate addresses of the server to mapped.
+func (c *STUNConn) detectMapping(ctx context.Context, mapped, primary, other *net.UDPAddr) (NATBehavior, error) {
+	resp, err := c.natTest(ctx, &net.UDPAddr{IP: other.IP, Port: primary.Port}, 0)
+	if err != nil {
+		return 0, err
+	}
+	mapped2, err := resp.mappedAddr()
+	if err != nil {
+		return 0, err
+	}
+	if equalUDPAddr(mapped2, mapped) {
+		return EndpointIndependent, nil
+	}
+
+	resp, err = c.natTest(ctx, other, 0)
+	if err != nil {
+		return 0, err
+	}
+	mapped3, err := resp.mappedAddr()
+	if err != nil {
+		return 0, err
+	}
+	if equalUDPAddr(mapped3, mapped2) {
+		return AddressDependent, nil
+	}
+	return AddressAndPortDependent, nil
+}
+
+// detectFiltering runs the filtering tests II and III, asking the server
+// to answer from its alternate address and port, then from its
+// alternate port.
+func (c *STUNConn) detectFiltering(ctx context.Context, primary *net.UDPAddr) (NATBehavior, error) {
+	_, err := c.natTest(ctx, primary, stunChangeIP|stunChangePort)
+	if err == nil {
+		return EndpointIndependent, nil
+	}
+	if err != ErrSTUNTimeout {
+		return 0, err
+	}
+
+	_, err = c.natTest(ctx, primary, stunChangePort)
+	if err == nil {
+		return AddressDependent, nil
+	}
+	if err != ErrSTUNTimeout {
+		return 0, err
+	}
+	return AddressAndPortDependent, nil
+}
+
+// natTest sends a binding request with the CHANGE-REQUEST flags change
+// to raddr, returning ErrSTUNTimeout if no response arrives within
+// natTestTimeout.
+func (c *STUNConn) natTest(ctx context.Context, raddr *net.UDPAddr, change byte) (*stunMessage, error) {
+	tctx, cancel := context.WithTimeout(ctx, natTestTimeout)
+	defer cancel()
+
+	var attrs []stunAttr
+	if change != 0 {
+		attrs = append(attrs, stunAttr{typ: stunAttrChangeRequest, value: []byte{0, 0, 0, change}})
+	}
+	resp, err := c.roundTrip(tctx, raddr, newSTUNRequest(attrs...))
+	if err != nil && ctx.Err() == nil && tctx.Err() != nil {
+		return nil, ErrSTUNTimeout
+	}
+	return resp, err
+}
+
+// natted reports whether mapped is not one of the addresses of the host
+// c is bound to.
+func (c *STUNConn) natted(mapped *net.UDPAddr) (bool, error) {
+	laddr, ok := c.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return true, nil
+	}
+	hosts, err := hostCandidates(laddr)
+	if err != nil {
+		return false, err
+	}
+	return len(excludeAddrs(hosts, []*net.UDPAddr{mapped})) == len(hosts), nil
+}
+
+func equalUDPAddr(a, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
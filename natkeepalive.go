@@ -0,0 +1,122 @@
+package reuse
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Defaults of NATKeepalive.
+const (
+	defaultNATKeepaliveInterval = 25 * time.Second
+	defaultNATKeepaliveJitter   = 0.1
+)
+
+// stunBindingIndication is the STUN message type sent by ICE agents as
+// keepalive, which STUN servers and peers ignore.
+const stunBindingIndication = 0x0011
+
+// NATKeepalive periodically sends a small datagram from a shared UDP
+// socket, typically created by ListenPacket, to each of a set of peers
+// and servers, refreshing the NAT bindings of the socket for them before
+// they time out. The datagrams of each destination are sent at their
+// own interval, randomized by Jitter so that many keepalives do not
+// fire in bursts.
+type NATKeepalive struct {
+	// Payload is the datagram sent, a STUN binding indication by
+	// default.
+	Payload []byte
+
+	// Jitter is the fraction the intervals are randomly varied by, 0.1
+	// by default.
+	Jitter float64
+
+	// OnError is called with the errors of the writes, which do not stop
+	// the keepalives.
+	OnError func(addr net.Addr, err error)
+
+	conn  net.PacketConn
+	mu    sync.Mutex
+	dests map[string]chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewNATKeepalive returns a NATKeepalive sending from conn, without
+// destinations.
+func NewNATKeepalive(conn net.PacketConn) *NATKeepalive {
+	return &NATKeepalive{
+		conn:  conn,
+		dests: make(map[string]chan struct{}),
+	}
+}
+
+// Add starts sending keepalives to addr every interval, 25s by default,
+// replacing the previous interval of addr.
+func (k *NATKeepalive) Add(addr net.Addr, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultNATKeepaliveInterval
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.dests == nil {
+		return
+	}
+	if stop, ok := k.dests[addr.String()]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	k.dests[addr.String()] = stop
+	k.wg.Add(1)
+	go k.loop(addr, interval, stop)
+}
+
+// Remove stops sending keepalives to addr.
+func (k *NATKeepalive) Remove(addr net.Addr) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if stop, ok := k.dests[addr.String()]; ok {
+		close(stop)
+		delete(k.dests, addr.String())
+	}
+}
+
+// Close stops sending keepalives. The socket is left open.
+func (k *NATKeepalive) Close() error {
+	k.mu.Lock()
+	for _, stop := range k.dests {
+		close(stop)
+	}
+	k.dests = nil
+	k.mu.Unlock()
+	k.wg.Wait()
+	return nil
+}
+
+func (k *NATKeepalive) loop(addr net.Addr, interval time.Duration, stop chan struct{}) {
+	defer k.wg.Done()
+	jitter := k.Jitter
+	if jitter <= 0 {
+		jitter = defaultNATKeepaliveJitter
+	}
+
+	for {
+		wait := time.Duration(float64(interval) * (1 + jitter*(2*rand.Float64()-1)))
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-stop:
+			t.Stop()
+			return
+		}
+		payload := k.Payload
+		if payload == nil {
+			m := newSTUNRequest()
+			m.typ = stunBindingIndication
+			payload = m.marshal()
+		}
+		if _, err := k.conn.WriteTo(payload, addr); err != nil && k.OnError != nil {
+			k.OnError(addr, err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package reuse
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// NAT-PMP constants, see RFC 6886.
+const (
+	natpmpVersion = 0
+
+	natpmpOpExternalAddr = 0
+	natpmpOpMapUDP       = 1
+	natpmpOpMapTCP       = 2
+)
+
+// ErrNATPMPTimeout is returned when the gateway did not answer any of the
+// retransmissions of a NAT-PMP request.
+var ErrNATPMPTimeout = errors.New("reuse: NAT-PMP request timed out")
+
+// NATPMPError is the error result code returned by a NAT-PMP gateway.
+type NATPMPError struct {
+	Code int
+}
+
+func (e *NATPMPError) Error() string {
+	var reason string
+	switch e.Code {
+	case 1:
+		reason = "unsupported version"
+	case 2:
+		reason = "not authorized"
+	case 3:
+		reason = "network failure"
+	case 4:
+		reason = "out of resources"
+	case 5:
+		reason = "unsupported opcode"
+	default:
+		reason = "result " + strconv.Itoa(e.Code)
+	}
+	return "reuse: NAT-PMP: " + reason
+}
+
+// NATPMPClient is a Mapper speaking NAT-PMP, see RFC 6886, to Gateway.
+type NATPMPClient struct {
+	// Gateway is the address of the gateway.
+	Gateway net.IP
+}
+
+// ExternalIP returns the external address of the gateway.
+func (c *NATPMPClient) ExternalIP(ctx context.Context) (net.IP, error) {
+	resp, err := c.roundTrip(ctx, []byte{natpmpVersion, natpmpOpExternalAddr}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IP(resp[8:12]), nil
+}
+
+// epoch returns the seconds since the gateway started or reset its
+// mappings.
+func (c *NATPMPClient) epoch(ctx context.Context) (uint32, error) {
+	resp, err := c.roundTrip(ctx, []byte{natpmpVersion, natpmpOpExternalAddr}, 12)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(resp[4:]), nil
+}
+
+// MapPort maps externalPort, or another port chosen by the gateway, to
+// internalPort for protocol, "tcp" or "udp", for lifetime, rounded up to
+// whole seconds.
+func (c *NATPMPClient) MapPort(ctx context.Context, protocol string, internalPort, externalPort int, lifetime time.Duration) (*Mapping, error) {
+	ip, err := c.ExternalIP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mapping{
+		Protocol:     protocol,
+		InternalPort: internalPort,
+		ExternalIP:   ip,
+	}
+	if err := c.mapPort(ctx, m, externalPort, lifetime); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// renew renews m for lifetime, returning the mapping granted.
+func (c *NATPMPClient) renew(ctx context.Context, m *Mapping, lifetime time.Duration) (*Mapping, error) {
+	return c.MapPort(ctx, m.Protocol, m.InternalPort, m.ExternalPort, lifetime)
+}
+
+// UnmapPort deletes the mapping m.
+func (c *NATPMPClient) UnmapPort(ctx context.Context, m *Mapping) error {
+	return c.mapPort(ctx, &Mapping{Protocol: m.Protocol, InternalPort: m.InternalPort}, 0, 0)
+}
+
+// mapPort requests the mapping of m with the suggested externalPort and
+// lifetime, filling in the external port and lifetime granted.
+func (c *NATPMPClient) mapPort(ctx context.Context, m *Mapping, externalPort int, lifetime time.Duration) error {
+	var op byte
+	switch m.Protocol {
+	case "udp":
+		op = natpmpOpMapUDP
+	case "tcp":
+		op = natpmpOpMapTCP
+	default:
+		return fmt.Errorf("reuse: NAT-PMP cannot map protocol %q", m.Protocol)
+	}
+
+	req := make([]byte, 12)
+	req[0], req[1] = natpmpVersion, op
+	binary.BigEndian.PutUint16(req[4:], uint16(m.InternalPort))
+	binary.BigEndian.PutUint16(req[6:], uint16(externalPort))
+	binary.BigEndian.PutUint32(req[8:], uint32(roundDuration(lifetime, time.Second)))
+	resp, err := c.roundTrip(ctx, req, 16)
+	if err != nil {
+		return err
+	}
+	m.ExternalPort = int(binary.BigEndian.Uint16(resp[10:]))
+	m.Lifetime = time.Duration(binary.BigEndian.Uint32(resp[12:])) * time.Second
+	return nil
+}
+
+// roundTrip sends req to the gateway with retransmissions, returning the
+// successful response of at least size bytes to it.
+func (c *NATPMPClient) roundTrip(ctx context.Context, req []byte, size int) ([]byte, error) {
+	if c.Gateway == nil {
+		return nil, errors.New("reuse: NAT-PMP requires a gateway")
+	}
+	build := func(*net.UDPAddr) []byte { return req }
+	return gatewayExchange(ctx, c.Gateway, build, ErrNATPMPTimeout, func(resp []byte) (bool, error) {
+		// Skip the responses to other requests, such as the
+		// announcements multicast on address changes.
+		if len(resp) < 4 || resp[0] != natpmpVersion || resp[1] != 128+req[1] {
+			return false, nil
+		}
+		if code := binary.BigEndian.Uint16(resp[2:]); code != 0 {
+			return false, &NATPMPError{Code: int(code)}
+		}
+		if len(resp) < size {
+			return false, fmt.Errorf("reuse: short NAT-PMP response of %d bytes", len(resp))
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,219 @@
+package reuse
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// netmonSettle is how long a NetworkMonitor waits for the messages of
+	// a change to settle before notifying it.
+	netmonSettle = 100 * time.Millisecond
+	// netmonPollInterval is how often the addresses are polled on the
+	// platforms without change notifications.
+	netmonPollInterval = 5 * time.Second
+)
+
+// NetworkMonitor watches the addresses and routes of the host, through
+// netlink on Linux, routing sockets on Darwin and the BSDs, IP Helper
+// notifications on Windows, and by polling the interface addresses on the
+// other platforms, so that the sockets bound to an address follow it.
+//
+// The listeners of an InterfaceListenConfig whose Monitor is set are
+// added and removed as the changes are reported, and WatchConn re-dials
+// the connections dialed from a pinned source address once it is gone.
+type NetworkMonitor struct {
+	changed chan struct{}
+	done    chan struct{}
+	stop    func() error
+	once    sync.Once
+
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]func()
+}
+
+// NewNetworkMonitor starts watching the network of the host until Close
+// is called.
+func NewNetworkMonitor() (*NetworkMonitor, error) {
+	m := &NetworkMonitor{
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		subs:    make(map[int]func()),
+	}
+	stop, err := watchNetwork(m.notify)
+	if err != nil {
+		return nil, err
+	}
+	m.stop = stop
+	go m.dispatch()
+	return m, nil
+}
+
+// Subscribe calls fn after each change of the addresses or routes, the
+// bursts of changes being reported once. fn is called from the goroutine
+// of m and must not block. It returns a function unsubscribing fn.
+func (m *NetworkMonitor) Subscribe(fn func()) (unsubscribe func()) {
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.subs[id] = fn
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		delete(m.subs, id)
+		m.mu.Unlock()
+	}
+}
+
+// WatchAddr calls fn once ip is no longer an address of an interface of
+// the host, as checked after each change. It returns a function stopping
+// the watch.
+func (m *NetworkMonitor) WatchAddr(ip net.IP, fn func()) (stop func()) {
+	var once sync.Once
+	var unsubscribe func()
+	unsubscribe = m.Subscribe(func() {
+		if !hostHasAddr(ip) {
+			once.Do(func() {
+				go unsubscribe()
+				fn()
+			})
+		}
+	})
+	return unsubscribe
+}
+
+// WatchConn closes conn, a TCP or UDP connection dialed from a pinned
+// source address, once its local address is gone, and calls redial with
+// it so that it is dialed again, from another address or from the same
+// one once it is back. It returns a function stopping the watch.
+func (m *NetworkMonitor) WatchConn(conn net.Conn, redial func(old net.Conn)) (stop func()) {
+	var ip net.IP
+	switch a := conn.LocalAddr().(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return func() {}
+	}
+	return m.WatchAddr(ip, func() {
+		conn.Close()
+		redial(conn)
+	})
+}
+
+// Close stops watching the network.
+func (m *NetworkMonitor) Close() error {
+	var err error
+	m.once.Do(func() {
+		close(m.done)
+		err = m.stop()
+	})
+	return err
+}
+
+// notify records a change, called by the watcher of the platform.
+func (m *NetworkMonitor) notify() {
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (m *NetworkMonitor) dispatch() {
+	for {
+		select {
+		case <-m.changed:
+		case <-m.done:
+			return
+		}
+		// Coalesce the messages of a change, such as an address removed
+		// along with its routes.
+		timer := time.NewTimer(netmonSettle)
+		select {
+		case <-timer.C:
+		case <-m.done:
+			timer.Stop()
+			return
+		}
+		select {
+		case <-m.changed:
+		default:
+		}
+
+		m.mu.Lock()
+		subs := make([]func(), 0, len(m.subs))
+		for _, fn := range m.subs {
+			subs = append(subs, fn)
+		}
+		m.mu.Unlock()
+		for _, fn := range subs {
+			fn()
+		}
+	}
+}
+
+// hostHasAddr reports whether ip is an address of an interface of the
+// host, the unspecified address always being.
+func hostHasAddr(ip net.IP) bool {
+	if ip == nil || ip.IsUnspecified() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		// Keep the sockets on a transient failure.
+		return true
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollNetwork calls changed as the addresses of the interfaces change,
+// polling them, until the returned function is called.
+func pollNetwork(changed func()) func() error {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(netmonPollInterval)
+		defer ticker.Stop()
+		last := addrSnapshot()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			if s := addrSnapshot(); s != last {
+				last = s
+				changed()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() error {
+		once.Do(func() { close(done) })
+		return nil
+	}
+}
+
+// addrSnapshot returns the addresses of the interfaces as a string.
+func addrSnapshot() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	s := make([]string, len(addrs))
+	for i, a := range addrs {
+		s[i] = a.String()
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
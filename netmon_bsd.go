@@ -0,0 +1,19 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package reuse
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func watchNetwork(changed func()) (func() error, error) {
+	s, err := unix.Socket(unix.AF_ROUTE, unix.SOCK_RAW, unix.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	unix.CloseOnExec(s)
+	return watchSocket(s, changed)
+}
@@ -0,0 +1,23 @@
+package reuse
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func watchNetwork(changed func()) (func() error, error) {
+	s, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	sa := &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR | unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE,
+	}
+	if err := unix.Bind(s, sa); err != nil {
+		unix.Close(s)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	return watchSocket(s, changed)
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package reuse
+
+func watchNetwork(changed func()) (func() error, error) {
+	return pollNetwork(changed), nil
+}
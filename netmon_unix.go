@@ -0,0 +1,34 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package reuse
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchSocket calls changed for each message read from s, a netlink or a
+// routing socket, until the returned function closes it.
+func watchSocket(s int, changed func()) (func() error, error) {
+	if err := unix.SetNonblock(s, true); err != nil {
+		unix.Close(s)
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+	f := os.NewFile(uintptr(s), "netmon")
+	go func() {
+		buf := make([]byte, 1<<16)
+		for {
+			_, err := f.Read(buf)
+			// ENOBUFS reports the messages lost as the socket buffer
+			// overflowed, a change all the same.
+			if err != nil && !errors.Is(err, unix.ENOBUFS) {
+				return
+			}
+			changed()
+		}
+	}()
+	return f.Close, nil
+}
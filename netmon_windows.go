@@ -0,0 +1,81 @@
+package reuse
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modiphlpapi = windows.NewLazySystemDLL("iphlpapi.dll")
+
+	procNotifyUnicastIpAddressChange = modiphlpapi.NewProc("NotifyUnicastIpAddressChange")
+	procNotifyRouteChange2           = modiphlpapi.NewProc("NotifyRouteChange2")
+	procCancelMibChangeNotify2       = modiphlpapi.NewProc("CancelMibChangeNotify2")
+)
+
+// The watchers are called by a single callback, the callbacks created by
+// windows.NewCallback never being released, and found by the context the
+// notifications were registered with.
+var (
+	netmonOnce     sync.Once
+	netmonCallback uintptr
+	netmonMu       sync.Mutex
+	netmonNextID   uintptr
+	netmonWatchers = make(map[uintptr]func())
+)
+
+func netmonNotify(id, row, typ uintptr) uintptr {
+	netmonMu.Lock()
+	changed := netmonWatchers[id]
+	netmonMu.Unlock()
+	if changed != nil {
+		changed()
+	}
+	return 0
+}
+
+func watchNetwork(changed func()) (func() error, error) {
+	if err := procNotifyRouteChange2.Find(); err != nil {
+		return pollNetwork(changed), nil
+	}
+	netmonOnce.Do(func() {
+		netmonCallback = windows.NewCallback(netmonNotify)
+	})
+
+	netmonMu.Lock()
+	netmonNextID++
+	id := netmonNextID
+	netmonWatchers[id] = changed
+	netmonMu.Unlock()
+
+	var handles []windows.Handle
+	stop := func() error {
+		for _, h := range handles {
+			procCancelMibChangeNotify2.Call(uintptr(h))
+		}
+		netmonMu.Lock()
+		delete(netmonWatchers, id)
+		netmonMu.Unlock()
+		return nil
+	}
+	for _, p := range []struct {
+		name string
+		proc *windows.LazyProc
+	}{
+		{"NotifyUnicastIpAddressChange", procNotifyUnicastIpAddressChange},
+		{"NotifyRouteChange2", procNotifyRouteChange2},
+	} {
+		var h windows.Handle
+		r, _, _ := p.proc.Call(windows.AF_UNSPEC, netmonCallback, id, 0, uintptr(unsafe.Pointer(&h)))
+		if r != 0 {
+			stop()
+			return nil, os.NewSyscallError(p.name, syscall.Errno(r))
+		}
+		handles = append(handles, h)
+	}
+	return stop, nil
+}
@@ -0,0 +1,896 @@
+package reuse
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Option configures the socket options applied by the Listen and Dial
+// functions of this package.
+type Option func(*config)
+
+type config struct {
+	reuseAddr bool
+	reusePort bool
+	strict    bool
+	rcvBuf    int
+	sndBuf    int
+	forceBuf  bool
+
+	cpuSteering   bool
+	ebpfProg      int
+	incomingCPU   int
+	bindDevice    string
+	freebind      bool
+	bindNoPort    bool
+	transparent   bool
+	origDst       bool
+	deferAccept   time.Duration
+	quickAck      bool
+	noDelay       *bool
+	keepAlive     *keepAlive
+	congestion    string
+	mark          uint32
+	udpSegment    int
+	udpGRO        bool
+	txTime        *txTime
+	notSentLowat  int
+	maxSeg        int
+	linger        *int
+	tos           *int
+	ttl           int
+	broadcast     *bool
+	dontFrag      *bool
+	udpConnReset  *bool
+	recvECN       bool
+	bestEffortDF  bool
+	bestEffortECN bool
+	hdrIncl       bool
+	icmpEchoID    *uint16
+	ioUring       bool
+	mptcp         *bool
+	vsockBufSize  uint64
+	proxyProto    bool
+	proxyHeader   *ProxyHeader
+	resolver      *net.Resolver
+	addrCache     AddrCache
+	literalOnly   bool
+	retry         *RetryPolicy
+
+	boundIf          string
+	protect          func(fd uintptr) error
+	hooks            []*hook
+	reuseUnicastPort bool
+	exclusiveAddr    bool
+	removeStale      bool
+	conflictCheck    bool
+	iface            string
+	preferIPv6       bool
+
+	controls []func(network, address string, c syscall.RawConn) error
+}
+
+type keepAlive struct {
+	idle     time.Duration
+	interval time.Duration
+	count    int
+}
+
+type txTime struct {
+	clockid int
+	flags   uint32
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		reuseAddr:   true,
+		reusePort:   true,
+		ebpfProg:    -1,
+		incomingCPU: -1,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithReuseAddr sets whether SO_REUSEADDR is set on the socket.
+// It is enabled by default.
+func WithReuseAddr(enable bool) Option {
+	return func(c *config) {
+		c.reuseAddr = enable
+	}
+}
+
+// WithReusePort sets whether SO_REUSEPORT is set on the socket.
+// It is enabled by default. Disabling it while keeping SO_REUSEADDR
+// only allows rebinding addresses in TIME_WAIT, while disabling
+// SO_REUSEADDR and keeping SO_REUSEPORT avoids the TIME_WAIT semantics
+// of SO_REUSEADDR.
+//
+// On Windows, where SO_REUSEADDR provides the port sharing behaviour,
+// SO_REUSEADDR is set when either option is enabled.
+func WithReusePort(enable bool) Option {
+	return func(c *config) {
+		c.reusePort = enable
+	}
+}
+
+// WithStrict enables strict mode, in which creating a socket with
+// SO_REUSEPORT enabled fails with ErrReuseUnsupported unless the platform
+// load-balances between the sockets sharing the port. It guards
+// multi-process services against silently running with a single
+// process receiving all the traffic. On FreeBSD, strict mode sets the
+// load-balancing SO_REUSEPORT_LB rather than SO_REUSEPORT, failing with
+// ErrReuseUnsupported if the kernel lacks it.
+func WithStrict(enable bool) Option {
+	return func(c *config) {
+		c.strict = enable
+	}
+}
+
+// WithRcvBuf sets the SO_RCVBUF size of the socket in bytes.
+// A size of zero leaves the system default in place.
+func WithRcvBuf(size int) Option {
+	return func(c *config) {
+		c.rcvBuf = size
+	}
+}
+
+// WithSndBuf sets the SO_SNDBUF size of the socket in bytes.
+// A size of zero leaves the system default in place.
+func WithSndBuf(size int) Option {
+	return func(c *config) {
+		c.sndBuf = size
+	}
+}
+
+// WithCPUSteering attaches a classic BPF program to the SO_REUSEPORT
+// group of the socket, steering every incoming connection or datagram
+// to the socket with the index of the CPU that received it. It is
+// meant for servers creating one listener per CPU, in CPU order, with
+// each accept loop running on the matching CPU. Linux only.
+func WithCPUSteering(enable bool) Option {
+	return func(c *config) {
+		c.cpuSteering = enable
+	}
+}
+
+// WithReusePortProg attaches the loaded eBPF program referred to by the
+// file descriptor prog, of type BPF_PROG_TYPE_SOCKET_FILTER or
+// BPF_PROG_TYPE_SK_REUSEPORT, to the SO_REUSEPORT group of the socket in
+// order to select the socket receiving each connection or datagram.
+// Linux only.
+func WithReusePortProg(prog int) Option {
+	return func(c *config) {
+		c.ebpfProg = prog
+	}
+}
+
+// WithIncomingCPU sets SO_INCOMING_CPU on the socket, so that among the
+// sockets of its SO_REUSEPORT group the kernel prefers it for the
+// connections received by cpu. It is meant for servers creating one
+// listener per CPU, see ListenPinned. Linux only.
+func WithIncomingCPU(cpu int) Option {
+	return func(c *config) {
+		c.incomingCPU = cpu
+	}
+}
+
+// WithBindToDevice binds the socket to the named network device through
+// SO_BINDTODEVICE, so that it only receives and sends packets through
+// that device, e.g. "eth0" on a multi-NIC server. Linux only.
+func WithBindToDevice(device string) Option {
+	return func(c *config) {
+		c.bindDevice = device
+	}
+}
+
+// WithConflictCheck makes the listeners check, before binding a TCP or
+// UDP socket, that its address does not overlap the address of a socket
+// already bound to the port: a wildcard address and the specific address
+// of another socket, or the other way round. Depending on the platform
+// and on port reuse, such binds either fail with EADDRINUSE or succeed,
+// the socket of the specific address silently taking the traffic of its
+// address. The check fails with ErrBindConflict instead, describing the
+// overlapping sockets. Linux only.
+func WithConflictCheck(enable bool) Option {
+	return func(c *config) {
+		c.conflictCheck = enable
+	}
+}
+
+// WithInterface binds the socket to an address of the named network
+// interface when the address listened on, or dialed from, is empty or
+// unspecified, such as ":443", looked up at bind time so that it follows
+// the current addresses of the interface. An interface name may also be
+// given in place of the host, as in "eth0:443". See WithPreferIPv6 for
+// the address chosen, and WithBindToDevice to also keep the traffic on
+// the interface.
+func WithInterface(name string) Option {
+	return func(c *config) {
+		c.iface = name
+	}
+}
+
+// WithPreferIPv6 sets whether the IPv6 addresses of a network interface
+// are preferred to its IPv4 addresses when an interface name selects the
+// address of a network of either family, the IPv4 addresses being
+// preferred by default. The addresses that are not link-local are
+// preferred in either family.
+func WithPreferIPv6(enable bool) Option {
+	return func(c *config) {
+		c.preferIPv6 = enable
+	}
+}
+
+// WithFreebind sets IP_FREEBIND or IPV6_FREEBIND on the socket, allowing
+// it to bind to an address that is not configured on the host yet, such
+// as a virtual IP taken over on failover. Linux only.
+func WithFreebind(enable bool) Option {
+	return func(c *config) {
+		c.freebind = enable
+	}
+}
+
+// WithBindAddressNoPort sets IP_BIND_ADDRESS_NO_PORT on TCP sockets, so
+// that dialing from a local address with port 0 only binds the IP
+// address and leaves the choice of the port to connect, which may then
+// reuse a port already bound to another destination. Proxies dialing many
+// connections from a specific source IP would exhaust the ephemeral
+// ports otherwise. Linux only.
+func WithBindAddressNoPort(enable bool) Option {
+	return func(c *config) {
+		c.bindNoPort = enable
+	}
+}
+
+// WithTransparent sets IP_TRANSPARENT or IPV6_TRANSPARENT on the socket,
+// so that a listener accepts connections and datagrams destined to any
+// address redirected to it by TPROXY rules. Combined with the reuse
+// options several proxy workers can share the port. It requires the
+// CAP_NET_ADMIN capability. Linux only.
+func WithTransparent(enable bool) Option {
+	return func(c *config) {
+		c.transparent = enable
+	}
+}
+
+// WithRecvOrigDstAddr sets IP_RECVORIGDSTADDR or IPV6_RECVORIGDSTADDR on
+// the socket, so that the original destination of datagrams redirected
+// by TPROXY rules can be read through an OrigDstConn. Linux only.
+func WithRecvOrigDstAddr(enable bool) Option {
+	return func(c *config) {
+		c.origDst = enable
+	}
+}
+
+// WithDeferAccept sets TCP_DEFER_ACCEPT on TCP listeners, so that Accept
+// only returns a connection once data has arrived on it, waiting up to
+// timeout, rounded up to whole seconds, for the data. Linux only.
+func WithDeferAccept(timeout time.Duration) Option {
+	return func(c *config) {
+		c.deferAccept = timeout
+	}
+}
+
+// WithQuickAck sets TCP_QUICKACK on TCP sockets, disabling delayed ACKs
+// at the start of the connection. See SetQuickAck to set it again on an
+// established connection. Linux only.
+func WithQuickAck(enable bool) Option {
+	return func(c *config) {
+		c.quickAck = enable
+	}
+}
+
+// WithNoDelay enables or disables Nagle's algorithm through TCP_NODELAY on
+// the connections dialed, and accepted from the listeners created, by the
+// Listen and Dial functions. Unlike a type assertion on the returned
+// net.Conn it also applies to the connections wrapped by ListenTLS and
+// DialTLS. The net package enables TCP_NODELAY by default.
+func WithNoDelay(enable bool) Option {
+	return func(c *config) {
+		c.noDelay = &enable
+	}
+}
+
+// WithKeepAlive enables TCP keepalives on TCP sockets with the given idle
+// time before the first probe, interval between probes and number of
+// unanswered probes before the connection is dropped, through
+// TCP_KEEPIDLE, TCP_KEEPINTVL and TCP_KEEPCNT or the platform equivalent.
+// Zero values keep the system defaults. The keepalive settings of the
+// net package are disabled in favour of these.
+//
+// Windows supports the options starting with Windows 10 version 1709,
+// OpenBSD only supports system wide settings.
+func WithKeepAlive(idle, interval time.Duration, count int) Option {
+	return func(c *config) {
+		c.keepAlive = &keepAlive{idle: idle, interval: interval, count: count}
+	}
+}
+
+// WithCongestion selects the TCP congestion control algorithm of TCP
+// sockets, such as "bbr" or "cubic", through TCP_CONGESTION. Creating the
+// socket fails with ErrCongestionUnavailable if the algorithm is not
+// available, see AvailableCongestionControls. Linux only.
+func WithCongestion(algorithm string) Option {
+	return func(c *config) {
+		c.congestion = algorithm
+	}
+}
+
+// WithMark sets SO_MARK on the socket, tagging its packets with the
+// firewall mark for policy routing with ip rule fwmark. It requires the
+// CAP_NET_ADMIN capability. Linux only.
+func WithMark(mark uint32) Option {
+	return func(c *config) {
+		c.mark = mark
+	}
+}
+
+// WithUDPSegment sets UDP_SEGMENT on UDP sockets, so that every datagram
+// written is segmented by the kernel or the NIC into datagrams of size
+// bytes (UDP GSO). See WriteSegmented to segment single writes. Linux
+// only.
+func WithUDPSegment(size int) Option {
+	return func(c *config) {
+		c.udpSegment = size
+	}
+}
+
+// WithUDPGRO sets UDP_GRO on UDP sockets, so that the kernel coalesces
+// consecutive datagrams of a flow, read through ReadCoalesced. Linux only.
+func WithUDPGRO(enable bool) Option {
+	return func(c *config) {
+		c.udpGRO = enable
+	}
+}
+
+// WithTxTime sets SO_TXTIME on the socket, so that the datagrams written
+// through WriteToAt are held back by the kernel until their transmit
+// time, measured on clock clockid, such as unix.CLOCK_MONOTONIC for the
+// fq qdisc or unix.CLOCK_TAI for the etf qdisc. flags is a combination of
+// TxTimeDeadlineMode and TxTimeReportErrors. Linux only.
+func WithTxTime(clockid int, flags uint32) Option {
+	return func(c *config) {
+		c.txTime = &txTime{clockid: clockid, flags: flags}
+	}
+}
+
+// WithNotSentLowat sets TCP_NOTSENT_LOWAT on TCP sockets, limiting the
+// amount of unsent data buffered in the kernel to bytes, so that writers
+// block earlier and latency-sensitive streams can react to congestion.
+// Linux and Darwin only.
+func WithNotSentLowat(bytes int) Option {
+	return func(c *config) {
+		c.notSentLowat = bytes
+	}
+}
+
+// WithMaxSeg clamps the maximum segment size of TCP sockets to bytes
+// through TCP_MAXSEG, for paths through tunnels with a reduced MTU.
+// Not supported on Windows.
+func WithMaxSeg(bytes int) Option {
+	return func(c *config) {
+		c.maxSeg = bytes
+	}
+}
+
+// WithLinger sets SO_LINGER on the socket, with the semantics of
+// net.TCPConn.SetLinger: with sec < 0 Close returns immediately and the
+// remaining data is sent in the background, with sec == 0 the remaining
+// data is discarded and the connection reset, avoiding TIME_WAIT, and
+// with sec > 0 Close blocks for up to sec seconds sending the remaining
+// data. Accepted connections inherit the setting of the listener.
+func WithLinger(sec int) Option {
+	return func(c *config) {
+		c.linger = &sec
+	}
+}
+
+// WithTOS sets the IPv4 type of service or IPv6 traffic class of the
+// packets sent on the socket through IP_TOS or IPV6_TCLASS. A DSCP value
+// dscp is set with WithTOS(dscp << 2).
+func WithTOS(tos int) Option {
+	return func(c *config) {
+		c.tos = &tos
+	}
+}
+
+// WithTTL sets the IPv4 time to live or IPv6 unicast hop limit of the
+// packets sent on the socket through IP_TTL or IPV6_UNICAST_HOPS, e.g. to
+// send low TTL NAT traversal probes that expire before reaching the peer.
+func WithTTL(ttl int) Option {
+	return func(c *config) {
+		c.ttl = ttl
+	}
+}
+
+// WithBroadcast sets SO_BROADCAST on UDP sockets, allowing datagrams to be
+// sent to broadcast addresses such as 255.255.255.255 from the reused
+// port. The net package enables it by default on most platforms, this
+// makes it explicit and allows disabling it.
+func WithBroadcast(enable bool) Option {
+	return func(c *config) {
+		c.broadcast = &enable
+	}
+}
+
+// WithDontFragment sets the don't fragment bit on the datagrams sent on
+// UDP sockets, through IP_MTU_DISCOVER and IPV6_MTU_DISCOVER on Linux or
+// IP_DONTFRAG and IPV6_DONTFRAG elsewhere, so that oversized datagrams
+// fail rather than being fragmented, as required by path MTU discovery
+// in QUIC. On Linux the path MTU cached by the kernel is ignored. The
+// IPv4 variant is only supported on Linux, Darwin, FreeBSD and Windows.
+func WithDontFragment(enable bool) Option {
+	return func(c *config) {
+		c.dontFrag = &enable
+		c.bestEffortDF = false
+	}
+}
+
+// WithUDPConnReset controls whether the reads of a UDP socket fail with
+// WSAECONNRESET once a datagram it sent is answered by an ICMP port
+// unreachable message, through SIO_UDP_CONNRESET. The error breaks the
+// ReadFrom loops of servers sending to clients gone, so ListenPacket
+// disables it by default. Windows only, other platforms not reporting
+// these errors on unconnected sockets ignore it.
+func WithUDPConnReset(enable bool) Option {
+	return func(c *config) {
+		c.udpConnReset = &enable
+	}
+}
+
+// WithRecvECN sets IP_RECVTOS and IPV6_RECVTCLASS on UDP sockets, so that
+// the ECN bits of the datagrams received are delivered as control
+// messages to ReadMsgUDP, as used by QUIC congestion control. The IPv4
+// variant is only supported on Linux, Darwin, FreeBSD and Windows.
+func WithRecvECN(enable bool) Option {
+	return func(c *config) {
+		c.recvECN = enable
+		c.bestEffortECN = false
+	}
+}
+
+// WithHeaderIncluded sets IP_HDRINCL on raw IPv4 sockets, such as those
+// of ListenIP and ListenICMP, so that the datagrams written include their
+// IPv4 header, built by the caller.
+func WithHeaderIncluded(enable bool) Option {
+	return func(c *config) {
+		c.hdrIncl = enable
+	}
+}
+
+// WithICMPEchoID selects the identifier of the ICMP echo requests of the
+// sockets of ListenICMP, so that the processes pinging through sockets
+// sharing ICMP traffic each read the replies to their own requests. The
+// datagram sockets are bound to id, which the kernel sets on the requests
+// written. The raw sockets get a filter dropping the echo replies with
+// another identifier, the other messages, such as the errors traceroute
+// relies on, being kept. Linux only.
+func WithICMPEchoID(id uint16) Option {
+	return func(c *config) {
+		c.icmpEchoID = &id
+	}
+}
+
+// WithIOUring performs the Accept of the listeners and the ReadFrom and
+// WriteTo of the UDP packet conns through an io_uring shared by the
+// sockets of the package, for workloads where the syscall overhead of
+// the netpoller dominates. The listeners and packet conns are then
+// wrapped, so that they are no longer *net.TCPListener or *net.UDPConn.
+// Without io_uring, disabled by the kernel or a seccomp filter, the
+// netpoller is used, except in strict mode. Linux only.
+func WithIOUring(enable bool) Option {
+	return func(c *config) {
+		c.ioUring = enable
+	}
+}
+
+// WithMultipathTCP makes the TCP listeners and dialers use, or not use,
+// Multipath TCP if the operating system supports it, falling back to TCP
+// otherwise. The reuse options are set on the MPTCP socket and apply to
+// its subflows. The TCP options an older kernel does not support on
+// MPTCP sockets fail with ErrOptionUnsupported. see
+// net.ListenConfig.SetMultipathTCP
+func WithMultipathTCP(use bool) Option {
+	return func(c *config) {
+		c.mptcp = &use
+	}
+}
+
+// WithVsockBufferSize sets SO_VM_SOCKETS_BUFFER_SIZE, the size in bytes
+// of the buffer of the VSOCK connections of ListenVsock and DialVsock.
+// Linux only.
+func WithVsockBufferSize(size uint64) Option {
+	return func(c *config) {
+		c.vsockBufSize = size
+	}
+}
+
+// WithProxyProtocol makes the listeners require a PROXY protocol header,
+// version 1 or 2, at the start of the accepted connections, as sent by
+// load balancers such as HAProxy. The RemoteAddr and LocalAddr of the
+// connections are then those of the client and of the server the header
+// carries. The header is read on the first Read, RemoteAddr or LocalAddr,
+// within 5 seconds or the read deadline if earlier, the addresses of the
+// connection itself being returned if it does not arrive. see
+// ReadProxyHeader
+func WithProxyProtocol(enable bool) Option {
+	return func(c *config) {
+		c.proxyProto = enable
+	}
+}
+
+// WithProxyHeader makes the dialed connections send the PROXY protocol
+// header h once connected, to pass the addresses of a client through a
+// relay to a server accepting the protocol.
+func WithProxyHeader(h *ProxyHeader) Option {
+	return func(c *config) {
+		c.proxyHeader = h
+	}
+}
+
+// WithResolver makes the Dial functions and ResolveAddr look up host
+// names with r, e.g. a resolver dialing a DNS over TLS server, rather
+// than with the resolver of the system.
+func WithResolver(r *net.Resolver) Option {
+	return func(c *config) {
+		c.resolver = r
+	}
+}
+
+// WithLiteralOnly makes ResolveAddr, and the Dial functions resolving
+// their local address, only accept IP literals and interface names as
+// hosts, failing with a NotLiteralError rather than looking up a host
+// name, so that latency or security sensitive callers never trigger a DNS
+// query by accident. The unix socket addresses are not affected.
+func WithLiteralOnly(enable bool) Option {
+	return func(c *config) {
+		c.literalOnly = enable
+	}
+}
+
+// WithBoundInterface binds the socket to the named network interface
+// through IP_BOUND_IF or IPV6_BOUND_IF, so that its traffic only uses
+// that interface, e.g. "en0" for Wi-Fi rather than Ethernet on a
+// multihomed host. The interface index is looked up when the socket is
+// created. Darwin only.
+func WithBoundInterface(name string) Option {
+	return func(c *config) {
+		c.boundIf = name
+	}
+}
+
+// WithReuseUnicastPort sets SO_REUSE_UNICASTPORT on the socket, so that
+// the ephemeral port of an outbound connection is only reserved when it
+// connects, letting Windows share it between connections to different
+// destinations. The ports are taken from the auto-reuse port range if it
+// is configured, see the AutoReusePortRange settings of netsh. This is
+// the way Microsoft recommends to reuse outbound ports, SO_REUSEADDR
+// applying to listeners. Windows 10 and later only; older versions
+// ignore it unless strict mode is set.
+func WithReuseUnicastPort(enable bool) Option {
+	return func(c *config) {
+		c.reuseUnicastPort = enable
+	}
+}
+
+// WithExclusiveAddrUse sets SO_EXCLUSIVEADDRUSE on the socket rather
+// than SO_REUSEADDR, so that no other socket may bind its port, not even
+// with SO_REUSEADDR. On Windows SO_REUSEADDR lets any process bind a port
+// in use and steal its connections, see Capabilities.Hijackable, which
+// security sensitive listeners should prevent. The reuse options are
+// ignored. Windows only.
+func WithExclusiveAddrUse(enable bool) Option {
+	return func(c *config) {
+		c.exclusiveAddr = enable
+	}
+}
+
+// WithRemoveStale makes the listeners of unix sockets remove the socket
+// file left at their path by a process that exited without removing it,
+// before binding: the file is a socket and connecting to it is refused.
+// This is the unix socket analogue of SO_REUSEADDR. The files of a
+// listening socket, and the other files, are left in place. Processes
+// starting concurrently on the same path must serialize, for instance
+// with a lock file.
+func WithRemoveStale(enable bool) Option {
+	return func(c *config) {
+		c.removeStale = enable
+	}
+}
+
+// WithProtect calls protect with the file descriptor of each socket once
+// it is created and its options set, before it binds or connects. An
+// Android VPN app passes its VpnService.protect method, so that the
+// sockets it dials reach the network directly rather than loop back
+// through its own tunnel:
+//
+//	reuse.WithProtect(func(fd uintptr) error {
+//		if !vpnService.Protect(int(fd)) {
+//			return errors.New("protect failed")
+//		}
+//		return nil
+//	})
+//
+// An error fails the listen or dial.
+func WithProtect(protect func(fd uintptr) error) Option {
+	return func(c *config) {
+		c.protect = protect
+	}
+}
+
+// WithControl adds functions called after the reuse options have been
+// applied to the socket, in order to set further socket options.
+func WithControl(fns ...func(network, address string, c syscall.RawConn) error) Option {
+	return func(c *config) {
+		c.controls = append(c.controls, fns...)
+	}
+}
+
+// WithForceBuf makes WithRcvBuf and WithSndBuf use SO_RCVBUFFORCE and
+// SO_SNDBUFFORCE, which exceed the system wide buffer size limits, when
+// the process has the CAP_NET_ADMIN capability. Without the capability,
+// or on platforms other than Linux, the regular options are used.
+func WithForceBuf(enable bool) Option {
+	return func(c *config) {
+		c.forceBuf = enable
+	}
+}
+
+// newPacketConfig returns the config of opts for listening on a packet
+// socket, which differs in its defaults.
+func newPacketConfig(opts []Option) *config {
+	c := newConfig(opts)
+	if c.udpConnReset == nil {
+		c.udpConnReset = new(bool)
+	}
+	return c
+}
+
+// control is the net.ListenConfig and net.Dialer Control function
+// applying the socket options of c.
+func (c *config) control(network, address string, rc syscall.RawConn) error {
+	if c.conflictCheck {
+		if err := checkBindConflict(network, address, rc); err != nil {
+			return err
+		}
+	}
+	return c.controlHooks(network, address, rc, HookBind)
+}
+
+// dialControl returns the net.Dialer Control function applying the socket
+// options of c to sockets dialing from laddr.
+func (c *config) dialControl(laddr net.Addr) func(network, address string, rc syscall.RawConn) error {
+	points := []HookPoint{HookConnect}
+	if laddr != nil {
+		points = []HookPoint{HookBind, HookConnect}
+	}
+	return func(network, address string, rc syscall.RawConn) error {
+		return c.controlHooks(network, address, rc, points...)
+	}
+}
+
+// controlHooks applies the socket options of c, calling the hooks of
+// HookSocket before and then those of points.
+func (c *config) controlHooks(network, address string, rc syscall.RawConn, points ...HookPoint) error {
+	if c.strict && c.reusePort && !reusePortBalanced && soReusePortLB < 0 {
+		return ErrReuseUnsupported
+	}
+
+	if err := c.runHooks(HookSocket, network, address, rc); err != nil {
+		return fmt.Errorf("%w: %w", ErrControlFailed, err)
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = c.setsockopt(network, fd)
+		if serr != nil {
+			serr = mptcpOptionError(fd, serr)
+		}
+		if serr == nil && c.protect != nil {
+			serr = c.protect(fd)
+		}
+	}); err != nil {
+		return fmt.Errorf("%w: %w", ErrControlFailed, err)
+	}
+	if serr != nil {
+		return fmt.Errorf("%w: %w", ErrControlFailed, serr)
+	}
+	if err := ComposeControl(c.controls...)(network, address, rc); err != nil {
+		return fmt.Errorf("%w: %w", ErrControlFailed, err)
+	}
+	for _, point := range points {
+		if err := c.runHooks(point, network, address, rc); err != nil {
+			return fmt.Errorf("%w: %w", ErrControlFailed, err)
+		}
+	}
+	return nil
+}
+
+func (c *config) listenConfig() *net.ListenConfig {
+	lc := &net.ListenConfig{
+		Control: c.control,
+	}
+	if c.keepAlive != nil {
+		lc.KeepAlive = -1
+	}
+	if c.mptcp != nil {
+		lc.SetMultipathTCP(*c.mptcp)
+	}
+	return lc
+}
+
+func (c *config) dialer(laddr net.Addr) *net.Dialer {
+	d := &net.Dialer{
+		Control:   c.dialControl(laddr),
+		LocalAddr: laddr,
+		Resolver:  c.resolver,
+	}
+	if fakeNet {
+		d.Control = nil
+	}
+	if c.keepAlive != nil {
+		d.KeepAlive = -1
+	}
+	if c.mptcp != nil {
+		d.SetMultipathTCP(*c.mptcp)
+	}
+	return d
+}
+
+// linuxOption returns the name of the first Linux specific socket option
+// requested in c, or an empty string if there is none.
+func (c *config) linuxOption() string {
+	switch {
+	case c.cpuSteering:
+		return "SO_ATTACH_REUSEPORT_CBPF"
+	case c.ebpfProg >= 0:
+		return "SO_ATTACH_REUSEPORT_EBPF"
+	case c.incomingCPU >= 0:
+		return "SO_INCOMING_CPU"
+	case c.bindDevice != "":
+		return "SO_BINDTODEVICE"
+	case c.freebind:
+		return "IP_FREEBIND"
+	case c.bindNoPort:
+		return "IP_BIND_ADDRESS_NO_PORT"
+	case c.transparent:
+		return "IP_TRANSPARENT"
+	case c.origDst:
+		return "IP_RECVORIGDSTADDR"
+	case c.deferAccept > 0:
+		return "TCP_DEFER_ACCEPT"
+	case c.quickAck:
+		return "TCP_QUICKACK"
+	case c.congestion != "":
+		return "TCP_CONGESTION"
+	case c.mark != 0:
+		return "SO_MARK"
+	case c.udpSegment > 0:
+		return "UDP_SEGMENT"
+	case c.udpGRO:
+		return "UDP_GRO"
+	case c.txTime != nil:
+		return "SO_TXTIME"
+	case c.ioUring:
+		return "io_uring"
+	case c.vsockBufSize > 0:
+		return "SO_VM_SOCKETS_BUFFER_SIZE"
+	case c.icmpEchoID != nil:
+		return "ICMP echo ID"
+	}
+	return ""
+}
+
+// windowsOption returns the name of the first Windows specific socket
+// option requested in c, or an empty string if there is none.
+func (c *config) windowsOption() string {
+	switch {
+	case c.reuseUnicastPort:
+		return "SO_REUSE_UNICASTPORT"
+	case c.exclusiveAddr:
+		return "SO_EXCLUSIVEADDRUSE"
+	}
+	return ""
+}
+
+// darwinOption returns the name of the first Darwin specific socket
+// option requested in c, or an empty string if there is none.
+func (c *config) darwinOption() string {
+	switch {
+	case c.boundIf != "":
+		return "IP_BOUND_IF"
+	}
+	return ""
+}
+
+func (c *config) listen(ctx context.Context, network, address string) (net.Listener, error) {
+	return c.listenWith(ctx, c.listenConfig(), network, address)
+}
+
+// listenWith listens on address with lc, the host of address naming an
+// interface being replaced by its address and the stale Unix socket file
+// being removed first.
+func (c *config) listenWith(ctx context.Context, lc *net.ListenConfig, network, address string) (net.Listener, error) {
+	address, err := c.interfaceAddress(network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+	if err := c.removeStaleSocket(network, address); err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+	l, err := lc.Listen(ctx, network, address)
+	if err != nil {
+		return nil, classify(err)
+	}
+	return c.listener(l), nil
+}
+
+// listenPacketWith is the listenWith of the packet networks.
+func (c *config) listenPacketWith(ctx context.Context, lc *net.ListenConfig, network, address string) (net.PacketConn, error) {
+	address, err := c.interfaceAddress(network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+	if err := c.removeStaleSocket(network, address); err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+	pc, err := lc.ListenPacket(ctx, network, address)
+	if err != nil {
+		return nil, classify(err)
+	}
+	return c.packetConn(pc), nil
+}
+
+func (c *config) dial(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+	if tcp(network) && dialsSelf(d.LocalAddr, address) {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Err: ErrDialSelf}
+	}
+	var conn net.Conn
+	var err error
+	if c.retry != nil {
+		conn, err = c.retry.dial(ctx, d, network, address)
+	} else {
+		conn, err = d.DialContext(ctx, network, address)
+	}
+	if err != nil {
+		return nil, classify(err)
+	}
+	// A TCP socket connecting to its own address gets connected to itself
+	// by the simultaneous open.
+	if tcp(network) && conn.LocalAddr().String() == conn.RemoteAddr().String() {
+		conn.Close()
+		return nil, &net.OpError{Op: "dial", Net: network, Source: conn.LocalAddr(), Addr: conn.RemoteAddr(), Err: ErrDialSelf}
+	}
+	if c.proxyHeader != nil {
+		if err := c.proxyHeader.write(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c.conn(conn)
+}
+
+// dialsSelf reports whether dialing the literal address from laddr would
+// connect a socket to itself, laddr being the same address or the same
+// port of the unspecified address and address a loopback address.
+func dialsSelf(laddr net.Addr, address string) bool {
+	la, ok := laddr.(*net.TCPAddr)
+	if !ok || la.Port == 0 {
+		return false
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || port != strconv.Itoa(la.Port) {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.Equal(la.IP) || (la.IP == nil || la.IP.IsUnspecified()) && ip.IsLoopback()
+}
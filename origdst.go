@@ -0,0 +1,40 @@
+package reuse
+
+import (
+	"fmt"
+	"net"
+)
+
+// OrigDstConn wraps a UDP connection created by ListenPacket with the
+// WithTransparent and WithRecvOrigDstAddr options, to read datagrams
+// along with the destination address they were originally sent to
+// before being redirected by TPROXY rules.
+type OrigDstConn struct {
+	*net.UDPConn
+}
+
+// NewOrigDstConn returns an OrigDstConn reading from c, which must be a
+// *net.UDPConn. Linux only.
+func NewOrigDstConn(c net.PacketConn) (*OrigDstConn, error) {
+	if origDstOOBSize == 0 {
+		return nil, unsupportedOption("IP_RECVORIGDSTADDR")
+	}
+	u, ok := c.(*net.UDPConn)
+	if !ok {
+		return nil, fmt.Errorf("reuse: original destination requires a *net.UDPConn, got %T", c)
+	}
+	return &OrigDstConn{UDPConn: u}, nil
+}
+
+// ReadFromOrigDst reads a datagram into b, returning the number of bytes
+// read, the source address and the original destination address of the
+// datagram.
+func (c *OrigDstConn) ReadFromOrigDst(b []byte) (n int, addr, dst *net.UDPAddr, err error) {
+	oob := make([]byte, origDstOOBSize)
+	n, oobn, _, addr, err := c.ReadMsgUDP(b, oob)
+	if err != nil {
+		return n, addr, nil, err
+	}
+	dst, err = parseOrigDst(oob[:oobn])
+	return n, addr, dst, err
+}
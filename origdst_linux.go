@@ -0,0 +1,33 @@
+package reuse
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+var origDstOOBSize = unix.CmsgSpace(unix.SizeofSockaddrInet6)
+
+func parseOrigDst(oob []byte) (*net.UDPAddr, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == unix.SOL_IP && m.Header.Type == unix.IP_ORIGDSTADDR && len(m.Data) >= unix.SizeofSockaddrInet4:
+			return &net.UDPAddr{
+				IP:   net.IP(append([]byte(nil), m.Data[4:8]...)),
+				Port: int(binary.BigEndian.Uint16(m.Data[2:4])),
+			}, nil
+		case m.Header.Level == unix.SOL_IPV6 && m.Header.Type == unix.IPV6_ORIGDSTADDR && len(m.Data) >= unix.SizeofSockaddrInet6:
+			return &net.UDPAddr{
+				IP:   net.IP(append([]byte(nil), m.Data[8:24]...)),
+				Port: int(binary.BigEndian.Uint16(m.Data[2:4])),
+			}, nil
+		}
+	}
+	return nil, errors.New("reuse: no original destination address in control message")
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+import (
+	"net"
+)
+
+const origDstOOBSize = 0
+
+func parseOrigDst(oob []byte) (*net.UDPAddr, error) {
+	return nil, unsupportedOption("IP_RECVORIGDSTADDR")
+}
@@ -0,0 +1,239 @@
+package reuse
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// PCP constants, see RFC 6887.
+const (
+	pcpVersion = 2
+
+	pcpOpAnnounce = 0
+	pcpOpMap      = 1
+
+	pcpHeaderSize = 24
+	pcpMapSize    = 36
+
+	pcpProtoTCP = 6
+	pcpProtoUDP = 17
+
+	// pcpDiscardPort is the internal port mapped to learn the external
+	// address, the discard service not expecting traffic.
+	pcpDiscardPort = 9
+	// pcpProbeLifetime is the lifetime of the mapping made to learn the
+	// external address, deleted right after.
+	pcpProbeLifetime = 2 * time.Minute
+)
+
+// ErrPCPTimeout is returned when the server did not answer any of the
+// retransmissions of a PCP request.
+var ErrPCPTimeout = errors.New("reuse: PCP request timed out")
+
+// PCPError is the error result code returned by a PCP server.
+type PCPError struct {
+	Code int
+}
+
+var pcpErrors = map[int]string{
+	1:  "unsupported version",
+	2:  "not authorized",
+	3:  "malformed request",
+	4:  "unsupported opcode",
+	5:  "unsupported option",
+	6:  "malformed option",
+	7:  "network failure",
+	8:  "no resources",
+	9:  "unsupported protocol",
+	10: "user exceeded quota",
+	11: "cannot provide external address",
+	12: "address mismatch",
+	13: "excessive remote peers",
+}
+
+func (e *PCPError) Error() string {
+	reason, ok := pcpErrors[e.Code]
+	if !ok {
+		reason = "result " + strconv.Itoa(e.Code)
+	}
+	return "reuse: PCP: " + reason
+}
+
+// PCPClient is a Mapper speaking the Port Control Protocol, see RFC 6887,
+// to Server, the gateway of the host or the carrier-grade NAT of its
+// network.
+type PCPClient struct {
+	// Server is the address of the PCP server.
+	Server net.IP
+}
+
+// ExternalIP returns the external address of the server, learnt by
+// mapping the discard port for a short time, PCP lacking a dedicated
+// request.
+func (c *PCPClient) ExternalIP(ctx context.Context) (net.IP, error) {
+	m, err := c.MapPort(ctx, "udp", pcpDiscardPort, 0, pcpProbeLifetime)
+	if err != nil {
+		return nil, err
+	}
+	c.UnmapPort(ctx, m)
+	return m.ExternalIP, nil
+}
+
+// MapPort maps externalPort, or another port chosen by the server, to
+// internalPort for protocol, "tcp" or "udp", for lifetime, rounded up to
+// whole seconds.
+func (c *PCPClient) MapPort(ctx context.Context, protocol string, internalPort, externalPort int, lifetime time.Duration) (*Mapping, error) {
+	m := &Mapping{
+		Protocol:     protocol,
+		InternalPort: internalPort,
+	}
+	rand.Read(m.nonce[:])
+	if err := c.mapPort(ctx, m, externalPort, lifetime); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// renew renews m for lifetime, returning the mapping granted. The nonce
+// of m is kept, as the server only lets its owner update a mapping.
+func (c *PCPClient) renew(ctx context.Context, m *Mapping, lifetime time.Duration) (*Mapping, error) {
+	r := *m
+	if err := c.mapPort(ctx, &r, m.ExternalPort, lifetime); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// UnmapPort deletes the mapping m.
+func (c *PCPClient) UnmapPort(ctx context.Context, m *Mapping) error {
+	d := *m
+	return c.mapPort(ctx, &d, 0, 0)
+}
+
+// probe checks that the server speaks PCP with an announce request.
+func (c *PCPClient) probe(ctx context.Context) error {
+	_, err := c.epoch(ctx)
+	return err
+}
+
+// epoch returns the seconds since the server started or reset its
+// mappings.
+func (c *PCPClient) epoch(ctx context.Context) (uint32, error) {
+	resp, err := c.roundTrip(ctx, pcpOpAnnounce, 0, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(resp[8:]), nil
+}
+
+// mapPort requests the mapping of m with the suggested externalPort and
+// lifetime, filling in the external address, port and lifetime granted.
+func (c *PCPClient) mapPort(ctx context.Context, m *Mapping, externalPort int, lifetime time.Duration) error {
+	var proto byte
+	switch m.Protocol {
+	case "udp":
+		proto = pcpProtoUDP
+	case "tcp":
+		proto = pcpProtoTCP
+	default:
+		return fmt.Errorf("reuse: PCP cannot map protocol %q", m.Protocol)
+	}
+
+	payload := func(internal net.IP) []byte {
+		return pcpMapPayload(m, proto, externalPort, internal)
+	}
+	resp, err := c.roundTrip(ctx, pcpOpMap, lifetime, payload, func(resp []byte) bool {
+		return len(resp) >= pcpHeaderSize+pcpMapSize && string(resp[pcpHeaderSize:pcpHeaderSize+12]) == string(m.nonce[:])
+	})
+	if err != nil {
+		return err
+	}
+	pcpParseMap(m, resp)
+	return nil
+}
+
+// pcpMapPayload returns the payload of a map request for m, protocol proto
+// and the suggested externalPort, sent from the internal address. Without
+// a previous external address, the suggested one is the unspecified
+// address of the family of internal, see RFC 6887 section 11.1.
+func pcpMapPayload(m *Mapping, proto byte, externalPort int, internal net.IP) []byte {
+	payload := make([]byte, pcpMapSize)
+	copy(payload, m.nonce[:])
+	payload[12] = proto
+	binary.BigEndian.PutUint16(payload[16:], uint16(m.InternalPort))
+	binary.BigEndian.PutUint16(payload[18:], uint16(externalPort))
+	switch {
+	case m.ExternalIP != nil:
+		copy(payload[20:], m.ExternalIP.To16())
+	case internal.To4() != nil:
+		copy(payload[20:], net.IPv4zero.To16())
+	}
+	return payload
+}
+
+// pcpParseMap fills in m with the external address, port and lifetime
+// granted by resp, a successful map response.
+func pcpParseMap(m *Mapping, resp []byte) {
+	m.Lifetime = time.Duration(binary.BigEndian.Uint32(resp[4:])) * time.Second
+	m.ExternalPort = int(binary.BigEndian.Uint16(resp[pcpHeaderSize+18:]))
+	m.ExternalIP = net.IP(append([]byte(nil), resp[pcpHeaderSize+20:pcpHeaderSize+36]...))
+	if ip4 := m.ExternalIP.To4(); ip4 != nil {
+		m.ExternalIP = ip4
+	}
+}
+
+// roundTrip sends the request op with lifetime and the payload built for
+// the internal address, if any, to the server with retransmissions,
+// returning the successful response to it for which match, if set,
+// returns true.
+func (c *PCPClient) roundTrip(ctx context.Context, op byte, lifetime time.Duration, payload func(internal net.IP) []byte, match func([]byte) bool) ([]byte, error) {
+	if c.Server == nil {
+		return nil, errors.New("reuse: PCP requires a server")
+	}
+	build := func(laddr *net.UDPAddr) []byte {
+		var p []byte
+		if payload != nil {
+			p = payload(laddr.IP)
+		}
+		return pcpRequest(op, lifetime, laddr.IP, p)
+	}
+	return gatewayExchange(ctx, c.Server, build, ErrPCPTimeout, func(resp []byte) (bool, error) {
+		ok, err := pcpResponse(op, resp)
+		if !ok || err != nil {
+			return false, err
+		}
+		return match == nil || match(resp), nil
+	})
+}
+
+// pcpRequest returns the request op with lifetime and payload sent from
+// the internal address.
+func pcpRequest(op byte, lifetime time.Duration, internal net.IP, payload []byte) []byte {
+	req := make([]byte, pcpHeaderSize, pcpHeaderSize+len(payload))
+	req[0], req[1] = pcpVersion, op
+	binary.BigEndian.PutUint32(req[4:], uint32(roundDuration(lifetime, time.Second)))
+	copy(req[8:], internal.To16())
+	return append(req, payload...)
+}
+
+// pcpResponse reports whether resp is a successful response to the
+// request op, returning the error reported by the server otherwise.
+func pcpResponse(op byte, resp []byte) (bool, error) {
+	// NAT-PMP servers answer with their version and result code.
+	if len(resp) >= 4 && resp[0] == natpmpVersion {
+		return false, &PCPError{Code: int(binary.BigEndian.Uint16(resp[2:]))}
+	}
+	if len(resp) < pcpHeaderSize || resp[0] != pcpVersion || resp[1] != 0x80|op {
+		return false, nil
+	}
+	if code := resp[3]; code != 0 {
+		return false, &PCPError{Code: int(code)}
+	}
+	return true, nil
+}
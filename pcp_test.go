@@ -0,0 +1,126 @@
+package reuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPCPRequest(t *testing.T) {
+	m := &Mapping{Protocol: "udp", InternalPort: 4500}
+	copy(m.nonce[:], "0123456789ab")
+	internal := net.IPv4(192, 168, 1, 2)
+	req := pcpRequest(pcpOpMap, 90*time.Minute+time.Millisecond, internal, pcpMapPayload(m, pcpProtoUDP, 4501, internal))
+
+	want := []byte{
+		pcpVersion, pcpOpMap, 0, 0,
+		0, 0, 0x15, 0x19, // 5401 seconds, rounded up
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 168, 1, 2,
+	}
+	want = append(want, "0123456789ab"...)
+	want = append(want,
+		pcpProtoUDP, 0, 0, 0,
+		0x11, 0x94, 0x11, 0x95,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0, 0, 0, 0,
+	)
+	if !bytes.Equal(req, want) {
+		t.Errorf("pcpRequest() =\n% x\nwant\n% x", req, want)
+	}
+}
+
+func TestPCPMapPayloadSuggestedAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		external net.IP
+		internal net.IP
+		want     net.IP
+	}{
+		{name: "ipv4 internal", internal: net.IPv4(192, 168, 1, 2), want: net.ParseIP("::ffff:0.0.0.0")},
+		{name: "ipv6 internal", internal: net.ParseIP("2001:db8::2"), want: net.IPv6unspecified},
+		{name: "previous ipv4", external: net.IPv4(203, 0, 113, 1).To4(), internal: net.IPv4(192, 168, 1, 2), want: net.IPv4(203, 0, 113, 1)},
+		{name: "previous ipv6", external: net.ParseIP("2001:db8::1"), internal: net.ParseIP("2001:db8::2"), want: net.ParseIP("2001:db8::1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Mapping{Protocol: "tcp", ExternalIP: tt.external}
+			p := pcpMapPayload(m, pcpProtoTCP, 0, tt.internal)
+			if len(p) != pcpMapSize {
+				t.Fatalf("len(payload) = %d, want %d", len(p), pcpMapSize)
+			}
+			if got := net.IP(p[20:36]); !bytes.Equal(got, tt.want.To16()) {
+				t.Errorf("suggested address = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// pcpMapResponse returns a map response with result code, lifetime and
+// the external address and port for the nonce.
+func pcpMapResponse(code byte, lifetime uint32, nonce string, port uint16, ip net.IP) []byte {
+	resp := make([]byte, pcpHeaderSize+pcpMapSize)
+	resp[0], resp[1], resp[3] = pcpVersion, 0x80|pcpOpMap, code
+	binary.BigEndian.PutUint32(resp[4:], lifetime)
+	copy(resp[pcpHeaderSize:], nonce)
+	resp[pcpHeaderSize+12] = pcpProtoTCP
+	binary.BigEndian.PutUint16(resp[pcpHeaderSize+18:], port)
+	copy(resp[pcpHeaderSize+20:], ip.To16())
+	return resp
+}
+
+func TestPCPResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		op   byte
+		resp []byte
+		ok   bool
+		code int
+	}{
+		{name: "success", op: pcpOpMap, resp: pcpMapResponse(0, 7200, "0123456789ab", 4501, net.IPv4(203, 0, 113, 1)), ok: true},
+		{name: "error", op: pcpOpMap, resp: pcpMapResponse(8, 0, "0123456789ab", 0, nil), code: 8},
+		{name: "other opcode", op: pcpOpAnnounce, resp: pcpMapResponse(0, 7200, "0123456789ab", 4501, nil)},
+		{name: "request", op: pcpOpMap, resp: pcpRequest(pcpOpMap, 0, net.IPv4(192, 168, 1, 2), nil)},
+		{name: "short", op: pcpOpMap, resp: pcpMapResponse(0, 7200, "", 0, nil)[:pcpHeaderSize-1]},
+		{name: "nat-pmp", op: pcpOpMap, resp: []byte{natpmpVersion, 0x80, 0, 1}, code: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := pcpResponse(tt.op, tt.resp)
+			if ok != tt.ok {
+				t.Errorf("pcpResponse() ok = %v, want %v", ok, tt.ok)
+			}
+			var pe *PCPError
+			switch {
+			case tt.code == 0 && err != nil:
+				t.Errorf("pcpResponse() error = %v", err)
+			case tt.code != 0 && (!errors.As(err, &pe) || pe.Code != tt.code):
+				t.Errorf("pcpResponse() error = %v, want code %d", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestPCPParseMap(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   net.IP
+		want string
+	}{
+		{name: "ipv4", ip: net.IPv4(203, 0, 113, 1), want: "203.0.113.1"},
+		{name: "ipv6", ip: net.ParseIP("2001:db8::1"), want: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Mapping
+			pcpParseMap(&m, pcpMapResponse(0, 7200, "0123456789ab", 4501, tt.ip))
+			if m.ExternalIP.String() != tt.want || m.ExternalPort != 4501 || m.Lifetime != 2*time.Hour {
+				t.Errorf("pcpParseMap() = %v:%d for %v, want %s:4501 for 2h0m0s", m.ExternalIP, m.ExternalPort, m.Lifetime, tt.want)
+			}
+			if tt.ip.To4() != nil && len(m.ExternalIP) != net.IPv4len {
+				t.Errorf("len(ExternalIP) = %d, want %d", len(m.ExternalIP), net.IPv4len)
+			}
+		})
+	}
+}
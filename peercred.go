@@ -0,0 +1,33 @@
+package reuse
+
+import (
+	"syscall"
+)
+
+// PeerCredentials are the credentials of the process at the other end of
+// a unix socket connection, as of when it connected or listened.
+type PeerCredentials struct {
+	// PID is the process ID of the peer, -1 if the platform does not
+	// report it.
+	PID int
+	UID int
+	GID int
+}
+
+// PeerCred returns the credentials of the peer of c, a unix socket
+// connection such as a *net.UnixConn accepted from a ListenUnix listener,
+// so that local control sockets authorize their clients. It reads
+// SO_PEERCRED on Linux and LOCAL_PEERCRED on Darwin and FreeBSD, the
+// other platforms failing with ErrOptionUnsupported.
+func PeerCred(c syscall.Conn) (*PeerCredentials, error) {
+	var cred *PeerCredentials
+	err := sockControl(c, func(fd uintptr) error {
+		var err error
+		cred, err = peerCred(fd)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
@@ -0,0 +1,18 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package reuse
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// xucredPeer returns the credentials of a struct xucred, whose first
+// group is the effective group ID.
+func xucredPeer(xucred *unix.Xucred, pid int) *PeerCredentials {
+	cred := &PeerCredentials{PID: pid, UID: int(xucred.Uid), GID: -1}
+	if xucred.Ngroups > 0 {
+		cred.GID = int(xucred.Groups[0])
+	}
+	return cred
+}
@@ -0,0 +1,19 @@
+package reuse
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func peerCred(fd uintptr) (*PeerCredentials, error) {
+	xucred, err := unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	if err != nil {
+		return nil, os.NewSyscallError("getsockopt", err)
+	}
+	pid, err := unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	if err != nil {
+		return nil, os.NewSyscallError("getsockopt", err)
+	}
+	return xucredPeer(xucred, pid), nil
+}
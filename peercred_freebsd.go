@@ -0,0 +1,17 @@
+package reuse
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func peerCred(fd uintptr) (*PeerCredentials, error) {
+	xucred, err := unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	if err != nil {
+		return nil, os.NewSyscallError("getsockopt", err)
+	}
+	// The process ID shares a union of struct xucred that x/sys/unix
+	// does not expose.
+	return xucredPeer(xucred, -1), nil
+}
@@ -0,0 +1,15 @@
+package reuse
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func peerCred(fd uintptr) (*PeerCredentials, error) {
+	ucred, err := unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return nil, os.NewSyscallError("getsockopt", err)
+	}
+	return &PeerCredentials{PID: int(ucred.Pid), UID: int(ucred.Uid), GID: int(ucred.Gid)}, nil
+}
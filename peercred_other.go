@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package reuse
+
+func peerCred(fd uintptr) (*PeerCredentials, error) {
+	return nil, unsupportedOption("SO_PEERCRED")
+}
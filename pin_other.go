@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+func allowedCPUs() ([]int, error) {
+	return nil, unsupportedOption("SO_INCOMING_CPU")
+}
+
+func pinThread(cpu int) error {
+	return unsupportedOption("sched_setaffinity")
+}
@@ -0,0 +1,129 @@
+package reuse
+
+import (
+	"net"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// maxPktInfoPeers bounds the number of peers a PktInfoConn remembers the
+// destination address for.
+const maxPktInfoPeers = 4096
+
+// PktInfoConn wraps a packet conn bound to a wildcard address, typically
+// returned by ListenPacket, to reply from the address the datagrams of a
+// peer were sent to. On multihomed hosts the replies of a plain wildcard
+// socket leave from the address of the outgoing route instead, which the
+// peer does not recognize.
+//
+// It relies on IP_PKTINFO and IPV6_RECVPKTINFO or their platform
+// equivalent.
+type PktInfoConn struct {
+	net.PacketConn
+	v4 *ipv4.PacketConn
+	v6 *ipv6.PacketConn
+
+	// v4m sends the IPv4-mapped traffic of IPv6 sockets, which takes
+	// IPv4 control messages.
+	v4m *ipv4.PacketConn
+
+	mu   sync.Mutex
+	dsts map[string]pktInfo
+}
+
+type pktInfo struct {
+	dst     net.IP
+	ifIndex int
+}
+
+// NewPktInfoConn enables the packet information control messages on c
+// and returns a PktInfoConn wrapping it.
+func NewPktInfoConn(c net.PacketConn) (*PktInfoConn, error) {
+	pc := &PktInfoConn{
+		PacketConn: c,
+		dsts:       make(map[string]pktInfo),
+	}
+	if ipv4Conn(c) {
+		pc.v4 = ipv4.NewPacketConn(c)
+		if err := pc.v4.SetControlMessage(ipv4.FlagDst|ipv4.FlagInterface, true); err != nil {
+			return nil, err
+		}
+		return pc, nil
+	}
+	pc.v6 = ipv6.NewPacketConn(c)
+	pc.v4m = ipv4.NewPacketConn(c)
+	if err := pc.v6.SetControlMessage(ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
+
+// ReadFromDst reads a datagram into b, returning the number of bytes
+// read, the source address and the local address the datagram was sent
+// to.
+func (c *PktInfoConn) ReadFromDst(b []byte) (n int, addr net.Addr, dst net.IP, err error) {
+	var info pktInfo
+	if c.v4 != nil {
+		var cm *ipv4.ControlMessage
+		n, cm, addr, err = c.v4.ReadFrom(b)
+		if cm != nil {
+			info = pktInfo{dst: cm.Dst, ifIndex: cm.IfIndex}
+		}
+	} else {
+		var cm *ipv6.ControlMessage
+		n, cm, addr, err = c.v6.ReadFrom(b)
+		if cm != nil {
+			info = pktInfo{dst: cm.Dst, ifIndex: cm.IfIndex}
+		}
+	}
+	if err != nil {
+		return n, addr, nil, err
+	}
+
+	if info.dst != nil && addr != nil {
+		c.mu.Lock()
+		if len(c.dsts) >= maxPktInfoPeers {
+			c.dsts = make(map[string]pktInfo)
+		}
+		c.dsts[addr.String()] = info
+		c.mu.Unlock()
+	}
+	return n, addr, info.dst, nil
+}
+
+// ReadFrom reads a datagram into b, remembering the local address it was
+// sent to for the replies to its source. see net.PacketConn.ReadFrom
+func (c *PktInfoConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, _, err := c.ReadFromDst(b)
+	return n, addr, err
+}
+
+// WriteTo writes a datagram to addr from the local address the last
+// datagram read from addr was sent to, or from the address selected by
+// the system if none was read. see net.PacketConn.WriteTo
+func (c *PktInfoConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	info, ok := c.dsts[addr.String()]
+	c.mu.Unlock()
+	if !ok {
+		return c.PacketConn.WriteTo(b, addr)
+	}
+	return c.writeTo(b, addr, info)
+}
+
+// WriteToFrom writes a datagram to addr from the local address src.
+func (c *PktInfoConn) WriteToFrom(b []byte, addr net.Addr, src net.IP) (int, error) {
+	return c.writeTo(b, addr, pktInfo{dst: src})
+}
+
+func (c *PktInfoConn) writeTo(b []byte, addr net.Addr, info pktInfo) (int, error) {
+	if c.v4 != nil {
+		return c.v4.WriteTo(b, &ipv4.ControlMessage{Src: info.dst, IfIndex: info.ifIndex}, addr)
+	}
+	if info.dst.To4() != nil {
+		return c.v4m.WriteTo(b, &ipv4.ControlMessage{Src: info.dst, IfIndex: info.ifIndex}, addr)
+	}
+	return c.v6.WriteTo(b, &ipv6.ControlMessage{Src: info.dst, IfIndex: info.ifIndex}, addr)
+}
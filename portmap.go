@@ -0,0 +1,125 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// mapperProbeTimeout bounds the probing of each port mapping protocol by
+// DiscoverMapper.
+const mapperProbeTimeout = 2 * time.Second
+
+// ErrNoPortMapper is returned when the gateway speaks none of the port
+// mapping protocols supported by this package.
+var ErrNoPortMapper = errors.New("reuse: no port mapping protocol available on the gateway")
+
+// Mapper maps ports of the gateway of the host to ports of the host,
+// making the listeners of the host reachable from outside its NAT.
+type Mapper interface {
+	// ExternalIP returns the external address of the gateway.
+	ExternalIP(ctx context.Context) (net.IP, error)
+
+	// MapPort maps externalPort, or another port chosen by the gateway
+	// if it is not available or 0, to internalPort for protocol, "tcp"
+	// or "udp", for lifetime.
+	MapPort(ctx context.Context, protocol string, internalPort, externalPort int, lifetime time.Duration) (*Mapping, error)
+
+	// UnmapPort deletes the mapping m.
+	UnmapPort(ctx context.Context, m *Mapping) error
+}
+
+// Mapping is a port mapping created by a Mapper.
+type Mapping struct {
+	// Protocol is the protocol mapped, "tcp" or "udp".
+	Protocol string
+
+	// InternalPort is the port of the host.
+	InternalPort int
+
+	// ExternalIP is the external address of the gateway.
+	ExternalIP net.IP
+
+	// ExternalPort is the port of the gateway.
+	ExternalPort int
+
+	// Lifetime is the lifetime granted by the gateway, which may differ
+	// from the one requested.
+	Lifetime time.Duration
+
+	// nonce identifies PCP mappings.
+	nonce [12]byte
+}
+
+// ExternalAddr returns the external address and port of m.
+func (m *Mapping) ExternalAddr() net.Addr {
+	if m.Protocol == "tcp" {
+		return &net.TCPAddr{IP: m.ExternalIP, Port: m.ExternalPort}
+	}
+	return &net.UDPAddr{IP: m.ExternalIP, Port: m.ExternalPort}
+}
+
+// DiscoverMapper returns a Mapper for the default gateway of the host,
+// using PCP or, for gateways predating it, NAT-PMP. UPnP IGD is not
+// supported.
+func DiscoverMapper(ctx context.Context) (Mapper, error) {
+	gw, err := defaultGateway()
+	if err != nil {
+		return nil, err
+	}
+	mappers := []Mapper{
+		&PCPClient{Server: gw},
+		&NATPMPClient{Gateway: gw},
+	}
+	for _, m := range mappers {
+		pctx, cancel := context.WithTimeout(ctx, mapperProbeTimeout)
+		err := probeMapper(pctx, m)
+		cancel()
+		if err == nil {
+			return m, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, ErrNoPortMapper
+}
+
+// probeMapper checks that the gateway of m speaks its protocol.
+func probeMapper(ctx context.Context, m Mapper) error {
+	if p, ok := m.(interface{ probe(context.Context) error }); ok {
+		return p.probe(ctx)
+	}
+	_, err := m.ExternalIP(ctx)
+	return err
+}
+
+// MapPort maps the same port of the default gateway as the port of
+// addr, the address of a TCP or UDP listener typically created by Listen
+// or ListenPacket, or another port chosen by the gateway, for lifetime.
+// see DiscoverMapper
+func MapPort(ctx context.Context, addr net.Addr, lifetime time.Duration) (*Mapping, error) {
+	protocol, port, err := mappedPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	m, err := DiscoverMapper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.MapPort(ctx, protocol, port, port, lifetime)
+}
+
+// mappedPort returns the protocol and port of the TCP or UDP address
+// addr.
+func mappedPort(addr net.Addr) (string, int, error) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return "tcp", a.Port, nil
+	case *net.UDPAddr:
+		return "udp", a.Port, nil
+	}
+	return "", 0, fmt.Errorf("reuse: cannot map the port of %s address %s", addr.Network(), addr)
+}
@@ -0,0 +1,133 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Defaults of PortPredictor.
+const (
+	defaultPredictProbes = 5
+	defaultPredictions   = 8
+)
+
+// PortPredictor predicts the external ports a NAT with a mapping per
+// destination, see NATType.Symmetric, allocates to the next sockets
+// opened, so that a peer punching a hole towards such a NAT can send to
+// the predicted ports rather than to the reflexive address learnt by the
+// socket through STUN, which is only valid for the STUN server.
+//
+// The zero value for Probes and Predictions selects their default.
+type PortPredictor struct {
+	// STUNServer is the STUN server the mappings are observed through.
+	STUNServer string
+
+	// Probes is the number of probe sockets opened in a burst, 5 by
+	// default.
+	Probes int
+
+	// Predictions is the number of ports predicted, 8 by default.
+	Predictions int
+
+	// Options are the socket options applied to the probe sockets.
+	Options []Option
+}
+
+// PortPrediction is the allocation pattern observed by a PortPredictor.
+type PortPrediction struct {
+	// IP is the external address of the NAT.
+	IP net.IP
+
+	// Observed are the external ports mapped for the probe sockets, in
+	// the order they were opened.
+	Observed []int
+
+	// Delta is the step between consecutive ports allocated by the NAT,
+	// or 0 if the allocation looks random.
+	Delta int
+
+	// Predicted are the ports likely allocated to the next sockets, in
+	// order, empty if the allocation looks random.
+	Predicted []int
+}
+
+// Predict opens a burst of sockets on the given UDP network, learns the
+// mapping of each through STUN, and extrapolates the most common step
+// between consecutive ports. The probe sockets are closed on return, the
+// socket used for punching should be opened right after to get the first
+// predicted port before other hosts behind the NAT take it.
+func (p *PortPredictor) Predict(ctx context.Context, network string) (*PortPrediction, error) {
+	if p.STUNServer == "" {
+		return nil, errors.New("reuse: port prediction requires a STUN server")
+	}
+	probes, predictions := p.Probes, p.Predictions
+	if probes <= 0 {
+		probes = defaultPredictProbes
+	}
+	if predictions <= 0 {
+		predictions = defaultPredictions
+	}
+
+	res := &PortPrediction{}
+	for i := 0; i < probes; i++ {
+		pc, err := ListenPacketContext(ctx, network, ":0", p.Options...)
+		if err != nil {
+			return nil, err
+		}
+		c := NewSTUNConn(pc)
+		mapped, err := c.Binding(ctx, p.STUNServer)
+		// Keep the probe mapped until the burst is over, so that the
+		// NAT does not reuse its port for the next probe.
+		defer c.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.IP == nil {
+			res.IP = mapped.IP
+		}
+		res.Observed = append(res.Observed, mapped.Port)
+	}
+
+	res.Delta = allocationStep(res.Observed)
+	if res.Delta == 0 {
+		return res, nil
+	}
+	port := res.Observed[len(res.Observed)-1]
+	for i := 0; i < predictions; i++ {
+		port = wrapPort(port + res.Delta)
+		res.Predicted = append(res.Predicted, port)
+	}
+	return res, nil
+}
+
+// allocationStep returns the most common step between consecutive ports
+// if it accounts for at least half of the steps, or 0 otherwise.
+func allocationStep(ports []int) int {
+	counts := make(map[int]int)
+	best, bestCount := 0, 0
+	for i := 1; i < len(ports); i++ {
+		d := ports[i] - ports[i-1]
+		counts[d]++
+		if counts[d] > bestCount {
+			best, bestCount = d, counts[d]
+		}
+	}
+	if bestCount == 0 || 2*bestCount < len(ports)-1 {
+		return 0
+	}
+	return best
+}
+
+// wrapPort wraps port into the range of non privileged ports, as NATs do
+// when allocating past either end.
+func wrapPort(port int) int {
+	const lo, hi = 1024, 65535
+	for port > hi {
+		port -= hi - lo + 1
+	}
+	for port < lo {
+		port += hi - lo + 1
+	}
+	return port
+}
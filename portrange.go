@@ -0,0 +1,99 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrPortRangeExhausted is returned by a PortRangeDialer when every port
+// of its range is already connected to the destination.
+var ErrPortRangeExhausted = errors.New("reuse: local port range exhausted")
+
+// PortRangeDialer dials from the local ports of a range in rotation, with
+// port reuse, so that a client opens more connections to a destination
+// than the ephemeral port range of the system allows, or from ports a
+// firewall expects:
+//
+//	d := &reuse.PortRangeDialer{MinPort: 40000, MaxPort: 40999}
+//	c, err := d.Dial("tcp", "192.0.2.1:443")
+//
+// The ports whose 4-tuple with the destination is in use, by a
+// connection or one lingering in TIME_WAIT, are skipped.
+type PortRangeDialer struct {
+	// IP is the local IP address, the unspecified address by default.
+	IP net.IP
+
+	// Zone is the zone of IP if it is an IPv6 link-local address.
+	Zone string
+
+	// MinPort and MaxPort are the first and the last local ports of the
+	// range.
+	MinPort int
+	MaxPort int
+
+	// Timeout bounds each attempt, without limit by default.
+	Timeout time.Duration
+
+	// Options are the socket options applied to every dialed socket.
+	Options []Option
+
+	mu   sync.Mutex
+	next int
+}
+
+// Dial connects to the address on the named network. see
+// PortRangeDialer.DialContext
+func (d *PortRangeDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network, a TCP or UDP
+// network, from the next port of the range, using the provided context.
+func (d *PortRangeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !tcp(network) && !udp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	if d.MinPort <= 0 || d.MaxPort < d.MinPort || d.MaxPort > 65535 {
+		return nil, fmt.Errorf("reuse: invalid local port range %d-%d", d.MinPort, d.MaxPort)
+	}
+
+	cfg := newConfig(d.Options)
+	var laddr net.Addr
+	for i := d.MinPort; i <= d.MaxPort; i++ {
+		port := d.claim()
+		if tcp(network) {
+			laddr = &net.TCPAddr{IP: d.IP, Port: port, Zone: d.Zone}
+		} else {
+			laddr = &net.UDPAddr{IP: d.IP, Port: port, Zone: d.Zone}
+		}
+		nd := cfg.dialer(laddr)
+		nd.Timeout = d.Timeout
+		conn, err := cfg.dial(ctx, nd, network, address)
+		if err == nil {
+			return conn, nil
+		}
+		if !errors.Is(err, errAddrNotAvail) && !errors.Is(err, errAddrInUse) {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	return nil, &net.OpError{Op: "dial", Net: network, Source: laddr, Err: ErrPortRangeExhausted}
+}
+
+// claim returns the next port of the range.
+func (d *PortRangeDialer) claim() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.next < d.MinPort || d.next > d.MaxPort {
+		d.next = d.MinPort
+	}
+	port := d.next
+	d.next++
+	return port
+}
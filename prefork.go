@@ -0,0 +1,170 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// preforkEnv marks the worker processes started by Prefork, holding
+	// the index of the worker.
+	preforkEnv = "REUSE_PREFORK_WORKER"
+	// preforkListenerFd is the descriptor of the listener inherited by
+	// the workers, the first of the extra files.
+	preforkListenerFd = 3
+	// defaultPreforkRestartDelay is the delay before restarting a worker.
+	defaultPreforkRestartDelay = time.Second
+)
+
+// ErrPreforkUnsupported is returned by Prefork on platforms lacking
+// descriptor inheritance.
+var ErrPreforkUnsupported = errors.New("reuse: prefork not supported on this platform")
+
+// Prefork runs a server in several worker processes sharing a port: the
+// parent process binds a listener with port reuse per worker, so that the
+// kernel balances the connections between them, and starts the workers,
+// running the executable of the parent with its arguments, which inherit
+// their listener and serve it. Workers exiting are restarted.
+//
+//	p := &reuse.Prefork{Network: "tcp", Address: ":8080"}
+//	log.Fatal(p.Run(0, func(l net.Listener) {
+//		http.Serve(l, handler)
+//	}))
+//
+// The zero value for each field selects its default.
+type Prefork struct {
+	// Network and Address are the network and address listened on.
+	Network string
+	Address string
+
+	// Options are the socket options of the listeners.
+	Options []Option
+
+	// RestartDelay is the delay before restarting a worker that exited,
+	// 1s by default.
+	RestartDelay time.Duration
+
+	// OnExit is called with the errors of the workers exiting.
+	OnExit func(worker int, err error)
+}
+
+// IsPreforkWorker reports whether the process is a worker started by
+// Prefork.
+func IsPreforkWorker() bool {
+	return os.Getenv(preforkEnv) != ""
+}
+
+// Run runs serve in workers processes, one per CPU if workers is 0. In
+// the parent it returns on error only, in the workers it calls serve
+// with the inherited listener and returns once it returns. see
+// RunContext
+func (p *Prefork) Run(workers int, serve func(net.Listener)) error {
+	return p.RunContext(context.Background(), workers, serve)
+}
+
+// RunContext is like Run, but stops the workers, with SIGTERM where
+// supported, and returns once they exited when ctx is done.
+func (p *Prefork) RunContext(ctx context.Context, workers int, serve func(net.Listener)) error {
+	if IsPreforkWorker() {
+		return p.worker(serve)
+	}
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" || runtime.GOOS == "js" {
+		return ErrPreforkUnsupported
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	files := make([]*os.File, 0, workers)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	address := p.Address
+	for i := 0; i < workers; i++ {
+		l, err := Listen(p.Network, address, p.Options...)
+		if err != nil {
+			return err
+		}
+		// Bind all the listeners to the port of the first one.
+		address = l.Addr().String()
+		f, err := ExportFile(l)
+		l.Close()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	var wg sync.WaitGroup
+	for i, f := range files {
+		wg.Add(1)
+		go func(i int, f *os.File) {
+			defer wg.Done()
+			p.supervise(ctx, exe, i, f)
+		}(i, f)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// supervise runs the worker i until ctx is done, restarting it when it
+// exits.
+func (p *Prefork) supervise(ctx context.Context, exe string, i int, f *os.File) {
+	delay := p.RestartDelay
+	if delay <= 0 {
+		delay = defaultPreforkRestartDelay
+	}
+	for ctx.Err() == nil {
+		cmd := exec.Command(exe, os.Args[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		cmd.Env = append(os.Environ(), preforkEnv+"="+strconv.Itoa(i))
+		cmd.ExtraFiles = []*os.File{f}
+		err := cmd.Start()
+		if err == nil {
+			stop := context.AfterFunc(ctx, func() {
+				if cmd.Process.Signal(syscall.SIGTERM) != nil {
+					cmd.Process.Kill()
+				}
+			})
+			err = cmd.Wait()
+			stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if p.OnExit != nil {
+			p.OnExit(i, err)
+		}
+		sleepUntil(ctx, time.Now().Add(delay))
+	}
+}
+
+// worker serves the listener inherited from the parent.
+func (p *Prefork) worker(serve func(net.Listener)) error {
+	f := os.NewFile(preforkListenerFd, "prefork-listener")
+	if f == nil {
+		return errors.New("reuse: prefork listener missing")
+	}
+	l, err := ListenerFromFile(f, p.Options...)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	serve(l)
+	return nil
+}
@@ -0,0 +1,390 @@
+package reuse
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSniffTimeout bounds the reading of the first bytes of the
+	// connections by a ProtocolMux.
+	defaultSniffTimeout = 5 * time.Second
+	// protoMuxBacklog is the number of matched connections waiting to be
+	// accepted per sub-listener.
+	protoMuxBacklog = 16
+)
+
+// ErrProtocolMuxClosed is returned by the sub-listeners of a closed
+// ProtocolMux.
+var ErrProtocolMuxClosed = errors.New("reuse: protocol mux closed")
+
+var errProtoMuxBacklog = errors.New("reuse: protocol mux backlog full")
+
+// Matcher reports whether a connection speaks a protocol, reading its
+// first bytes from r. The bytes read are replayed to the next matchers
+// and to the reader of the connection.
+type Matcher func(r io.Reader) bool
+
+// ProtocolMux shares a listener, typically returned by Listen, between
+// several protocols: it reads the first bytes of each connection accepted
+// and hands the connection to the first sub-listener whose matchers
+// recognize them, so that TLS, HTTP, SSH or custom protocols share one
+// port within a process.
+//
+//	m := reuse.NewProtocolMux(l)
+//	tlsL := m.Match(reuse.MatchTLS())
+//	httpL := m.Match(reuse.MatchHTTP1(), reuse.MatchHTTP2())
+//	anyL := m.Match(reuse.MatchAny())
+//	go m.Serve()
+//
+// Protocols whose server speaks first cannot be recognized, except by
+// MatchAny. The connections no sub-listener matches are closed, as are
+// those of a sub-listener whose backlog is full.
+type ProtocolMux struct {
+	// SniffTimeout bounds the reading of the first bytes of the
+	// connections, 5s by default.
+	SniffTimeout time.Duration
+
+	// OnError is called with the errors of the connections that could not
+	// be matched.
+	OnError func(conn net.Conn, err error)
+
+	l    net.Listener
+	mu   sync.Mutex
+	subs []*protoListener
+	done chan struct{}
+	once sync.Once
+}
+
+// NewProtocolMux returns a ProtocolMux accepting from l, once Serve is
+// called. The ProtocolMux owns l, closing it when closed.
+func NewProtocolMux(l net.Listener) *ProtocolMux {
+	return &ProtocolMux{l: l, done: make(chan struct{})}
+}
+
+// Match returns a sub-listener accepting the connections recognized by
+// any of matchers. Sub-listeners are tried in the order of Match.
+func (m *ProtocolMux) Match(matchers ...Matcher) net.Listener {
+	sub := &protoListener{
+		m:        m,
+		matchers: matchers,
+		accept:   make(chan net.Conn, protoMuxBacklog),
+		done:     make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.subs = append(m.subs, sub)
+	m.mu.Unlock()
+	select {
+	case <-m.done:
+		sub.closeQueued()
+	default:
+	}
+	return sub
+}
+
+// Serve accepts connections and routes them until the listener is closed
+// or fails permanently, returning its error. The temporary errors, such
+// as running out of file descriptors, are retried with a backoff.
+func (m *ProtocolMux) Serve() error {
+	var delay time.Duration
+	for {
+		conn, err := m.l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || acceptPermanent(err) {
+				m.shutdown()
+				return err
+			}
+			if delay == 0 {
+				delay = minAcceptDelay
+			} else if delay *= 2; delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-m.done:
+				t.Stop()
+				return err
+			}
+			continue
+		}
+		delay = 0
+		go m.route(conn)
+	}
+}
+
+// Close closes the listener and the sub-listeners.
+func (m *ProtocolMux) Close() error {
+	m.shutdown()
+	return m.l.Close()
+}
+
+func (m *ProtocolMux) shutdown() {
+	m.once.Do(func() {
+		close(m.done)
+		m.mu.Lock()
+		subs := m.subs
+		m.mu.Unlock()
+		for _, sub := range subs {
+			sub.closeQueued()
+		}
+	})
+}
+
+// route sniffs conn and hands it to the first matching sub-listener.
+func (m *ProtocolMux) route(conn net.Conn) {
+	timeout := m.SniffTimeout
+	if timeout <= 0 {
+		timeout = defaultSniffTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	s := &sniffer{r: conn}
+	m.mu.Lock()
+	subs := m.subs
+	m.mu.Unlock()
+
+	for _, sub := range subs {
+		if !sub.match(s) {
+			continue
+		}
+		conn.SetReadDeadline(time.Time{})
+		switch err := sub.queue(&muxConn{Conn: conn, buf: bytes.NewReader(s.buf)}); err {
+		case nil:
+		case errProtoMuxBacklog:
+			m.fail(conn, err)
+		default:
+			conn.Close()
+		}
+		return
+	}
+	err := s.err
+	if err == nil || errors.Is(err, io.EOF) {
+		err = errors.New("reuse: no protocol matched")
+	}
+	m.fail(conn, err)
+}
+
+func (m *ProtocolMux) fail(conn net.Conn, err error) {
+	if m.OnError != nil {
+		m.OnError(conn, err)
+	}
+	conn.Close()
+}
+
+// protoListener is a sub-listener of a ProtocolMux.
+type protoListener struct {
+	m        *ProtocolMux
+	matchers []Matcher
+	accept   chan net.Conn
+	done     chan struct{}
+	once     sync.Once
+
+	// mu orders the queuing of the connections with their closing.
+	mu     sync.Mutex
+	closed bool
+}
+
+// queue queues conn to be accepted, failing once l or its ProtocolMux is
+// closed or if the backlog is full.
+func (l *protoListener) queue(conn net.Conn) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return net.ErrClosed
+	}
+	select {
+	case l.accept <- conn:
+		return nil
+	default:
+		return errProtoMuxBacklog
+	}
+}
+
+// closeQueued closes the connections queued and those routed to l from
+// now on.
+func (l *protoListener) closeQueued() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	for {
+		select {
+		case conn := <-l.accept:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (l *protoListener) match(s *sniffer) bool {
+	for _, match := range l.matchers {
+		s.pos = 0
+		if match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *protoListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	case <-l.m.done:
+		return nil, ErrProtocolMuxClosed
+	}
+}
+
+// Close stops the sub-listener, without closing the ProtocolMux, and
+// closes the connections it did not accept.
+func (l *protoListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+		l.closeQueued()
+	})
+	return nil
+}
+
+func (l *protoListener) Addr() net.Addr {
+	return l.m.l.Addr()
+}
+
+// sniffer records the bytes read from r to replay them from pos.
+type sniffer struct {
+	r   io.Reader
+	buf []byte
+	pos int
+	err error
+}
+
+func (s *sniffer) Read(b []byte) (int, error) {
+	if s.pos < len(s.buf) {
+		n := copy(b, s.buf[s.pos:])
+		s.pos += n
+		return n, nil
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.r.Read(b)
+	s.buf = append(s.buf, b[:n]...)
+	s.pos += n
+	s.err = err
+	return n, err
+}
+
+// muxConn replays the bytes read by the matchers before reading from the
+// connection.
+type muxConn struct {
+	net.Conn
+	buf *bytes.Reader
+}
+
+func (c *muxConn) Read(b []byte) (int, error) {
+	if c.buf.Len() > 0 {
+		return c.buf.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// MatchAny matches any connection.
+func MatchAny() Matcher {
+	return func(r io.Reader) bool {
+		return true
+	}
+}
+
+// MatchPrefix matches the connections starting with one of prefixes.
+func MatchPrefix(prefixes ...string) Matcher {
+	return func(r io.Reader) bool {
+		return matchPrefix(r, func(b []byte) (bool, bool) {
+			more := false
+			for _, p := range prefixes {
+				if strings.HasPrefix(p, string(b)) {
+					if len(b) == len(p) {
+						return true, false
+					}
+					more = true
+				}
+			}
+			return false, more
+		})
+	}
+}
+
+// matchPrefix reads r byte by byte while check reports that more bytes
+// are needed, stopping as soon as the bytes read cannot match so that
+// short messages do not wait for the sniff timeout.
+func matchPrefix(r io.Reader, check func(b []byte) (match, more bool)) bool {
+	var b []byte
+	one := make([]byte, 1)
+	for {
+		match, more := check(b)
+		if match || !more {
+			return match
+		}
+		if _, err := io.ReadFull(r, one); err != nil {
+			return false
+		}
+		b = append(b, one[0])
+	}
+}
+
+// MatchTLS matches TLS connections, starting with a handshake record.
+func MatchTLS() Matcher {
+	return func(r io.Reader) bool {
+		return matchPrefix(r, func(b []byte) (bool, bool) {
+			switch {
+			case len(b) > 0 && b[0] != 0x16:
+				return false, false
+			case len(b) > 1 && b[1] != 0x03:
+				return false, false
+			case len(b) > 2:
+				return b[2] <= 0x04, false
+			}
+			return false, true
+		})
+	}
+}
+
+// httpMethods are the methods recognized by MatchHTTP1.
+var httpMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"}
+
+// MatchHTTP1 matches HTTP/1 connections, starting with a request line of
+// a standard method.
+func MatchHTTP1() Matcher {
+	return func(r io.Reader) bool {
+		return matchPrefix(r, func(b []byte) (bool, bool) {
+			for _, m := range httpMethods {
+				if string(b) == m+" " {
+					return true, false
+				}
+				if strings.HasPrefix(m+" ", string(b)) {
+					return false, true
+				}
+			}
+			return false, false
+		})
+	}
+}
+
+// MatchHTTP2 matches HTTP/2 connections with prior knowledge, starting
+// with the client connection preface. HTTP/2 over TLS is matched by
+// MatchTLS.
+func MatchHTTP2() Matcher {
+	return MatchPrefix("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+}
+
+// MatchSSH matches SSH connections, starting with the identification
+// string of the client.
+func MatchSSH() Matcher {
+	return MatchPrefix("SSH-")
+}
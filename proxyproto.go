@@ -0,0 +1,313 @@
+package reuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol, see
+// https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+const (
+	proxyV1Prefix  = "PROXY "
+	proxyV1MaxSize = 107
+
+	proxyV2HeaderSize = 16
+	proxyV2Version    = 0x20
+	proxyV2Local      = 0x00
+	proxyV2Proxy      = 0x01
+
+	proxyV2Unspec = 0x00
+	proxyV2TCP4   = 0x11
+	proxyV2UDP4   = 0x12
+	proxyV2TCP6   = 0x21
+	proxyV2UDP6   = 0x22
+
+	// proxyHeaderTimeout bounds the reading of the PROXY protocol header
+	// of the accepted connections.
+	proxyHeaderTimeout = 5 * time.Second
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrProxyHeader is returned when a connection does not start with a
+// valid PROXY protocol header.
+var ErrProxyHeader = errors.New("reuse: invalid PROXY protocol header")
+
+// ProxyHeader is a PROXY protocol header, carrying the addresses of a
+// connection relayed by a proxy.
+type ProxyHeader struct {
+	// Version is the version of the header, 1 for the text format and 2
+	// for the binary format. The zero value selects version 2.
+	Version int
+
+	// Source and Destination are the TCP or UDP addresses of the client
+	// and of the server. They are nil for connections established by the
+	// proxy itself, such as health checks, and for unknown protocols.
+	Source      net.Addr
+	Destination net.Addr
+}
+
+// ReadProxyHeader reads a PROXY protocol header, version 1 or 2, from r
+// without reading past it.
+func ReadProxyHeader(r io.Reader) (*ProxyHeader, error) {
+	b := make([]byte, len(proxyV1Prefix))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	if string(b) == proxyV1Prefix {
+		return readProxyV1(r)
+	}
+	if !bytes.Equal(b, proxyV2Signature[:len(b)]) {
+		return nil, ErrProxyHeader
+	}
+	b = append(b, make([]byte, proxyV2HeaderSize-len(b))...)
+	if _, err := io.ReadFull(r, b[len(proxyV1Prefix):]); err != nil {
+		return nil, truncated(err)
+	}
+	return readProxyV2(r, b)
+}
+
+// readProxyV1 reads the rest of a text header.
+func readProxyV1(r io.Reader) (*ProxyHeader, error) {
+	var line []byte
+	c := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) > proxyV1MaxSize-len(proxyV1Prefix) {
+			return nil, ErrProxyHeader
+		}
+		if _, err := io.ReadFull(r, c); err != nil {
+			return nil, truncated(err)
+		}
+		line = append(line, c[0])
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	h := &ProxyHeader{Version: 1}
+	if fields[0] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(fields) != 5 || (fields[0] != "TCP4" && fields[0] != "TCP6") {
+		return nil, ErrProxyHeader
+	}
+	src, dst := net.ParseIP(fields[1]), net.ParseIP(fields[2])
+	sport, err1 := strconv.ParseUint(fields[3], 10, 16)
+	dport, err2 := strconv.ParseUint(fields[4], 10, 16)
+	if src == nil || dst == nil || err1 != nil || err2 != nil {
+		return nil, ErrProxyHeader
+	}
+	h.Source = &net.TCPAddr{IP: src, Port: int(sport)}
+	h.Destination = &net.TCPAddr{IP: dst, Port: int(dport)}
+	return h, nil
+}
+
+// readProxyV2 reads the rest of a binary header whose fixed part is b.
+func readProxyV2(r io.Reader, b []byte) (*ProxyHeader, error) {
+	if b[12]&0xf0 != proxyV2Version {
+		return nil, ErrProxyHeader
+	}
+	cmd, fam := b[12]&0x0f, b[13]
+	body := make([]byte, binary.BigEndian.Uint16(b[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, truncated(err)
+	}
+	h := &ProxyHeader{Version: 2}
+	if cmd == proxyV2Local {
+		return h, nil
+	}
+	if cmd != proxyV2Proxy {
+		return nil, ErrProxyHeader
+	}
+
+	var size int
+	switch fam {
+	case proxyV2TCP4, proxyV2UDP4:
+		size = net.IPv4len
+	case proxyV2TCP6, proxyV2UDP6:
+		size = net.IPv6len
+	default:
+		// Unix and unspecified addresses are not reported.
+		return h, nil
+	}
+	if len(body) < 2*size+4 {
+		return nil, ErrProxyHeader
+	}
+	src := net.IP(append([]byte(nil), body[:size]...))
+	dst := net.IP(append([]byte(nil), body[size:2*size]...))
+	sport := int(binary.BigEndian.Uint16(body[2*size:]))
+	dport := int(binary.BigEndian.Uint16(body[2*size+2:]))
+	if fam == proxyV2TCP4 || fam == proxyV2TCP6 {
+		h.Source = &net.TCPAddr{IP: src, Port: sport}
+		h.Destination = &net.TCPAddr{IP: dst, Port: dport}
+	} else {
+		h.Source = &net.UDPAddr{IP: src, Port: sport}
+		h.Destination = &net.UDPAddr{IP: dst, Port: dport}
+	}
+	return h, nil
+}
+
+// truncated returns err, io.ErrUnexpectedEOF for an io.EOF met within a
+// header.
+func truncated(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Marshal returns the encoding of h.
+func (h *ProxyHeader) Marshal() ([]byte, error) {
+	src, sport, stcp := proxyAddr(h.Source)
+	dst, dport, dtcp := proxyAddr(h.Destination)
+	known := src != nil && dst != nil
+	if known && (stcp != dtcp || (src.To4() == nil) != (dst.To4() == nil)) {
+		return nil, fmt.Errorf("reuse: PROXY header addresses %s and %s of different families", h.Source, h.Destination)
+	}
+
+	if h.Version == 1 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		if !stcp {
+			return nil, errors.New("reuse: PROXY header version 1 only carries TCP addresses")
+		}
+		fam := "TCP4"
+		if src.To4() == nil {
+			fam = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", fam, src, dst, sport, dport)), nil
+	}
+	if h.Version != 0 && h.Version != 2 {
+		return nil, fmt.Errorf("reuse: unknown PROXY header version %d", h.Version)
+	}
+
+	b := append([]byte(nil), proxyV2Signature...)
+	if !known {
+		return append(b, proxyV2Version|proxyV2Local, proxyV2Unspec, 0, 0), nil
+	}
+	var fam byte
+	switch {
+	case src.To4() != nil && stcp:
+		fam, src, dst = proxyV2TCP4, src.To4(), dst.To4()
+	case src.To4() != nil:
+		fam, src, dst = proxyV2UDP4, src.To4(), dst.To4()
+	case stcp:
+		fam, src, dst = proxyV2TCP6, src.To16(), dst.To16()
+	default:
+		fam, src, dst = proxyV2UDP6, src.To16(), dst.To16()
+	}
+	b = append(b, proxyV2Version|proxyV2Proxy, fam)
+	b = binary.BigEndian.AppendUint16(b, uint16(2*len(src)+4))
+	b = append(b, src...)
+	b = append(b, dst...)
+	b = binary.BigEndian.AppendUint16(b, uint16(sport))
+	b = binary.BigEndian.AppendUint16(b, uint16(dport))
+	return b, nil
+}
+
+func (h *ProxyHeader) write(w io.Writer) error {
+	b, err := h.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// proxyAddr returns the IP address and port of addr and whether it is a
+// TCP address.
+func proxyAddr(addr net.Addr) (net.IP, int, bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port, true
+	case *net.UDPAddr:
+		return a.IP, a.Port, false
+	}
+	return nil, 0, false
+}
+
+// proxyConn is an accepted connection starting with a PROXY protocol
+// header, read on first use within proxyHeaderTimeout.
+type proxyConn struct {
+	net.Conn
+	once sync.Once
+	hdr  *ProxyHeader
+	err  error
+
+	// deadline is the read deadline set by the user, restored once the
+	// header is read.
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *proxyConn) header() (*ProxyHeader, error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		deadline := c.deadline
+		c.mu.Unlock()
+		if t := time.Now().Add(proxyHeaderTimeout); deadline.IsZero() || t.Before(deadline) {
+			c.Conn.SetReadDeadline(t)
+		}
+		c.hdr, c.err = ReadProxyHeader(c.Conn)
+		if c.err != nil {
+			c.err = &net.OpError{Op: "read", Net: c.Conn.LocalAddr().Network(), Source: c.Conn.LocalAddr(), Addr: c.Conn.RemoteAddr(), Err: c.err}
+		}
+
+		c.mu.Lock()
+		c.Conn.SetReadDeadline(c.deadline)
+		c.mu.Unlock()
+	})
+	return c.hdr, c.err
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if _, err := c.header(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// RemoteAddr returns the address of the client carried by the header,
+// or the address of the peer if the header has none, is invalid or does
+// not arrive in time.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if h, err := c.header(); err == nil && h.Source != nil {
+		return h.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address of the server carried by the header,
+// or the local address if the header has none, is invalid or does not
+// arrive in time.
+func (c *proxyConn) LocalAddr() net.Addr {
+	if h, err := c.header(); err == nil && h.Destination != nil {
+		return h.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ProxyHeader returns the PROXY protocol header of the connection.
+func (c *proxyConn) ProxyHeader() (*ProxyHeader, error) {
+	return c.header()
+}
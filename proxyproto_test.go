@@ -0,0 +1,142 @@
+package reuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyV2 returns a version 2 header of the command and family carrying
+// body.
+func proxyV2(cmd, fam byte, body []byte) []byte {
+	b := append([]byte(nil), proxyV2Signature...)
+	b = append(b, proxyV2Version|cmd, fam)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(body)))
+	return append(b, body...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tcp4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0x30, 0x39, 0x01, 0xbb}
+	udp6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x30, 0x39, 0x01, 0xbb)
+	// A PP2_TYPE_AUTHORITY TLV and a PP2_TYPE_NOOP TLV.
+	tlvs := []byte{0x02, 0x00, 0x0b, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', 0x04, 0x00, 0x00}
+
+	tests := []struct {
+		name     string
+		in       []byte
+		src, dst string
+		err      error
+	}{
+		{name: "v1 tcp4", in: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345 443\r\n"), src: "192.0.2.1:12345", dst: "198.51.100.1:443"},
+		{name: "v1 tcp6", in: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 443\r\n"), src: "[2001:db8::1]:12345", dst: "[2001:db8::2]:443"},
+		{name: "v1 unknown", in: []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n")},
+		{name: "v1 truncated", in: []byte("PROXY TCP4 192.0.2.1 198.51"), err: io.ErrUnexpectedEOF},
+		{name: "v1 oversized", in: []byte("PROXY TCP4 " + strings.Repeat("1", proxyV1MaxSize) + "\r\n"), err: ErrProxyHeader},
+		{name: "v1 missing field", in: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345\r\n"), err: ErrProxyHeader},
+		{name: "v1 bad port", in: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345 65536\r\n"), err: ErrProxyHeader},
+		{name: "v1 bad protocol", in: []byte("PROXY UDP4 192.0.2.1 198.51.100.1 12345 443\r\n"), err: ErrProxyHeader},
+		{name: "v2 tcp4", in: proxyV2(proxyV2Proxy, proxyV2TCP4, tcp4), src: "192.0.2.1:12345", dst: "198.51.100.1:443"},
+		{name: "v2 udp6", in: proxyV2(proxyV2Proxy, proxyV2UDP6, udp6), src: "[2001:db8::1]:12345", dst: "[2001:db8::2]:443"},
+		{name: "v2 tlvs", in: proxyV2(proxyV2Proxy, proxyV2TCP4, append(tcp4, tlvs...)), src: "192.0.2.1:12345", dst: "198.51.100.1:443"},
+		{name: "v2 local", in: proxyV2(proxyV2Local, proxyV2Unspec, nil)},
+		{name: "v2 local tlvs", in: proxyV2(proxyV2Local, proxyV2TCP4, append(tcp4, tlvs...))},
+		{name: "v2 unix", in: proxyV2(proxyV2Proxy, 0x31, make([]byte, 216))},
+		{name: "v2 truncated fixed part", in: proxyV2(proxyV2Proxy, proxyV2TCP4, tcp4)[:6], err: io.ErrUnexpectedEOF},
+		{name: "v2 truncated body", in: proxyV2(proxyV2Proxy, proxyV2TCP4, tcp4)[:20], err: io.ErrUnexpectedEOF},
+		{name: "v2 short addresses", in: proxyV2(proxyV2Proxy, proxyV2TCP6, tcp4), err: ErrProxyHeader},
+		{name: "v2 bad version", in: append(append([]byte(nil), proxyV2Signature...), 0x11, proxyV2TCP4, 0, 0), err: ErrProxyHeader},
+		{name: "v2 bad command", in: proxyV2(0x02, proxyV2TCP4, tcp4), err: ErrProxyHeader},
+		{name: "bad signature", in: []byte("GET / HTTP/1.1\r\n\r\n"), err: ErrProxyHeader},
+		{name: "empty", in: nil, err: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const payload = "payload"
+			r := bytes.NewReader(append(append([]byte(nil), tt.in...), payload...))
+			if tt.err != nil {
+				r = bytes.NewReader(tt.in)
+			}
+			h, err := ReadProxyHeader(r)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ReadProxyHeader() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadProxyHeader() error = %v", err)
+			}
+			if got := addrString(h.Source); got != tt.src {
+				t.Errorf("Source = %q, want %q", got, tt.src)
+			}
+			if got := addrString(h.Destination); got != tt.dst {
+				t.Errorf("Destination = %q, want %q", got, tt.dst)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != payload {
+				t.Errorf("read past the header, left %q", rest)
+			}
+		})
+	}
+}
+
+func TestProxyHeaderMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		h    ProxyHeader
+	}{
+		{name: "v1 tcp4", h: ProxyHeader{Version: 1, Source: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1}, Destination: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 2}}},
+		{name: "v1 unknown", h: ProxyHeader{Version: 1}},
+		{name: "v2 tcp6", h: ProxyHeader{Version: 2, Source: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1}, Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2}}},
+		{name: "v2 udp4", h: ProxyHeader{Version: 2, Source: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1}, Destination: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 2}}},
+		{name: "v2 local", h: ProxyHeader{Version: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.h.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			h, err := ReadProxyHeader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("ReadProxyHeader() error = %v", err)
+			}
+			if h.Version != tt.h.Version || addrString(h.Source) != addrString(tt.h.Source) || addrString(h.Destination) != addrString(tt.h.Destination) {
+				t.Errorf("round trip = %+v, want %+v", h, tt.h)
+			}
+		})
+	}
+
+	mixed := ProxyHeader{Source: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1)}, Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::1")}}
+	if _, err := mixed.Marshal(); err == nil {
+		t.Error("Marshal() of addresses of different families succeeded")
+	}
+}
+
+func TestProxyConnAddrFallback(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	client.Close()
+
+	c := &proxyConn{Conn: server}
+	if got := c.RemoteAddr(); got != server.RemoteAddr() {
+		t.Errorf("RemoteAddr() = %v, want %v", got, server.RemoteAddr())
+	}
+	if got := c.LocalAddr(); got != server.LocalAddr() {
+		t.Errorf("LocalAddr() = %v, want %v", got, server.LocalAddr())
+	}
+	if _, err := c.Read(make([]byte, 1)); err == nil {
+		t.Error("Read() without a header succeeded")
+	}
+}
+
+// addrString returns the string of addr, empty for nil.
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
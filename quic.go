@@ -0,0 +1,103 @@
+package reuse
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// quicBufSize is the socket buffer size recommended by quic-go for high
+// bandwidth connections.
+const quicBufSize = 7 << 20
+
+// QUICOptions returns the socket options suited to QUIC endpoints: 7 MiB
+// receive and send buffers, exceeding the system limits when privileged,
+// the don't fragment bit required by path MTU discovery and the delivery
+// of the ECN bits of the datagrams received. The last two are set on a
+// best effort basis, the platforms lacking them, such as OpenBSD for
+// IPv4, doing without; WithDontFragment and WithRecvECN require them.
+func QUICOptions() []Option {
+	return []Option{
+		WithRcvBuf(quicBufSize),
+		WithSndBuf(quicBufSize),
+		WithForceBuf(true),
+		quicPathOptions,
+	}
+}
+
+// quicPathOptions sets the don't fragment bit and the delivery of the ECN
+// bits on a best effort basis.
+func quicPathOptions(c *config) {
+	enable := true
+	c.dontFrag = &enable
+	c.recvECN = true
+	c.bestEffortDF = true
+	c.bestEffortECN = true
+}
+
+// ListenQUIC listens at the given UDP network and address with
+// QUICOptions, followed by opts, applied to the socket. The returned conn
+// is meant to be handed to a QUIC implementation such as quic-go, which
+// accepts and dials QUIC connections over it:
+//
+//	conn, _ := reuse.ListenQUIC("udp", "0.0.0.0:4433")
+//	tr := &quic.Transport{Conn: conn}
+//	ln, _ := tr.Listen(tlsConf, quicConf)
+//	qc, _ := tr.Dial(ctx, peer, tlsConf, quicConf)
+//
+// Other protocols, such as STUN, can share the port through further
+// sockets bound to the address or through the non QUIC packets read by
+// quic.Transport.ReadNonQUICPacket. quic-go enables UDP GSO and GRO on
+// *net.UDPConn itself, WithUDPSegment must not be used.
+func ListenQUIC(network, address string, opts ...Option) (*net.UDPConn, error) {
+	return ListenQUICContext(context.Background(), network, address, opts...)
+}
+
+// ListenQUICContext listens at the given UDP network and address using
+// the provided context. see ListenQUIC
+func ListenQUICContext(ctx context.Context, network, address string, opts ...Option) (*net.UDPConn, error) {
+	if !udp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	pc, err := ListenPacketContext(ctx, network, address, append(QUICOptions(), opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := pc.(*net.UDPConn)
+	if !ok {
+		pc.Close()
+		return nil, fmt.Errorf("reuse: unexpected packet conn %T", pc)
+	}
+	return conn, nil
+}
+
+// DialQUIC prepares the dial of a QUIC connection from laddr to raddr on
+// the given UDP network: it returns a socket bound to laddr with
+// QUICOptions, followed by opts, applied, and raddr resolved, which are
+// the arguments of quic.Dial in quic-go. The socket is not connected, as
+// QUIC implementations send with WriteTo, and may carry further QUIC
+// connections; laddr may be empty, or the address of a listener sharing
+// its port:
+//
+//	conn, peer, _ := reuse.DialQUIC("udp", ":4433", "192.0.2.1:443")
+//	qc, _ := quic.Dial(ctx, conn, peer, tlsConf, quicConf)
+func DialQUIC(network, laddr, raddr string, opts ...Option) (*net.UDPConn, *net.UDPAddr, error) {
+	return DialQUICContext(context.Background(), network, laddr, raddr, opts...)
+}
+
+// DialQUICContext prepares the dial of a QUIC connection using the
+// provided context. see DialQUIC
+func DialQUICContext(ctx context.Context, network, laddr, raddr string, opts ...Option) (*net.UDPConn, *net.UDPAddr, error) {
+	if !udp(network) {
+		return nil, nil, net.UnknownNetworkError(network)
+	}
+	ra, err := ResolveAddrContext(ctx, network, raddr, opts...)
+	if err != nil {
+		return nil, nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	conn, err := ListenQUICContext(ctx, network, laddr, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, ra.(*net.UDPAddr), nil
+}
@@ -0,0 +1,89 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Defaults of RetryPolicy.
+const (
+	defaultRetryAttempts = 5
+	defaultRetryMinDelay = 10 * time.Millisecond
+	defaultRetryMaxDelay = time.Second
+)
+
+// RetryPolicy configures the retries of the dials failing with a
+// transient error, see WithRetry.
+//
+// The zero value for each field selects its default.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, 5 by default.
+	Attempts int
+
+	// MinDelay is the delay before the first retry, 10ms by default,
+	// doubled after each retry up to MaxDelay, 1s by default. Each delay
+	// is randomly shortened by up to half so that the dials sharing a
+	// local port do not retry in lockstep.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+
+	// Retryable reports whether an attempt failing with err is retried,
+	// IsTransientDialError by default.
+	Retryable func(err error) bool
+}
+
+// WithRetry makes the Dial functions retry the attempts failing with a
+// transient error according to p, backing off exponentially until ctx
+// is done. Errors such as EADDRINUSE are common when dialing from a
+// reused local port, the 4-tuple being still in use by a connection
+// closing.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = &p
+	}
+}
+
+// IsTransientDialError reports whether err is a dial error that may not
+// occur again: the local address is in use or unavailable, or the
+// connection was refused.
+func IsTransientDialError(err error) bool {
+	return errors.Is(err, errAddrInUse) ||
+		errors.Is(err, errAddrNotAvail) ||
+		errors.Is(err, errConnRefused)
+}
+
+// dial calls d.DialContext until it succeeds, fails with an error that
+// is not retryable or the attempts are exhausted.
+func (p *RetryPolicy) dial(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+	attempts, delay, maxDelay := p.Attempts, p.MinDelay, p.MaxDelay
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	if delay <= 0 {
+		delay = defaultRetryMinDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransientDialError
+	}
+
+	for i := 1; ; i++ {
+		conn, err := d.DialContext(ctx, network, address)
+		if err == nil || i >= attempts || !retryable(err) {
+			return conn, err
+		}
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		if sleepUntil(ctx, time.Now().Add(wait)) != nil {
+			return nil, err
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
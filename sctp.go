@@ -0,0 +1,101 @@
+package reuse
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// SCTPAddr represents the address of an SCTP end point, as returned by the
+// listeners and connections of ListenSCTP, DialSCTP and ListenSCTPPacket.
+type SCTPAddr struct {
+	IP   net.IP
+	Port int
+	Zone string // IPv6 scoped addressing zone
+}
+
+// Network returns the address's network name, "sctp".
+func (a *SCTPAddr) Network() string { return "sctp" }
+
+func (a *SCTPAddr) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	ip := ""
+	if len(a.IP) != 0 {
+		ip = a.IP.String()
+	}
+	if a.Zone != "" {
+		ip += "%" + a.Zone
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(a.Port))
+}
+
+// ListenSCTP announces on the local address of an SCTP network, "sctp",
+// "sctp4" or "sctp6", with a one-to-one style socket with the options of
+// opts, so that several listeners share the port as with Listen. Each
+// accepted connection is an association with one peer, read and written
+// as a stream. Linux only.
+func ListenSCTP(network, address string, opts ...Option) (net.Listener, error) {
+	if !sctp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	return newConfig(opts).listenSCTP(network, address)
+}
+
+// DialSCTP connects to raddr on an SCTP network from laddr with a
+// one-to-one style socket with the options of opts. see DialSCTPContext
+func DialSCTP(network, laddr, raddr string, opts ...Option) (net.Conn, error) {
+	return DialSCTPContext(context.Background(), network, laddr, raddr, opts...)
+}
+
+// DialSCTPContext connects to raddr on an SCTP network from laddr using
+// the provided context. An empty laddr dials from an ephemeral port.
+// Linux only.
+func DialSCTPContext(ctx context.Context, network, laddr, raddr string, opts ...Option) (net.Conn, error) {
+	if !sctp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	return newConfig(opts).dialSCTP(ctx, network, laddr, raddr)
+}
+
+// ListenSCTPPacket announces on the local address of an SCTP network with
+// a one-to-many style socket with the options of opts. A single socket
+// carries the associations with every peer: ReadFrom returns a message
+// with the address of the peer of its association, and WriteTo sends a
+// message on the association with addr, an *SCTPAddr, setting it up if
+// needed. A message larger than the buffer passed to ReadFrom is read in
+// several parts. Linux only.
+func ListenSCTPPacket(network, address string, opts ...Option) (net.PacketConn, error) {
+	if !sctp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	return newConfig(opts).listenSCTPPacket(network, address)
+}
+
+// sctp reports whether network is an SCTP network.
+func sctp(network string) bool {
+	switch network {
+	case "sctp", "sctp4", "sctp6":
+		return true
+	}
+	return false
+}
+
+// resolveSCTPAddr resolves address on an SCTP network as the TCP address
+// with the same host and port. An empty address resolves to nil.
+func (c *config) resolveSCTPAddr(ctx context.Context, network, address string) (*SCTPAddr, error) {
+	if address == "" {
+		return nil, nil
+	}
+	a, err := c.resolveAddr(ctx, "tcp"+network[len("sctp"):], address)
+	if err != nil {
+		return nil, err
+	}
+	ta, ok := a.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAddrResolution, address)
+	}
+	return &SCTPAddr{IP: ta.IP, Port: ta.Port, Zone: ta.Zone}, nil
+}
@@ -0,0 +1,343 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func (c *config) listenSCTP(network, address string) (net.Listener, error) {
+	laddr, err := c.resolveSCTPAddr(context.Background(), network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+	f, err := c.sctpSocket(network, unix.SOCK_STREAM, laddr, nil, HookBind)
+	if err != nil {
+		return nil, classify(&net.OpError{Op: "listen", Net: network, Addr: sctpNetAddr(laddr), Err: err})
+	}
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	return c.listener(&sctpListener{TCPListener: l.(*net.TCPListener), network: network}), nil
+}
+
+func (c *config) dialSCTP(ctx context.Context, network, laddr, raddr string) (net.Conn, error) {
+	la, err := c.resolveSCTPAddr(ctx, network, laddr)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	ra, err := c.resolveSCTPAddr(ctx, network, raddr)
+	if err == nil && ra == nil {
+		err = &net.AddrError{Err: "missing address"}
+	}
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: sctpNetAddr(la), Err: err}
+	}
+
+	points := []HookPoint{HookConnect}
+	if la != nil {
+		points = []HookPoint{HookBind, HookConnect}
+	}
+	var f *os.File
+	sa, err := sctpSockaddr(sctpFamily(network, la, ra), ra)
+	if err == nil {
+		f, err = c.sctpSocket(network, unix.SOCK_STREAM, la, ra, points...)
+	}
+	if err == nil {
+		if err = connectFile(ctx, f, sa); err != nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return nil, classify(&net.OpError{Op: "dial", Net: network, Source: sctpNetAddr(la), Addr: ra, Err: err})
+	}
+	defer f.Close()
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, err
+	}
+	return &sctpConn{TCPConn: conn.(*net.TCPConn)}, nil
+}
+
+func (c *config) listenSCTPPacket(network, address string) (net.PacketConn, error) {
+	laddr, err := c.resolveSCTPAddr(context.Background(), network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+	f, err := c.sctpSocket(network, unix.SOCK_SEQPACKET, laddr, nil, HookBind)
+	if err != nil {
+		return nil, classify(&net.OpError{Op: "listen", Net: network, Addr: sctpNetAddr(laddr), Err: err})
+	}
+	pc := &sctpPacketConn{f: f, network: network}
+	if pc.rc, err = f.SyscallConn(); err == nil {
+		err = sockControl(f, func(fd uintptr) error {
+			sa, err := unix.Getsockname(int(fd))
+			if err != nil {
+				return os.NewSyscallError("getsockname", err)
+			}
+			pc.laddr = sctpAddrFrom(sa)
+			pc.family = unix.AF_INET
+			if _, ok := sa.(*unix.SockaddrInet6); ok {
+				pc.family = unix.AF_INET6
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		f.Close()
+		return nil, &net.OpError{Op: "listen", Net: network, Addr: sctpNetAddr(laddr), Err: err}
+	}
+	return pc, nil
+}
+
+// sctpSocket returns a nonblocking SCTP socket of type sotype, of the
+// family of laddr and raddr, with the options of c applied, bound to
+// laddr unless nil and listening unless raddr is set. The socket is
+// closed on error.
+func (c *config) sctpSocket(network string, sotype int, laddr, raddr *SCTPAddr, points ...HookPoint) (*os.File, error) {
+	family := sctpFamily(network, laddr, raddr)
+	s, err := unix.Socket(family, sotype|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, unix.IPPROTO_SCTP)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	f := os.NewFile(uintptr(s), "sctp")
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Name the network with its family, as the net package does when
+	// calling a Control function.
+	fnet, address := "sctp4", ""
+	if family == unix.AF_INET6 {
+		fnet = "sctp6"
+	}
+	if raddr != nil {
+		address = raddr.String()
+	} else if laddr != nil {
+		address = laddr.String()
+	}
+	if family == unix.AF_INET6 {
+		err = sockControl(f, func(fd uintptr) error {
+			return unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, boolint(network == "sctp6"))
+		})
+	}
+	if err == nil {
+		err = c.controlHooks(fnet, address, rc, points...)
+	}
+	if err == nil && laddr != nil {
+		err = sockControl(f, func(fd uintptr) error {
+			sa, err := sctpSockaddr(family, laddr)
+			if err != nil {
+				return err
+			}
+			return os.NewSyscallError("bind", unix.Bind(int(fd), sa))
+		})
+	}
+	if err == nil && raddr == nil {
+		err = sockControl(f, func(fd uintptr) error {
+			return os.NewSyscallError("listen", unix.Listen(int(fd), unix.SOMAXCONN))
+		})
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// sctpFamily returns the address family of the socket of network for
+// laddr and raddr, IPv4 if an address is IPv4 and IPv6 otherwise.
+func sctpFamily(network string, laddr, raddr *SCTPAddr) int {
+	switch network {
+	case "sctp4":
+		return unix.AF_INET
+	case "sctp6":
+		return unix.AF_INET6
+	}
+	for _, a := range []*SCTPAddr{laddr, raddr} {
+		if a != nil && a.IP.To4() != nil {
+			return unix.AF_INET
+		}
+	}
+	return unix.AF_INET6
+}
+
+func sctpSockaddr(family int, a *SCTPAddr) (unix.Sockaddr, error) {
+	if family == unix.AF_INET {
+		sa := &unix.SockaddrInet4{Port: a.Port}
+		if len(a.IP) != 0 {
+			ip := a.IP.To4()
+			if ip == nil {
+				return nil, &net.AddrError{Err: "non-IPv4 address", Addr: a.IP.String()}
+			}
+			copy(sa.Addr[:], ip)
+		}
+		return sa, nil
+	}
+	sa := &unix.SockaddrInet6{Port: a.Port}
+	if len(a.IP) != 0 {
+		ip := a.IP.To16()
+		if ip == nil {
+			return nil, &net.AddrError{Err: "non-IPv6 address", Addr: a.IP.String()}
+		}
+		copy(sa.Addr[:], ip)
+	}
+	zone, err := zoneIndex(a.Zone)
+	if err != nil {
+		return nil, err
+	}
+	sa.ZoneId = zone
+	return sa, nil
+}
+
+func sctpAddrFrom(sa unix.Sockaddr) *SCTPAddr {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return &SCTPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+	case *unix.SockaddrInet6:
+		return &SCTPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port, Zone: zoneName(sa.ZoneId)}
+	}
+	return nil
+}
+
+// sctpNetAddr returns a as a net.Addr, nil if a is nil.
+func sctpNetAddr(a *SCTPAddr) net.Addr {
+	if a == nil {
+		return nil
+	}
+	return a
+}
+
+// sctpAddrOf returns the SCTP address of a, the TCP address reported by
+// the net package for a one-to-one style socket.
+func sctpAddrOf(a net.Addr) net.Addr {
+	if ta, ok := a.(*net.TCPAddr); ok {
+		return &SCTPAddr{IP: ta.IP, Port: ta.Port, Zone: ta.Zone}
+	}
+	return a
+}
+
+// sctpListener is the listener of a one-to-one style SCTP socket, which
+// the net package handles as a TCP socket.
+type sctpListener struct {
+	*net.TCPListener
+	network string
+}
+
+func (l *sctpListener) Accept() (net.Conn, error) {
+	c, err := l.AcceptTCP()
+	if err != nil {
+		if oe, ok := err.(*net.OpError); ok {
+			oe.Net, oe.Source, oe.Addr = l.network, nil, l.Addr()
+		}
+		return nil, err
+	}
+	return &sctpConn{TCPConn: c}, nil
+}
+
+func (l *sctpListener) Addr() net.Addr {
+	return sctpAddrOf(l.TCPListener.Addr())
+}
+
+// sctpConn is an association of a one-to-one style SCTP socket.
+type sctpConn struct {
+	*net.TCPConn
+}
+
+func (c *sctpConn) LocalAddr() net.Addr {
+	return sctpAddrOf(c.TCPConn.LocalAddr())
+}
+
+func (c *sctpConn) RemoteAddr() net.Addr {
+	return sctpAddrOf(c.TCPConn.RemoteAddr())
+}
+
+// sctpPacketConn is a one-to-many style SCTP socket.
+type sctpPacketConn struct {
+	f       *os.File
+	rc      syscall.RawConn
+	network string
+	family  int
+	laddr   *SCTPAddr
+	closed  atomic.Bool
+}
+
+func (c *sctpPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	var n int
+	var from unix.Sockaddr
+	var rerr error
+	err := c.rc.Read(func(fd uintptr) bool {
+		n, from, rerr = unix.Recvfrom(int(fd), b, 0)
+		return rerr != unix.EAGAIN
+	})
+	if err == nil {
+		err = os.NewSyscallError("recvfrom", rerr)
+	}
+	if err != nil && c.closed.Load() {
+		err = net.ErrClosed
+	}
+	if err != nil {
+		return 0, nil, &net.OpError{Op: "read", Net: c.network, Source: c.laddr, Err: err}
+	}
+	return n, sctpAddrFrom(from), nil
+}
+
+func (c *sctpPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	a, ok := addr.(*SCTPAddr)
+	if !ok {
+		return 0, &net.OpError{Op: "write", Net: c.network, Source: c.laddr, Addr: addr, Err: syscall.EINVAL}
+	}
+	sa, err := sctpSockaddr(c.family, a)
+	if err != nil {
+		return 0, &net.OpError{Op: "write", Net: c.network, Source: c.laddr, Addr: addr, Err: err}
+	}
+	var werr error
+	err = c.rc.Write(func(fd uintptr) bool {
+		werr = unix.Sendto(int(fd), b, 0, sa)
+		return werr != unix.EAGAIN
+	})
+	if err == nil {
+		err = os.NewSyscallError("sendto", werr)
+	}
+	if err != nil && c.closed.Load() {
+		err = net.ErrClosed
+	}
+	if err != nil {
+		return 0, &net.OpError{Op: "write", Net: c.network, Source: c.laddr, Addr: addr, Err: err}
+	}
+	return len(b), nil
+}
+
+func (c *sctpPacketConn) Close() error {
+	c.closed.Store(true)
+	return c.f.Close()
+}
+
+func (c *sctpPacketConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *sctpPacketConn) SetDeadline(t time.Time) error {
+	return c.f.SetDeadline(t)
+}
+
+func (c *sctpPacketConn) SetReadDeadline(t time.Time) error {
+	return c.f.SetReadDeadline(t)
+}
+
+func (c *sctpPacketConn) SetWriteDeadline(t time.Time) error {
+	return c.f.SetWriteDeadline(t)
+}
+
+func (c *sctpPacketConn) SyscallConn() (syscall.RawConn, error) {
+	return c.rc, nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+import (
+	"context"
+	"net"
+)
+
+func (c *config) listenSCTP(network, address string) (net.Listener, error) {
+	return nil, &net.OpError{Op: "listen", Net: network, Err: unsupportedOption("SCTP")}
+}
+
+func (c *config) dialSCTP(ctx context.Context, network, laddr, raddr string) (net.Conn, error) {
+	return nil, &net.OpError{Op: "dial", Net: network, Err: unsupportedOption("SCTP")}
+}
+
+func (c *config) listenSCTPPacket(network, address string) (net.PacketConn, error) {
+	return nil, &net.OpError{Op: "listen", Net: network, Err: unsupportedOption("SCTP")}
+}
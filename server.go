@@ -0,0 +1,269 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// minAcceptDelay and maxAcceptDelay bound the delay before accepting
+	// again after an error.
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// ErrServerClosed is returned by the Serve methods of a Server after
+// Shutdown or Close.
+var ErrServerClosed = errors.New("reuse: server closed")
+
+// Server accepts and serves the connections of one or more listeners,
+// typically created with port reuse so that several instances of a
+// service share a port, tracking them to shut down gracefully.
+//
+// The zero value for each field selects its default.
+type Server struct {
+	// Handler serves a connection, which is closed once it returns. ctx
+	// is cancelled when Shutdown starts, asking the handlers to finish.
+	Handler func(ctx context.Context, conn net.Conn)
+
+	// AcceptLoops is the number of goroutines accepting from each
+	// listener, 1 by default.
+	AcceptLoops int
+
+	// MaxConns bounds the number of connections served at once, without
+	// limit by default. The listeners stop accepting at the limit.
+	MaxConns int
+
+	// Options are the socket options of the listeners created by
+	// ListenAndServe.
+	Options []Option
+
+	// OnError is called with the errors of Accept, which is retried
+	// after a delay doubling up to 1s, unless the error means the listener
+	// cannot accept anymore, such as EBADF or EINVAL, ending Serve.
+	OnError func(err error)
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	sem       chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closed    bool
+	loops     sync.WaitGroup
+	handlers  sync.WaitGroup
+}
+
+// ListenAndServe listens on address in network with the options of s and
+// serves the connections accepted. see Serve
+func (s *Server) ListenAndServe(network, address string) error {
+	l, err := Listen(network, address, s.Options...)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted by l, closing l when it returns.
+// It returns ErrServerClosed after Shutdown or Close, or the error of l
+// if it fails otherwise. Serve may be called for several listeners.
+func (s *Server) Serve(l net.Listener) error {
+	n := s.AcceptLoops
+	if n <= 0 {
+		n = 1
+	}
+	if !s.track(l, n) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(l)
+
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer s.loops.Done()
+			errs <- s.acceptLoop(l)
+		}()
+	}
+	err := <-errs
+	l.Close()
+	if s.shuttingDown() {
+		return ErrServerClosed
+	}
+	return err
+}
+
+// acceptLoop accepts from l and starts serving the connections until l
+// fails.
+func (s *Server) acceptLoop(l net.Listener) error {
+	var delay time.Duration
+	for {
+		if s.sem != nil {
+			select {
+			case s.sem <- struct{}{}:
+			case <-s.ctx.Done():
+				return ErrServerClosed
+			}
+		}
+		conn, err := l.Accept()
+		if err != nil {
+			s.release()
+			if errors.Is(err, net.ErrClosed) || s.shuttingDown() || acceptPermanent(err) {
+				return err
+			}
+			if s.OnError != nil {
+				s.OnError(err)
+			}
+			if delay == 0 {
+				delay = minAcceptDelay
+			} else if delay *= 2; delay > maxAcceptDelay {
+				delay = maxAcceptDelay
+			}
+			if sleepUntil(s.ctx, time.Now().Add(delay)) != nil {
+				return ErrServerClosed
+			}
+			continue
+		}
+		delay = 0
+		if !s.trackConn(conn) {
+			conn.Close()
+			s.release()
+			return ErrServerClosed
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.handlers.Done()
+	defer s.release()
+	defer s.untrackConn(conn)
+	defer conn.Close()
+	if s.Handler != nil {
+		s.Handler(s.ctx, conn)
+	}
+}
+
+// init initializes s on first use, under s.mu.
+func (s *Server) init() {
+	if s.listeners != nil {
+		return
+	}
+	s.listeners = make(map[net.Listener]struct{})
+	s.conns = make(map[net.Conn]struct{})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if s.MaxConns > 0 {
+		s.sem = make(chan struct{}, s.MaxConns)
+	}
+}
+
+// track registers l and its n accept loops, unless s is shutting down,
+// under s.mu so that stop waits for all of them.
+func (s *Server) track(l net.Listener, n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	if s.closed {
+		return false
+	}
+	s.listeners[l] = struct{}{}
+	s.loops.Add(n)
+	return true
+}
+
+func (s *Server) untrack(l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, l)
+}
+
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.handlers.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *Server) release() {
+	if s.sem != nil {
+		<-s.sem
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Conns returns the number of connections being served.
+func (s *Server) Conns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Shutdown stops accepting, cancels the context of the handlers and waits
+// for the connections being served to be closed by their handlers. When
+// ctx is done first, the drain deadline, the remaining connections are
+// closed and the error of ctx is returned at once, without waiting for
+// the handlers ignoring ctx to return.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stop()
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.closeConns()
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting and closes the connections being served right
+// away.
+func (s *Server) Close() error {
+	s.stop()
+	s.closeConns()
+	s.handlers.Wait()
+	return nil
+}
+
+// stop closes the listeners and waits for the accept loops to exit.
+func (s *Server) stop() {
+	s.mu.Lock()
+	s.init()
+	s.closed = true
+	s.cancel()
+	for l := range s.listeners {
+		l.Close()
+	}
+	s.mu.Unlock()
+	s.loops.Wait()
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,64 @@
+package reuse
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// connectFile connects the nonblocking socket of f to sa, waiting for the
+// connection to be established until ctx is done.
+func connectFile(ctx context.Context, f *os.File, sa unix.Sockaddr) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cerr error
+	if err := rc.Control(func(fd uintptr) {
+		cerr = unix.Connect(int(fd), sa)
+	}); err != nil {
+		return err
+	}
+	if cerr != unix.EINPROGRESS {
+		return os.NewSyscallError("connect", cerr)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		f.SetWriteDeadline(deadline)
+	}
+	// Unblock the wait when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		f.SetWriteDeadline(time.Now())
+	})
+	// The socket is writable once the connection completes or fails, see
+	// connect(2).
+	err = rc.Write(func(fd uintptr) bool {
+		soerr, err := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ERROR)
+		if err != nil {
+			cerr = err
+			return true
+		}
+		switch e := syscall.Errno(soerr); e {
+		case unix.EINPROGRESS, unix.EALREADY, unix.EINTR:
+			return false
+		case 0:
+			_, err := unix.Getpeername(int(fd))
+			cerr = nil
+			return err == nil
+		default:
+			cerr = e
+			return true
+		}
+	})
+	if !stop() {
+		return ctx.Err()
+	}
+	f.SetWriteDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+	return os.NewSyscallError("connect", cerr)
+}
@@ -0,0 +1,36 @@
+package reuse
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/proxy"
+)
+
+// DialSOCKS5 connects to raddr through the SOCKS5 proxy at proxyAddr,
+// binding the socket facing the proxy to laddr with port reuse, so that
+// the connections keep a stable source port. auth may be nil. see
+// DialSOCKS5Context
+func DialSOCKS5(network, laddr, proxyAddr, raddr string, auth *proxy.Auth, opts ...Option) (net.Conn, error) {
+	return DialSOCKS5Context(context.Background(), network, laddr, proxyAddr, raddr, auth, opts...)
+}
+
+// DialSOCKS5Context connects to raddr through the SOCKS5 proxy at
+// proxyAddr using the provided context. network is the TCP network of
+// the connection to the proxy, raddr being resolved by the proxy.
+func DialSOCKS5Context(ctx context.Context, network, laddr, proxyAddr, raddr string, auth *proxy.Auth, opts ...Option) (net.Conn, error) {
+	if !tcp(network) {
+		return nil, net.UnknownNetworkError(network)
+	}
+	nla, err := ResolveAddrContext(ctx, network, laddr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("resolving local addr: %w", err)
+	}
+	forward := &Dialer{LocalAddr: nla, Options: opts}
+	d, err := proxy.SOCKS5(network, proxyAddr, auth, forward)
+	if err != nil {
+		return nil, err
+	}
+	return d.(proxy.ContextDialer).DialContext(ctx, network, raddr)
+}
@@ -0,0 +1,45 @@
+package reuse
+
+import (
+	"net"
+)
+
+// SSDPPort is the SSDP port.
+const SSDPPort = 1900
+
+var (
+	// SSDPGroupIPv4 is the IPv4 SSDP multicast group.
+	SSDPGroupIPv4 = net.IPv4(239, 255, 255, 250)
+	// SSDPGroupIPv6 is the link-local IPv6 SSDP multicast group.
+	SSDPGroupIPv6 = net.ParseIP("ff02::c")
+)
+
+// ListenSSDP listens on the SSDP port for network, "udp4" or "udp6", with
+// SO_REUSEPORT and SO_REUSEADDR option set, so that it coexists with the
+// other SSDP users of the host, and joins the SSDP group on each of ifis,
+// or on every up multicast capable interface if ifis is empty. The
+// returned connection is ready to send M-SEARCH requests to and receive
+// NOTIFY messages from the group. ListenSSDP only fails if it joined the
+// group on none of the interfaces.
+//
+// The multicast TTL is set to 2, as recommended by the UPnP Device
+// Architecture, and the loopback enabled.
+func ListenSSDP(network string, ifis []*net.Interface, opts ...Option) (net.PacketConn, error) {
+	group := SSDPGroupIPv4
+	if network == "udp6" {
+		group = SSDPGroupIPv6
+	}
+	c, err := listenMulticast(network, SSDPPort, group, ifis, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := SetMulticastTTL(c, 2); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := SetMulticastLoopback(c, true); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
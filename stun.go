@@ -0,0 +1,483 @@
+package reuse
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// STUN message types and attributes, see RFC 5389.
+const (
+	stunMagicCookie = 0x2112a442
+	stunHeaderSize  = 20
+
+	stunBindingRequest = 0x0001
+	stunBindingSuccess = 0x0101
+	stunBindingError   = 0x0111
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrErrorCode        = 0x0009
+	stunAttrXorMappedAddress = 0x0020
+)
+
+const (
+	// stunRTO is the initial retransmission timeout of STUN requests,
+	// doubled on each retransmission.
+	stunRTO = 500 * time.Millisecond
+	// stunRetries is the number of STUN requests sent before giving up,
+	// waiting for 16 RTOs after the last one.
+	stunRetries = 7
+	// stunQueue is the number of application datagrams queued by a
+	// STUNConn.
+	stunQueue = 256
+	// minSTUNReadDelay and maxSTUNReadDelay bound the delay between the
+	// reads of a STUNConn failing with a timeout, doubled on each one.
+	minSTUNReadDelay = 5 * time.Millisecond
+	maxSTUNReadDelay = time.Second
+)
+
+// ErrSTUNTimeout is returned when a STUN server did not answer any of
+// the retransmissions of a request.
+var ErrSTUNTimeout = errors.New("reuse: STUN request timed out")
+
+// STUNError is the error response of a STUN server.
+type STUNError struct {
+	Code   int
+	Reason string
+}
+
+func (e *STUNError) Error() string {
+	return fmt.Sprintf("reuse: STUN error %d: %s", e.Code, e.Reason)
+}
+
+// STUNConn wraps a packet conn, typically returned by ListenPacket, to
+// send STUN binding requests from the socket while it carries the
+// application traffic, so that a service discovers the address and port
+// its socket is mapped to by NATs, rather than the mapping of a second
+// socket. The STUN responses are demultiplexed from the datagrams
+// returned by ReadFrom.
+//
+// STUNConn reads from the wrapped conn in the background, dropping
+// application datagrams while ReadFrom is not called fast enough.
+type STUNConn struct {
+	net.PacketConn
+
+	mu      sync.Mutex
+	pending map[[12]byte]chan *stunMessage
+	queue   chan stunPacket
+	done    chan struct{}
+	err     error
+
+	deadline  *readDeadline
+	responder atomic.Bool
+}
+
+type stunPacket struct {
+	b    []byte
+	addr net.Addr
+}
+
+// NewSTUNConn returns a STUNConn reading from c. The STUNConn owns c,
+// closing it when closed.
+func NewSTUNConn(c net.PacketConn) *STUNConn {
+	sc := &STUNConn{
+		PacketConn: c,
+		pending:    make(map[[12]byte]chan *stunMessage),
+		queue:      make(chan stunPacket, stunQueue),
+		done:       make(chan struct{}),
+		deadline:   newReadDeadline(),
+	}
+	go sc.readLoop()
+	return sc
+}
+
+// Binding sends a STUN binding request to server, retransmitting it
+// until a response arrives or ctx is done, and returns the address the
+// server saw the request coming from: the reflexive address of the
+// socket.
+func (c *STUNConn) Binding(ctx context.Context, server string) (*net.UDPAddr, error) {
+	raddr, err := net.ResolveUDPAddr(c.network(), server)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.roundTrip(ctx, raddr, newSTUNRequest())
+	if err != nil {
+		return nil, err
+	}
+	return resp.mappedAddr()
+}
+
+// SetBindingResponder sets whether c answers the STUN binding requests
+// it receives, as peers do to check their connectivity while hole
+// punching, and drops the binding indications peers send as keepalive,
+// see NATKeepalive. They are returned by ReadFrom otherwise.
+func (c *STUNConn) SetBindingResponder(enable bool) {
+	c.responder.Store(enable)
+}
+
+// ReadFrom reads the next datagram that is not a response to a STUN
+// request of c.
+func (c *STUNConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		timeout, changed, stop, expired := c.deadline.wait()
+		if expired {
+			select {
+			case <-c.done:
+				return 0, nil, c.closeErr()
+			default:
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+		}
+		select {
+		case p := <-c.queue:
+			stop()
+			return copy(b, p.b), p.addr, nil
+		case <-c.done:
+			stop()
+			select {
+			case p := <-c.queue:
+				return copy(b, p.b), p.addr, nil
+			default:
+			}
+			return 0, nil, c.closeErr()
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-changed:
+			stop()
+		}
+	}
+}
+
+// SetDeadline sets the read and write deadlines of c.
+func (c *STUNConn) SetDeadline(t time.Time) error {
+	c.deadline.set(t)
+	return c.PacketConn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of ReadFrom.
+func (c *STUNConn) SetReadDeadline(t time.Time) error {
+	c.deadline.set(t)
+	return nil
+}
+
+// Close closes the wrapped conn, failing the pending STUN requests.
+func (c *STUNConn) Close() error {
+	c.shutdown(net.ErrClosed)
+	return c.PacketConn.Close()
+}
+
+// network returns the network to resolve STUN servers on, restricted to
+// IPv4 for IPv4 sockets.
+func (c *STUNConn) network() string {
+	if a, ok := c.LocalAddr().(*net.UDPAddr); ok && a.IP.To4() != nil {
+		return "udp4"
+	}
+	return "udp"
+}
+
+// roundTrip sends req to raddr with retransmissions, returning the
+// success response to it or the error response as a *STUNError.
+func (c *STUNConn) roundTrip(ctx context.Context, raddr net.Addr, req *stunMessage) (*stunMessage, error) {
+	ch := make(chan *stunMessage, 1)
+	if err := c.register(req.txid, ch); err != nil {
+		return nil, err
+	}
+	defer c.unregister(req.txid)
+
+	b := req.marshal()
+	rto := stunRTO
+	for i := 0; i < stunRetries; i++ {
+		if _, err := c.WriteTo(b, raddr); err != nil {
+			return nil, err
+		}
+		wait := rto
+		if i == stunRetries-1 {
+			wait = 16 * stunRTO
+		}
+		t := time.NewTimer(wait)
+		select {
+		case resp := <-ch:
+			t.Stop()
+			if resp.typ == stunBindingError {
+				return nil, resp.errorCode()
+			}
+			return resp, nil
+		case <-c.done:
+			t.Stop()
+			return nil, c.closeErr()
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		rto *= 2
+	}
+	return nil, ErrSTUNTimeout
+}
+
+// register delivers the responses to the transaction txid to ch.
+func (c *STUNConn) register(txid [12]byte, ch chan *stunMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		return c.err
+	}
+	c.pending[txid] = ch
+	return nil
+}
+
+func (c *STUNConn) unregister(txid [12]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, txid)
+}
+
+func (c *STUNConn) readLoop() {
+	buf := make([]byte, maxDatagram)
+	var delay time.Duration
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(buf)
+		if err != nil {
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Timeout() {
+				c.shutdown(err)
+				return
+			}
+			// A deadline set on the wrapped conn, c having its own,
+			// would fail the reads at once: clear it and back off in
+			// case it is set again.
+			c.PacketConn.SetReadDeadline(time.Time{})
+			if delay == 0 {
+				delay = minSTUNReadDelay
+			} else if delay *= 2; delay > maxSTUNReadDelay {
+				delay = maxSTUNReadDelay
+			}
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-c.done:
+				t.Stop()
+				return
+			}
+			continue
+		}
+		delay = 0
+
+		if m, ok := parseSTUN(buf[:n]); ok && c.handleSTUN(m, buf[:n], addr) {
+			continue
+		}
+
+		select {
+		case c.queue <- stunPacket{b: append([]byte(nil), buf[:n]...), addr: addr}:
+		default:
+		}
+	}
+}
+
+// handleSTUN delivers the response m, read as b, to its pending request
+// or answers the binding request m from addr, reporting whether m was
+// consumed.
+func (c *STUNConn) handleSTUN(m *stunMessage, b []byte, addr net.Addr) bool {
+	switch m.typ {
+	case stunBindingSuccess, stunBindingError:
+		c.mu.Lock()
+		ch, ok := c.pending[m.txid]
+		c.mu.Unlock()
+		if !ok {
+			return false
+		}
+		// m refers to b, reparse a copy outliving the next read.
+		m, _ = parseSTUN(append([]byte(nil), b...))
+		select {
+		case ch <- m:
+		default:
+		}
+		return true
+	case stunBindingRequest:
+		ua, ok := addr.(*net.UDPAddr)
+		if !ok || !c.responder.Load() {
+			return false
+		}
+		resp := &stunMessage{
+			typ:   stunBindingSuccess,
+			txid:  m.txid,
+			attrs: []stunAttr{{typ: stunAttrXorMappedAddress, value: m.xorAddr(ua)}},
+		}
+		c.WriteTo(resp.marshal(), addr)
+		return true
+	case stunBindingIndication:
+		return c.responder.Load()
+	}
+	return false
+}
+
+func (c *STUNConn) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *STUNConn) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		return
+	}
+	c.pending = nil
+	c.err = err
+	close(c.done)
+}
+
+// stunMessage is a STUN message with its attributes in order.
+type stunMessage struct {
+	typ   uint16
+	txid  [12]byte
+	attrs []stunAttr
+}
+
+type stunAttr struct {
+	typ   uint16
+	value []byte
+}
+
+func newSTUNRequest(attrs ...stunAttr) *stunMessage {
+	m := &stunMessage{typ: stunBindingRequest, attrs: attrs}
+	rand.Read(m.txid[:])
+	return m
+}
+
+func (m *stunMessage) marshal() []byte {
+	b := make([]byte, stunHeaderSize, 64)
+	for _, a := range m.attrs {
+		var h [4]byte
+		binary.BigEndian.PutUint16(h[0:], a.typ)
+		binary.BigEndian.PutUint16(h[2:], uint16(len(a.value)))
+		b = append(b, h[:]...)
+		b = append(b, a.value...)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+	}
+	binary.BigEndian.PutUint16(b[0:], m.typ)
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)-stunHeaderSize))
+	binary.BigEndian.PutUint32(b[4:], stunMagicCookie)
+	copy(b[8:], m.txid[:])
+	return b
+}
+
+// parseSTUN parses b as a STUN message, reporting whether it is one.
+func parseSTUN(b []byte) (*stunMessage, bool) {
+	if len(b) < stunHeaderSize || b[0]&0xc0 != 0 {
+		return nil, false
+	}
+	if binary.BigEndian.Uint32(b[4:]) != stunMagicCookie || int(binary.BigEndian.Uint16(b[2:])) != len(b)-stunHeaderSize {
+		return nil, false
+	}
+	m := &stunMessage{typ: binary.BigEndian.Uint16(b)}
+	copy(m.txid[:], b[8:stunHeaderSize])
+	for b = b[stunHeaderSize:]; len(b) >= 4; {
+		typ, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return nil, false
+		}
+		m.attrs = append(m.attrs, stunAttr{typ: typ, value: b[4 : 4+n]})
+		n = (n + 3) &^ 3
+		if len(b) < 4+n {
+			break
+		}
+		b = b[4+n:]
+	}
+	return m, true
+}
+
+func (m *stunMessage) attr(typ uint16) ([]byte, bool) {
+	for _, a := range m.attrs {
+		if a.typ == typ {
+			return a.value, true
+		}
+	}
+	return nil, false
+}
+
+// mappedAddr returns the XOR-MAPPED-ADDRESS of m, or its MAPPED-ADDRESS
+// for servers predating RFC 5389.
+func (m *stunMessage) mappedAddr() (*net.UDPAddr, error) {
+	if v, ok := m.attr(stunAttrXorMappedAddress); ok {
+		return m.addr(v, true)
+	}
+	if v, ok := m.attr(stunAttrMappedAddress); ok {
+		return m.addr(v, false)
+	}
+	return nil, errors.New("reuse: STUN response without mapped address")
+}
+
+// addr parses the address attribute value v, XORed with the magic cookie
+// and transaction ID of m if xor is set.
+func (m *stunMessage) addr(v []byte, xor bool) (*net.UDPAddr, error) {
+	if len(v) < 4 {
+		return nil, errors.New("reuse: malformed STUN address")
+	}
+	var ip net.IP
+	switch v[1] {
+	case 1:
+		ip = make(net.IP, net.IPv4len)
+	case 2:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil, fmt.Errorf("reuse: unknown STUN address family %d", v[1])
+	}
+	if len(v) < 4+len(ip) {
+		return nil, errors.New("reuse: malformed STUN address")
+	}
+	port := binary.BigEndian.Uint16(v[2:])
+	copy(ip, v[4:])
+	if xor {
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[:], stunMagicCookie)
+		copy(key[4:], m.txid[:])
+		port ^= stunMagicCookie >> 16
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// xorAddr returns the XOR-MAPPED-ADDRESS value of addr in a response to
+// m.
+func (m *stunMessage) xorAddr(addr *net.UDPAddr) []byte {
+	ip, family := addr.IP.To4(), byte(1)
+	if ip == nil {
+		ip, family = addr.IP.To16(), 2
+	}
+	var key [16]byte
+	binary.BigEndian.PutUint32(key[:], stunMagicCookie)
+	copy(key[4:], m.txid[:])
+
+	v := make([]byte, 4+len(ip))
+	v[1] = family
+	binary.BigEndian.PutUint16(v[2:], uint16(addr.Port)^stunMagicCookie>>16)
+	for i := range ip {
+		v[4+i] = ip[i] ^ key[i]
+	}
+	return v
+}
+
+// errorCode returns the ERROR-CODE of the error response m.
+func (m *stunMessage) errorCode() error {
+	v, ok := m.attr(stunAttrErrorCode)
+	if !ok || len(v) < 4 {
+		return &STUNError{}
+	}
+	return &STUNError{
+		Code:   int(v[2]&0x7)*100 + int(v[3]),
+		Reason: string(v[4:]),
+	}
+}
@@ -0,0 +1,194 @@
+package reuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+// The transaction ID of the sample responses of RFC 5769.
+const stunSampleTxID = "b7e7a701bc34d686fa87dfae"
+
+func stunSampleMessage(t *testing.T) *stunMessage {
+	t.Helper()
+	m := &stunMessage{typ: stunBindingSuccess}
+	b, err := hex.DecodeString(stunSampleTxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(m.txid[:], b)
+	return m
+}
+
+func TestSTUNXorMappedAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		addr  *net.UDPAddr
+		value string
+	}{
+		// RFC 5769 section 2.2.
+		{name: "ipv4", addr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 32853}, value: "0001a147e112a643"},
+		// RFC 5769 section 2.3.
+		{name: "ipv6", addr: &net.UDPAddr{IP: net.ParseIP("2001:db8:1234:5678:11:2233:4455:6677"), Port: 32853}, value: "0002a1470113a9faa5d3f179bc25f4b5bed2b9d9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := stunSampleMessage(t)
+			v := m.xorAddr(tt.addr)
+			if got := hex.EncodeToString(v); got != tt.value {
+				t.Errorf("xorAddr() = %s, want %s", got, tt.value)
+			}
+			m.attrs = []stunAttr{{typ: stunAttrXorMappedAddress, value: v}}
+			addr, err := m.mappedAddr()
+			if err != nil {
+				t.Fatalf("mappedAddr() error = %v", err)
+			}
+			if !addr.IP.Equal(tt.addr.IP) || addr.Port != tt.addr.Port {
+				t.Errorf("mappedAddr() = %v, want %v", addr, tt.addr)
+			}
+		})
+	}
+}
+
+func TestSTUNMappedAddress(t *testing.T) {
+	m := stunSampleMessage(t)
+	m.attrs = []stunAttr{{typ: stunAttrMappedAddress, value: []byte{0, 1, 0x80, 0x55, 192, 0, 2, 1}}}
+	addr, err := m.mappedAddr()
+	if err != nil || addr.String() != "192.0.2.1:32853" {
+		t.Errorf("mappedAddr() = %v, %v, want 192.0.2.1:32853", addr, err)
+	}
+
+	for _, v := range [][]byte{{0, 1, 0}, {0, 1, 0, 1, 192, 0}, {0, 3, 0, 1, 192, 0, 2, 1}} {
+		m.attrs = []stunAttr{{typ: stunAttrXorMappedAddress, value: v}}
+		if _, err := m.mappedAddr(); err == nil {
+			t.Errorf("mappedAddr() of % x succeeded", v)
+		}
+	}
+	m.attrs = nil
+	if _, err := m.mappedAddr(); err == nil {
+		t.Error("mappedAddr() without address succeeded")
+	}
+}
+
+func TestSTUNMarshalPadding(t *testing.T) {
+	m := stunSampleMessage(t)
+	m.attrs = []stunAttr{
+		{typ: 0x8022, value: []byte("abcde")},
+		{typ: stunAttrErrorCode, value: []byte{0, 0, 4, 20, 'x'}},
+		{typ: 0x8028, value: []byte{1, 2, 3, 4}},
+	}
+	b := m.marshal()
+	if len(b) != stunHeaderSize+3*4+8+8+4 {
+		t.Fatalf("len(marshal()) = %d, want %d", len(b), stunHeaderSize+32)
+	}
+	if !bytes.Equal(b[stunHeaderSize+9:stunHeaderSize+12], []byte{0, 0, 0}) {
+		t.Errorf("padding = % x, want zeros", b[stunHeaderSize+9:stunHeaderSize+12])
+	}
+
+	p, ok := parseSTUN(b)
+	if !ok {
+		t.Fatal("parseSTUN() of a marshaled message failed")
+	}
+	if p.typ != m.typ || p.txid != m.txid || len(p.attrs) != len(m.attrs) {
+		t.Fatalf("parseSTUN() = %+v, want %+v", p, m)
+	}
+	for i, a := range p.attrs {
+		if a.typ != m.attrs[i].typ || !bytes.Equal(a.value, m.attrs[i].value) {
+			t.Errorf("attribute %d = %x % x, want %x % x", i, a.typ, a.value, m.attrs[i].typ, m.attrs[i].value)
+		}
+	}
+	if err, ok := p.errorCode().(*STUNError); !ok || err.Code != 420 || err.Reason != "x" {
+		t.Errorf("errorCode() = %v, want 420 x", p.errorCode())
+	}
+}
+
+func TestParseSTUNInvalid(t *testing.T) {
+	valid := (&stunMessage{typ: stunBindingRequest, attrs: []stunAttr{{typ: 0x8022, value: []byte("abcd")}}}).marshal()
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{name: "short", b: valid[:stunHeaderSize-1]},
+		{name: "first bits", b: corrupt(func(b []byte) []byte { b[0] |= 0x80; return b })},
+		{name: "magic cookie", b: corrupt(func(b []byte) []byte { b[4] ^= 1; return b })},
+		{name: "length", b: corrupt(func(b []byte) []byte { b[3] += 4; return b })},
+		{name: "attribute length", b: corrupt(func(b []byte) []byte { b[stunHeaderSize+3] = 9; return b })},
+		{name: "rtp", b: append([]byte{0x80, 0x60}, make([]byte, 30)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := parseSTUN(tt.b); ok {
+				t.Errorf("parseSTUN(% x) succeeded", tt.b)
+			}
+		})
+	}
+}
+
+// stunServer answers the binding requests it receives on pc, first with
+// a response to another transaction, then with the mapped address.
+func stunServer(pc net.PacketConn) {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, ok := parseSTUN(buf[:n])
+		if !ok || req.typ != stunBindingRequest {
+			continue
+		}
+		other := &stunMessage{typ: stunBindingSuccess, txid: req.txid}
+		other.txid[0]++
+		other.attrs = []stunAttr{{typ: stunAttrXorMappedAddress, value: other.xorAddr(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1})}}
+		pc.WriteTo(other.marshal(), addr)
+
+		resp := &stunMessage{typ: stunBindingSuccess, txid: req.txid}
+		resp.attrs = []stunAttr{{typ: stunAttrXorMappedAddress, value: resp.xorAddr(addr.(*net.UDPAddr))}}
+		pc.WriteTo(resp.marshal(), addr)
+	}
+}
+
+func TestSTUNConnBinding(t *testing.T) {
+	srv, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go stunServer(srv)
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A deadline left on the wrapped conn must not stop its reads.
+	pc.SetReadDeadline(time.Now().Add(-time.Second))
+	c := NewSTUNConn(pc)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr, err := c.Binding(ctx, srv.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Binding() error = %v", err)
+	}
+	if addr.String() != pc.LocalAddr().String() {
+		t.Errorf("Binding() = %v, want %v", addr, pc.LocalAddr())
+	}
+
+	// The response to another transaction is an application datagram.
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, maxDatagram)
+	n, from, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+	if m, ok := parseSTUN(b[:n]); !ok || m.typ != stunBindingSuccess || from.String() != srv.LocalAddr().String() {
+		t.Errorf("ReadFrom() = % x from %v, want the unmatched response from %v", b[:n], from, srv.LocalAddr())
+	}
+}
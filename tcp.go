@@ -0,0 +1,22 @@
+package reuse
+
+import (
+	"syscall"
+)
+
+// SetQuickAck enables or disables TCP_QUICKACK on the connection c, such
+// as a *net.TCPConn returned by Dial or accepted from a Listen listener.
+// The kernel may leave quick ACK mode on its own, so request/response
+// workloads typically set it again after each read. Linux only.
+func SetQuickAck(c syscall.Conn, enable bool) error {
+	return sockControl(c, func(fd uintptr) error {
+		return setQuickAck(fd, enable)
+	})
+}
+
+// AvailableCongestionControls returns the TCP congestion control
+// algorithms available on the running kernel for use with
+// WithCongestion. Linux only.
+func AvailableCongestionControls() ([]string, error) {
+	return availableCongestionControls()
+}
@@ -0,0 +1,111 @@
+package reuse
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Defaults of TCPPuncher.
+const (
+	defaultPunchAttempts       = 10
+	defaultPunchInterval       = 200 * time.Millisecond
+	defaultPunchAttemptTimeout = time.Second
+)
+
+// TCPPuncher establishes TCP connections through NATs by TCP simultaneous
+// open: both peers dial each other at the same time from the port they
+// advertised, typically the port of a listener created by Listen, so that
+// the outgoing SYN of each peer opens the NAT mapping the SYN of the
+// other one goes through. The peers agree on the addresses and the start
+// time through a signaling channel of their own.
+//
+// When a listener is bound to LocalAddr, the SYN of the peer may reach it
+// before the local SYN is sent, in which case the connection is returned
+// by Accept and the attempts fail as the connection already exists.
+//
+// The zero value for each field selects its default.
+type TCPPuncher struct {
+	// LocalAddr is the local address the attempts are dialed from.
+	LocalAddr string
+
+	// Start is the time of the first attempt, agreed upon by the peers.
+	// The zero value starts immediately.
+	Start time.Time
+
+	// Attempts is the number of connect attempts, 10 by default.
+	Attempts int
+
+	// Interval is the time between the start of consecutive attempts,
+	// 200ms by default.
+	Interval time.Duration
+
+	// AttemptTimeout is the timeout of each attempt, 1s by default.
+	AttemptTimeout time.Duration
+
+	// Options are the socket options applied to every dialed socket.
+	Options []Option
+}
+
+// Punch dials raddr from LocalAddr until a connection is established,
+// the attempts are exhausted or ctx is done. Attempts failing because
+// the SYN of the peer has not opened its NAT yet, by a reset or a
+// timeout, are retried at the next interval.
+func (p *TCPPuncher) Punch(ctx context.Context, network, raddr string) (net.Conn, error) {
+	nla, err := ResolveAddrContext(ctx, network, p.LocalAddr, p.Options...)
+	if err != nil {
+		return nil, fmt.Errorf("resolving local addr: %w", err)
+	}
+	cfg := newConfig(p.Options)
+
+	attempts, interval, timeout := p.Attempts, p.Interval, p.AttemptTimeout
+	if attempts <= 0 {
+		attempts = defaultPunchAttempts
+	}
+	if interval <= 0 {
+		interval = defaultPunchInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultPunchAttemptTimeout
+	}
+	start := p.Start
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if err := sleepUntil(ctx, start.Add(time.Duration(i)*interval)); err != nil {
+			return nil, err
+		}
+		actx, cancel := context.WithTimeout(ctx, timeout)
+		conn, err := cfg.dial(actx, cfg.dialer(nla), network, raddr)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("reuse: TCP hole punching to %s failed after %d attempts: %w", raddr, attempts, lastErr)
+}
+
+// sleepUntil waits until t or until ctx is done, returning the error of
+// ctx in the latter case.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,29 @@
+package reuse
+
+import (
+	"net"
+	"time"
+)
+
+// Flags of WithTxTime.
+const (
+	// TxTimeDeadlineMode makes the transmit time a deadline rather than
+	// the earliest time to send the datagram.
+	TxTimeDeadlineMode uint32 = 1 << iota
+	// TxTimeReportErrors reports the datagrams dropped for missing their
+	// transmit time on the socket error queue.
+	TxTimeReportErrors
+)
+
+// WriteToAt writes b to addr, to be transmitted by the kernel at time t
+// on a socket created with WithTxTime using clock clockid. It paces
+// datagrams in the kernel rather than with sleeps in user space.
+// Linux only.
+func WriteToAt(c *net.UDPConn, b []byte, addr *net.UDPAddr, t time.Time, clockid int) (int, error) {
+	oob, err := txTimeOOB(t, clockid)
+	if err != nil {
+		return 0, err
+	}
+	n, _, err := c.WriteMsgUDP(b, oob, addr)
+	return n, err
+}
@@ -0,0 +1,35 @@
+package reuse
+
+import (
+	"encoding/binary"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func setTxTime(fd int, t *txTime) error {
+	// struct sock_txtime
+	b := make([]byte, 8)
+	binary.NativeEndian.PutUint32(b[0:4], uint32(int32(t.clockid)))
+	binary.NativeEndian.PutUint32(b[4:8], t.flags)
+	return unix.SetsockoptString(fd, unix.SOL_SOCKET, unix.SO_TXTIME, string(b))
+}
+
+// txTimeOOB returns the SCM_TXTIME control message for t, converted from
+// the wall clock to clockid.
+func txTimeOOB(t time.Time, clockid int) ([]byte, error) {
+	var now unix.Timespec
+	if err := unix.ClockGettime(int32(clockid), &now); err != nil {
+		return nil, err
+	}
+	txtime := now.Nano() + int64(time.Until(t))
+
+	b := make([]byte, unix.CmsgSpace(8))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = unix.SOL_SOCKET
+	h.Type = unix.SCM_TXTIME
+	h.SetLen(unix.CmsgLen(8))
+	binary.NativeEndian.PutUint64(b[unix.CmsgLen(0):], uint64(txtime))
+	return b, nil
+}
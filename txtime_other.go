@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+import (
+	"time"
+)
+
+func txTimeOOB(t time.Time, clockid int) ([]byte, error) {
+	return nil, unsupportedOption("SO_TXTIME")
+}
@@ -0,0 +1,194 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Defaults of UDPPuncher.
+const (
+	defaultUDPPunchInterval = 100 * time.Millisecond
+	defaultUDPPunchTimeout  = 10 * time.Second
+)
+
+// Signaler exchanges the candidate addresses of two peers through a
+// signaling channel of the application, such as a rendezvous server.
+type Signaler interface {
+	// Exchange sends the local candidates to the peer and returns the
+	// candidates of the peer.
+	Exchange(ctx context.Context, local []*net.UDPAddr) ([]*net.UDPAddr, error)
+}
+
+// SignalerFunc adapts a function to the Signaler interface.
+type SignalerFunc func(ctx context.Context, local []*net.UDPAddr) ([]*net.UDPAddr, error)
+
+// Exchange calls f.
+func (f SignalerFunc) Exchange(ctx context.Context, local []*net.UDPAddr) ([]*net.UDPAddr, error) {
+	return f(ctx, local)
+}
+
+// UDPPuncher establishes UDP connectivity between two peers through NATs
+// over a single socket, typically created by ListenPacket and shared with
+// the application traffic: it learns the address the socket is mapped to
+// through STUN, exchanges its candidates with the peer through Signaler,
+// and sends STUN binding requests to every candidate of the peer at a
+// fixed interval until one is answered, confirming that datagrams flow
+// both ways:
+//
+//	pc, _ := reuse.ListenPacket("udp4", "0.0.0.0:4000")
+//	c := reuse.NewSTUNConn(pc)
+//	p := &reuse.UDPPuncher{STUNServer: "stun.example.com:3478", Signaler: sig}
+//	peer, _ := p.Punch(ctx, c)
+//	c.WriteTo(msg, peer)
+//
+// The zero value for Interval and Timeout selects their default.
+type UDPPuncher struct {
+	// STUNServer is the STUN server the reflexive candidate is learnt
+	// from. Without it only the host candidates are exchanged, which
+	// only reach peers on the same network.
+	STUNServer string
+
+	// Signaler exchanges the candidates with the peer.
+	Signaler Signaler
+
+	// Interval is the time between rounds of requests, 100ms by default.
+	Interval time.Duration
+
+	// Timeout bounds the whole punch, 10s by default.
+	Timeout time.Duration
+}
+
+// Punch punches a hole between c and the peer, returning the candidate
+// of the peer that answered. It enables the binding responder of c, see
+// STUNConn.SetBindingResponder, which is left enabled so that the peer
+// also completes its punch.
+func (p *UDPPuncher) Punch(ctx context.Context, c *STUNConn) (*net.UDPAddr, error) {
+	if p.Signaler == nil {
+		return nil, errors.New("reuse: UDP hole punching requires a Signaler")
+	}
+	timeout, interval := p.Timeout, p.Interval
+	if timeout <= 0 {
+		timeout = defaultUDPPunchTimeout
+	}
+	if interval <= 0 {
+		interval = defaultUDPPunchInterval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Answer the requests of the peer as soon as it knows the candidates.
+	c.SetBindingResponder(true)
+
+	local, err := p.candidates(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := p.Signaler.Exchange(ctx, local)
+	if err != nil {
+		return nil, err
+	}
+	remote = excludeAddrs(remote, local)
+	if len(remote) == 0 {
+		return nil, errors.New("reuse: no candidates to punch to")
+	}
+
+	ch := make(chan *stunMessage, len(remote))
+	sent := make(map[[12]byte]*net.UDPAddr)
+	defer func() {
+		for txid := range sent {
+			c.unregister(txid)
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, raddr := range remote {
+			req := newSTUNRequest()
+			if err := c.register(req.txid, ch); err != nil {
+				return nil, err
+			}
+			sent[req.txid] = raddr
+			// Candidates of the other address family or on unreachable
+			// networks fail to send, the others may succeed.
+			c.WriteTo(req.marshal(), raddr)
+		}
+
+		select {
+		case m := <-ch:
+			if m.typ == stunBindingSuccess {
+				return sent[m.txid], nil
+			}
+		case <-ticker.C:
+		case <-c.done:
+			return nil, c.closeErr()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("reuse: UDP hole punching failed: %w", ctx.Err())
+		}
+	}
+}
+
+// candidates returns the host candidates of c, followed by its reflexive
+// candidate if a STUN server is set.
+func (p *UDPPuncher) candidates(ctx context.Context, c *STUNConn) ([]*net.UDPAddr, error) {
+	laddr, ok := c.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("reuse: UDP hole punching requires a UDP socket, got %T", c.LocalAddr())
+	}
+	cands, err := hostCandidates(laddr)
+	if err != nil {
+		return nil, err
+	}
+	if p.STUNServer != "" {
+		mapped, err := c.Binding(ctx, p.STUNServer)
+		if err != nil {
+			return nil, err
+		}
+		cands = append(excludeAddrs(cands, []*net.UDPAddr{mapped}), mapped)
+	}
+	return cands, nil
+}
+
+// hostCandidates returns laddr, or if it is a wildcard address the
+// addresses of the host with the port of laddr. Loopback and link-local
+// addresses are left out of wildcard addresses.
+func hostCandidates(laddr *net.UDPAddr) ([]*net.UDPAddr, error) {
+	if !laddr.IP.IsUnspecified() {
+		return []*net.UDPAddr{laddr}, nil
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	v4only := laddr.IP.To4() != nil
+	var cands []*net.UDPAddr
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if v4only && ipnet.IP.To4() == nil {
+			continue
+		}
+		cands = append(cands, &net.UDPAddr{IP: ipnet.IP, Port: laddr.Port})
+	}
+	return cands, nil
+}
+
+// excludeAddrs returns the addresses of addrs that are not in exclude.
+func excludeAddrs(addrs, exclude []*net.UDPAddr) []*net.UDPAddr {
+	var res []*net.UDPAddr
+next:
+	for _, a := range addrs {
+		for _, e := range exclude {
+			if equalUDPAddr(a, e) {
+				continue next
+			}
+		}
+		res = append(res, a)
+	}
+	return res
+}
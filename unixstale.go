@@ -0,0 +1,39 @@
+package reuse
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// staleProbeTimeout bounds the connection probing whether a unix socket
+// file is stale.
+const staleProbeTimeout = time.Second
+
+// removeStaleSocket removes the socket file at path, the address of a
+// unix socket listener on network, if c requires it and no socket listens
+// on it.
+func (c *config) removeStaleSocket(network, path string) error {
+	if !c.removeStale || !unixSocket(network) || path == "" || strings.HasPrefix(path, "@") {
+		return nil
+	}
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		// Binding reports the missing directories and the other files.
+		return nil
+	}
+	conn, err := net.DialTimeout(network, path, staleProbeTimeout)
+	if err == nil {
+		conn.Close()
+		return nil
+	}
+	if !errors.Is(err, errConnRefused) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package reuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// upgradeEnv marks the processes started by Upgrade.
+	upgradeEnv = "REUSE_UPGRADE"
+	// upgradeReadyFd is the descriptor of the pipe the new process
+	// reports its readiness on, the first of the extra files.
+	upgradeReadyFd = 3
+	// defaultUpgradeTimeout bounds the start of the new process.
+	defaultUpgradeTimeout = time.Minute
+)
+
+var (
+	// ErrUpgradeInProgress is returned by Upgrade while another upgrade
+	// is running.
+	ErrUpgradeInProgress = errors.New("reuse: upgrade in progress")
+	// ErrUpgradeComplete is returned by Upgrade after a successful
+	// upgrade or Stop.
+	ErrUpgradeComplete = errors.New("reuse: process already upgraded or stopped")
+	// ErrUpgradeUnsupported is returned by Upgrade on platforms lacking
+	// descriptor inheritance.
+	ErrUpgradeUnsupported = errors.New("reuse: upgrade not supported on this platform")
+)
+
+// Upgrader restarts a service without downtime, by relying on port reuse
+// rather than on passing the listeners between processes: Upgrade starts
+// a new process running the same executable, which binds the same ports
+// through Listen and ListenPacket and calls Ready once it serves, after
+// which the old process stops accepting and drains through Exit.
+//
+//	u, _ := reuse.NewUpgrader()
+//	l, _ := u.Listen("tcp", ":8080")
+//	go srv.Serve(l)
+//	go func() {
+//		for range sighup {
+//			u.Upgrade()
+//		}
+//	}()
+//	u.Ready()
+//	<-u.Exit()
+//	srv.Shutdown(ctx)
+//
+// Connections waiting in the accept queue of a listener when it is
+// closed are reset, unless the net.ipv4.tcp_migrate_req sysctl of Linux
+// 5.14+ migrates them to the new process.
+type Upgrader struct {
+	// Timeout bounds the time the new process takes to call Ready, 1
+	// minute by default.
+	Timeout time.Duration
+
+	opts      []Option
+	ready     *os.File
+	mu        sync.Mutex
+	closers   []io.Closer
+	upgrading bool
+	exit      chan struct{}
+	exitOnce  sync.Once
+}
+
+// NewUpgrader returns an Upgrader creating its listeners with opts.
+func NewUpgrader(opts ...Option) (*Upgrader, error) {
+	u := &Upgrader{
+		opts: opts,
+		exit: make(chan struct{}),
+	}
+	if os.Getenv(upgradeEnv) != "" {
+		os.Unsetenv(upgradeEnv)
+		u.ready = os.NewFile(upgradeReadyFd, "upgrade-ready")
+		if u.ready == nil {
+			return nil, errors.New("reuse: upgrade readiness pipe missing")
+		}
+	}
+	return u, nil
+}
+
+// HasParent reports whether the process was started by Upgrade.
+func (u *Upgrader) HasParent() bool {
+	return u.ready != nil
+}
+
+// Listen listens at the given network and address, the listener being
+// closed when the process exits. see Listen
+func (u *Upgrader) Listen(network, address string) (net.Listener, error) {
+	l, err := ListenContext(context.Background(), network, address, u.opts...)
+	if err != nil {
+		return nil, err
+	}
+	u.track(l)
+	return l, nil
+}
+
+// ListenPacket listens at the given network and address, the conn being
+// closed when the process exits. see ListenPacket
+func (u *Upgrader) ListenPacket(network, address string) (net.PacketConn, error) {
+	pc, err := ListenPacketContext(context.Background(), network, address, u.opts...)
+	if err != nil {
+		return nil, err
+	}
+	u.track(pc)
+	return pc, nil
+}
+
+func (u *Upgrader) track(c io.Closer) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closers = append(u.closers, c)
+}
+
+// Ready reports to the parent process, if any, that the process binds
+// its ports and serves, letting the parent stop.
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.ready == nil {
+		return nil
+	}
+	_, err := u.ready.Write([]byte{1})
+	u.ready.Close()
+	u.ready = nil
+	return err
+}
+
+// Upgrade starts a new process running the executable of the current one
+// with its arguments and waits for it to call Ready. On success the
+// listeners of the current process are closed and Exit is closed, on
+// failure the new process is killed.
+func (u *Upgrader) Upgrade() error {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" || runtime.GOOS == "js" {
+		return ErrUpgradeUnsupported
+	}
+	u.mu.Lock()
+	select {
+	case <-u.exit:
+		u.mu.Unlock()
+		return ErrUpgradeComplete
+	default:
+	}
+	if u.upgrading {
+		u.mu.Unlock()
+		return ErrUpgradeInProgress
+	}
+	u.upgrading = true
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+
+	if err := u.startChild(); err != nil {
+		return err
+	}
+	u.Stop()
+	return nil
+}
+
+// startChild starts the new process, returning once it is ready.
+func (u *Upgrader) startChild() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), upgradeEnv+"=1")
+	cmd.ExtraFiles = []*os.File{w}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	timeout := u.Timeout
+	if timeout <= 0 {
+		timeout = defaultUpgradeTimeout
+	}
+	r.SetReadDeadline(time.Now().Add(timeout))
+
+	// The read fails with EOF if the process exits before being ready.
+	b := make([]byte, 1)
+	if _, err := r.Read(b); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("reuse: new process not ready: %w", err)
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// Exit returns a channel closed when the process should stop serving and
+// drain its connections, after a successful Upgrade or Stop.
+func (u *Upgrader) Exit() <-chan struct{} {
+	return u.exit
+}
+
+// Stop closes the listeners and Exit without starting a new process.
+func (u *Upgrader) Stop() {
+	u.exitOnce.Do(func() {
+		u.mu.Lock()
+		closers := u.closers
+		u.closers = nil
+		close(u.exit)
+		u.mu.Unlock()
+		for _, c := range closers {
+			c.Close()
+		}
+	})
+}
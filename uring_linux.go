@@ -0,0 +1,731 @@
+package reuse
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/cpu"
+	"golang.org/x/sys/unix"
+)
+
+// io_uring ABI, see io_uring_setup(2) and io_uring_enter(2).
+const (
+	uringEntries = 256
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringFeatSingleMmap = 1 << 0
+	uringEnterGetEvents = 1 << 0
+	uringSQEIOLink      = 1 << 2
+
+	uringOpPollAdd     = 6
+	uringOpSendmsg     = 9
+	uringOpRecvmsg     = 10
+	uringOpAccept      = 13
+	uringOpAsyncCancel = 14
+
+	// uringCancelRetries bounds the submissions of a cancellation while
+	// the submission queue is full, uringCancelBackoff apart.
+	uringCancelRetries = 1000
+	uringCancelBackoff = time.Millisecond
+)
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	_           uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+// uring is the io_uring shared by the sockets created with WithIOUring.
+// Operations are submitted as soon as they are queued and their
+// completions are delivered by a goroutine reaping the completion queue.
+type uring struct {
+	fd int
+
+	// mu serializes the submissions.
+	mu      sync.Mutex
+	sqHead  *uint32
+	sqTail  *uint32
+	sqMask  uint32
+	sqSize  uint32
+	sqArray []uint32
+	sqes    []uringSQE
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []uringCQE
+
+	pendingMu sync.Mutex
+	pending   map[uint64]*uringOp
+	nextID    atomic.Uint64
+
+	// closed is set once the ring can no longer be entered.
+	closed atomic.Bool
+}
+
+// uringOp is an operation in flight. It holds the memory the kernel
+// reads and writes until the operation completes.
+type uringOp struct {
+	res  chan int32
+	msg  unix.Msghdr
+	iov  unix.Iovec
+	addr unix.RawSockaddrAny
+}
+
+func newURingOp() *uringOp {
+	return &uringOp{res: make(chan int32, 1)}
+}
+
+var sharedURing struct {
+	once sync.Once
+	r    *uring
+	err  error
+}
+
+// getURing returns the shared io_uring, created on first use.
+func getURing() (*uring, error) {
+	sharedURing.once.Do(func() {
+		sharedURing.r, sharedURing.err = newURing(uringEntries)
+	})
+	return sharedURing.r, sharedURing.err
+}
+
+func newURing(entries uint32) (*uring, error) {
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", errno)
+	}
+	r := &uring{fd: int(fd), pending: make(map[uint64]*uringOp)}
+
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	single := p.features&uringFeatSingleMmap != 0
+	if single && cqSize > sqSize {
+		sqSize = cqSize
+	}
+	sq, err := unix.Mmap(r.fd, uringOffSQRing, sqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		unix.Close(r.fd)
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	cq := sq
+	if !single {
+		if cq, err = unix.Mmap(r.fd, uringOffCQRing, cqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+			unix.Munmap(sq)
+			unix.Close(r.fd)
+			return nil, os.NewSyscallError("mmap", err)
+		}
+	}
+	sqes, err := unix.Mmap(r.fd, uringOffSQEs, int(p.sqEntries)*int(unsafe.Sizeof(uringSQE{})), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		unix.Munmap(sq)
+		if !single {
+			unix.Munmap(cq)
+		}
+		unix.Close(r.fd)
+		return nil, os.NewSyscallError("mmap", err)
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&sq[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&sq[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&sq[p.sqOff.ringMask]))
+	r.sqSize = p.sqEntries
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&sq[p.sqOff.array])), p.sqEntries)
+	r.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&sqes[0])), p.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&cq[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&cq[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&cq[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&cq[p.cqOff.cqes])), p.cqEntries)
+
+	go r.reap()
+	return r, nil
+}
+
+func (r *uring) enter(toSubmit, minComplete, flags uint32) (int, error) {
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return 0, os.NewSyscallError("io_uring_enter", errno)
+		}
+		return int(n), nil
+	}
+}
+
+// submit queues the entries filled by fills, each linked to the next, and
+// submits them, returning the identifiers of the first and last ones,
+// which are consecutive. The result of the last entry is delivered to op,
+// which may be nil to ignore it.
+func (r *uring) submit(op *uringOp, fills ...func(sqe *uringSQE)) (first, last uint64, err error) {
+	n := uint32(len(fills))
+	last = r.nextID.Add(uint64(n))
+	first = last - uint64(n) + 1
+	if r.closed.Load() {
+		return 0, 0, os.NewSyscallError("io_uring_enter", unix.EBADF)
+	}
+	if op != nil {
+		r.pendingMu.Lock()
+		r.pending[last] = op
+		r.pendingMu.Unlock()
+	}
+
+	r.mu.Lock()
+	tail := *r.sqTail
+	head := atomic.LoadUint32(r.sqHead)
+	if tail-head+n > r.sqSize {
+		r.mu.Unlock()
+		r.forget(last)
+		return 0, 0, os.NewSyscallError("io_uring_enter", unix.EBUSY)
+	}
+	for i, fill := range fills {
+		idx := (tail + uint32(i)) & r.sqMask
+		sqe := &r.sqes[idx]
+		*sqe = uringSQE{}
+		fill(sqe)
+		sqe.userData = first + uint64(i)
+		if i < len(fills)-1 {
+			sqe.flags |= uringSQEIOLink
+		}
+		r.sqArray[idx] = idx
+	}
+	atomic.StoreUint32(r.sqTail, tail+n)
+	_, err = r.enter(tail+n-head, 0, 0)
+	if err != nil && atomic.LoadUint32(r.sqHead) == head {
+		// The kernel did not consume the entries, take them back.
+		atomic.StoreUint32(r.sqTail, tail)
+		r.mu.Unlock()
+		r.forget(last)
+		return 0, 0, err
+	}
+	r.mu.Unlock()
+	return first, last, nil
+}
+
+func (r *uring) forget(id uint64) {
+	r.pendingMu.Lock()
+	delete(r.pending, id)
+	r.pendingMu.Unlock()
+}
+
+// cancel requests the cancellation of the entry id, whose result is then
+// -ECANCELED unless it completed meanwhile, as are the results of the
+// entries linked to it. It retries for a while if the submission queue
+// is full and fails once the ring is closed.
+func (r *uring) cancel(id uint64) error {
+	fill := func(sqe *uringSQE) {
+		sqe.opcode = uringOpAsyncCancel
+		sqe.fd = -1
+		sqe.addr = id
+	}
+	for i := 0; ; i++ {
+		_, _, err := r.submit(nil, fill)
+		if err == nil || !errors.Is(err, unix.EBUSY) || i == uringCancelRetries {
+			return err
+		}
+		time.Sleep(uringCancelBackoff)
+	}
+}
+
+// reap delivers the completions to the operations, until the ring is
+// closed.
+func (r *uring) reap() {
+	for {
+		if _, err := r.enter(0, 1, uringEnterGetEvents); err != nil {
+			if errors.Is(err, unix.EBADF) || errors.Is(err, unix.ENXIO) {
+				r.closed.Store(true)
+				r.failPending()
+				return
+			}
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		head := *r.cqHead
+		tail := atomic.LoadUint32(r.cqTail)
+		for ; head != tail; head++ {
+			cqe := r.cqes[head&r.cqMask]
+			r.pendingMu.Lock()
+			op := r.pending[cqe.userData]
+			delete(r.pending, cqe.userData)
+			r.pendingMu.Unlock()
+			if op != nil {
+				op.res <- cqe.res
+			}
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+}
+
+// failPending completes the operations in flight with -ECANCELED, the
+// ring being closed.
+func (r *uring) failPending() {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	for id, op := range r.pending {
+		delete(r.pending, id)
+		op.res <- -int32(unix.ECANCELED)
+	}
+}
+
+// uringPollEvents returns events as the poll32_events of a poll entry,
+// whose halves the kernel swaps on big-endian machines so that the
+// 16-bit poll_events of the kernels before 5.9 read the same.
+func uringPollEvents(events uint32) uint32 {
+	if cpu.IsBigEndian {
+		return events << 16
+	}
+	return events
+}
+
+// uringSocket performs the operations of a socket through the shared
+// io_uring, cancelling them on deadlines and Close.
+type uringSocket struct {
+	ring *uring
+	fd   int
+	rc   syscall.RawConn
+
+	// mu guards the use of fd against its closing.
+	mu      sync.RWMutex
+	closed  bool
+	closing chan struct{}
+
+	readDeadline  *readDeadline
+	writeDeadline *readDeadline
+}
+
+func newURingSocket(ring *uring, sc syscall.Conn) (*uringSocket, error) {
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	s := &uringSocket{
+		ring:          ring,
+		rc:            rc,
+		closing:       make(chan struct{}),
+		readDeadline:  newReadDeadline(),
+		writeDeadline: newReadDeadline(),
+	}
+	if err := rc.Control(func(fd uintptr) {
+		s.fd = int(fd)
+	}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// do performs the operation filled by fill, returning its result. The
+// socket being non-blocking for the net package, the operation is linked
+// to a poll of the socket, so that it only runs once the socket is ready.
+// If another reader or writer got ahead of it, it waits for the socket
+// through the netpoller and retries.
+func (s *uringSocket) do(op *uringOp, write bool, fill func(sqe *uringSQE)) (int32, error) {
+	d := s.readDeadline
+	var events uint32 = unix.POLLIN
+	if write {
+		d = s.writeDeadline
+		events = unix.POLLOUT
+	}
+	for {
+		res, err := s.wait(op, d, events, fill)
+		if err != nil {
+			return 0, err
+		}
+		if res != -int32(unix.EAGAIN) {
+			return res, nil
+		}
+		ready := false
+		wait := func(fd uintptr) bool {
+			done := ready
+			ready = true
+			return done
+		}
+		if write {
+			err = s.rc.Write(wait)
+		} else {
+			err = s.rc.Read(wait)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// wait submits the operation filled by fill after a poll of the socket
+// for events and waits for its result, cancelling them when the deadline
+// d expires or the socket is closed.
+func (s *uringSocket) wait(op *uringOp, d *readDeadline, events uint32, fill func(sqe *uringSQE)) (int32, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return 0, net.ErrClosed
+	}
+	poll, id, err := s.ring.submit(op, func(sqe *uringSQE) {
+		sqe.opcode = uringOpPollAdd
+		sqe.fd = int32(s.fd)
+		sqe.opFlags = uringPollEvents(events)
+	}, func(sqe *uringSQE) {
+		fill(sqe)
+		sqe.fd = int32(s.fd)
+	})
+	s.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		timeout, changed, stop, expired := d.wait()
+		var cause error
+		if expired {
+			cause = os.ErrDeadlineExceeded
+		} else {
+			select {
+			case res := <-op.res:
+				stop()
+				return res, nil
+			case <-timeout:
+				cause = os.ErrDeadlineExceeded
+			case <-changed:
+				stop()
+				continue
+			case <-s.closing:
+				cause = net.ErrClosed
+			}
+		}
+		stop()
+		// The kernel uses the memory of op until the operation completes,
+		// so it is waited for even if it cannot be cancelled, the ring
+		// completing the operations in flight once it is closed.
+		err := s.cancel(poll, id)
+		for errors.Is(err, unix.EBUSY) {
+			t := time.NewTimer(uringCancelBackoff)
+			select {
+			case res := <-op.res:
+				t.Stop()
+				if res >= 0 {
+					return res, nil
+				}
+				return 0, err
+			case <-t.C:
+			}
+			err = s.cancel(poll, id)
+		}
+		// The operation may complete before being cancelled.
+		if res := <-op.res; res >= 0 {
+			return res, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return 0, cause
+	}
+}
+
+// cancel cancels the poll and the operation id linked to it. Cancelling
+// the poll cancels the operation, which is cancelled itself if it started
+// already.
+func (s *uringSocket) cancel(poll, id uint64) error {
+	if err := s.ring.cancel(poll); err != nil {
+		return err
+	}
+	return s.ring.cancel(id)
+}
+
+// close cancels the operations in flight and prevents new ones, before
+// the socket is closed.
+func (s *uringSocket) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+}
+
+// uringListener accepts connections through io_uring.
+type uringListener struct {
+	net.Listener
+	s *uringSocket
+}
+
+// uringListen returns l accepting through io_uring, or l itself if
+// io_uring is unavailable.
+func uringListen(l net.Listener) net.Listener {
+	ring, err := getURing()
+	if err != nil {
+		return l
+	}
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return l
+	}
+	s, err := newURingSocket(ring, sc)
+	if err != nil {
+		return l
+	}
+	return &uringListener{Listener: l, s: s}
+}
+
+func (l *uringListener) Accept() (net.Conn, error) {
+	op := newURingOp()
+	res, err := l.s.do(op, false, func(sqe *uringSQE) {
+		sqe.opcode = uringOpAccept
+		sqe.opFlags = unix.SOCK_CLOEXEC | unix.SOCK_NONBLOCK
+	})
+	if err == nil && res < 0 {
+		err = os.NewSyscallError("accept4", syscall.Errno(-res))
+	}
+	if err != nil {
+		return nil, &net.OpError{Op: "accept", Net: l.Addr().Network(), Addr: l.Addr(), Err: err}
+	}
+	f := os.NewFile(uintptr(res), "")
+	defer f.Close()
+	return net.FileConn(f)
+}
+
+func (l *uringListener) Close() error {
+	l.s.close()
+	return l.Listener.Close()
+}
+
+// SetDeadline sets the deadline of Accept.
+func (l *uringListener) SetDeadline(t time.Time) error {
+	l.s.readDeadline.set(t)
+	if dl, ok := l.Listener.(interface{ SetDeadline(time.Time) error }); ok {
+		return dl.SetDeadline(t)
+	}
+	return nil
+}
+
+func (l *uringListener) SyscallConn() (syscall.RawConn, error) {
+	return l.s.rc, nil
+}
+
+func (l *uringListener) File() (*os.File, error) {
+	return ExportFile(l.Listener)
+}
+
+// uringPacketConn reads and writes the datagrams of a UDP socket through
+// io_uring.
+type uringPacketConn struct {
+	net.PacketConn
+	s   *uringSocket
+	ip6 bool
+}
+
+// uringPacketConnOf returns pc reading and writing through io_uring, or
+// pc itself if io_uring is unavailable or pc is not a UDP socket.
+func uringPacketConnOf(pc net.PacketConn) net.PacketConn {
+	ring, err := getURing()
+	if err != nil {
+		return pc
+	}
+	u, ok := pc.(*net.UDPConn)
+	if !ok {
+		return pc
+	}
+	s, err := newURingSocket(ring, u)
+	if err != nil {
+		return pc
+	}
+	sa, err := unix.Getsockname(s.fd)
+	if err != nil {
+		return pc
+	}
+	_, ip6 := sa.(*unix.SockaddrInet6)
+	return &uringPacketConn{PacketConn: pc, s: s, ip6: ip6}
+}
+
+func (c *uringPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	op := newURingOp()
+	op.msg.Name = (*byte)(unsafe.Pointer(&op.addr))
+	if len(b) > 0 {
+		op.iov.Base = &b[0]
+		op.iov.SetLen(len(b))
+	}
+	op.msg.Iov = &op.iov
+	op.msg.SetIovlen(1)
+
+	res, err := c.s.do(op, false, func(sqe *uringSQE) {
+		op.msg.Namelen = unix.SizeofSockaddrAny
+		sqe.opcode = uringOpRecvmsg
+		sqe.addr = uint64(uintptr(unsafe.Pointer(&op.msg)))
+		sqe.len = 1
+	})
+	if err == nil && res < 0 {
+		err = os.NewSyscallError("recvmsg", syscall.Errno(-res))
+	}
+	if err != nil {
+		return 0, nil, &net.OpError{Op: "read", Net: c.LocalAddr().Network(), Addr: c.LocalAddr(), Err: err}
+	}
+	return int(res), rawToUDPAddr(&op.addr), nil
+}
+
+func (c *uringPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	opErr := func(err error) error {
+		return &net.OpError{Op: "write", Net: c.LocalAddr().Network(), Source: c.LocalAddr(), Addr: addr, Err: err}
+	}
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, opErr(syscall.EINVAL)
+	}
+	op := newURingOp()
+	namelen, err := udpAddrToRaw(ua, c.ip6, &op.addr)
+	if err != nil {
+		return 0, opErr(err)
+	}
+	op.msg.Name = (*byte)(unsafe.Pointer(&op.addr))
+	op.msg.Namelen = namelen
+	if len(b) > 0 {
+		op.iov.Base = &b[0]
+		op.iov.SetLen(len(b))
+	}
+	op.msg.Iov = &op.iov
+	op.msg.SetIovlen(1)
+
+	res, err := c.s.do(op, true, func(sqe *uringSQE) {
+		sqe.opcode = uringOpSendmsg
+		sqe.addr = uint64(uintptr(unsafe.Pointer(&op.msg)))
+		sqe.len = 1
+	})
+	if err == nil && res < 0 {
+		err = os.NewSyscallError("sendmsg", syscall.Errno(-res))
+	}
+	if err != nil {
+		return 0, opErr(err)
+	}
+	return int(res), nil
+}
+
+func (c *uringPacketConn) Close() error {
+	c.s.close()
+	return c.PacketConn.Close()
+}
+
+func (c *uringPacketConn) SetDeadline(t time.Time) error {
+	c.s.readDeadline.set(t)
+	c.s.writeDeadline.set(t)
+	return c.PacketConn.SetDeadline(t)
+}
+
+func (c *uringPacketConn) SetReadDeadline(t time.Time) error {
+	c.s.readDeadline.set(t)
+	return c.PacketConn.SetReadDeadline(t)
+}
+
+func (c *uringPacketConn) SetWriteDeadline(t time.Time) error {
+	c.s.writeDeadline.set(t)
+	return c.PacketConn.SetWriteDeadline(t)
+}
+
+func (c *uringPacketConn) SyscallConn() (syscall.RawConn, error) {
+	return c.s.rc, nil
+}
+
+func (c *uringPacketConn) File() (*os.File, error) {
+	return ExportFile(c.PacketConn)
+}
+
+// rawToUDPAddr converts the address of a datagram received by recvmsg.
+func rawToUDPAddr(rsa *unix.RawSockaddrAny) *net.UDPAddr {
+	switch rsa.Addr.Family {
+	case unix.AF_INET:
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		return &net.UDPAddr{
+			IP:   net.IPv4(sa.Addr[0], sa.Addr[1], sa.Addr[2], sa.Addr[3]),
+			Port: int(port[0])<<8 | int(port[1]),
+		}
+	case unix.AF_INET6:
+		sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		return &net.UDPAddr{
+			IP:   append(net.IP(nil), sa.Addr[:]...),
+			Port: int(port[0])<<8 | int(port[1]),
+			Zone: zoneName(sa.Scope_id),
+		}
+	}
+	return nil
+}
+
+// udpAddrToRaw converts addr to the address of a socket of the IPv6
+// family if ip6 is set, IPv4 otherwise, returning its length.
+func udpAddrToRaw(addr *net.UDPAddr, ip6 bool, rsa *unix.RawSockaddrAny) (uint32, error) {
+	if !ip6 {
+		ip4 := addr.IP.To4()
+		if ip4 == nil {
+			return 0, syscall.EAFNOSUPPORT
+		}
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		sa.Family = unix.AF_INET
+		port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+		port[0], port[1] = byte(addr.Port>>8), byte(addr.Port)
+		copy(sa.Addr[:], ip4)
+		return unix.SizeofSockaddrInet4, nil
+	}
+	ip := addr.IP.To16()
+	if ip == nil {
+		return 0, errors.New("reuse: invalid IP address")
+	}
+	sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(rsa))
+	sa.Family = unix.AF_INET6
+	port := (*[2]byte)(unsafe.Pointer(&sa.Port))
+	port[0], port[1] = byte(addr.Port>>8), byte(addr.Port)
+	copy(sa.Addr[:], ip)
+	zone, err := zoneIndex(addr.Zone)
+	if err != nil {
+		return 0, err
+	}
+	sa.Scope_id = zone
+	return unix.SizeofSockaddrInet6, nil
+}
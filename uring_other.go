@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+import (
+	"net"
+)
+
+func uringListen(l net.Listener) net.Listener {
+	return l
+}
+
+func uringPacketConnOf(pc net.PacketConn) net.PacketConn {
+	return pc
+}
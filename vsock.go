@@ -0,0 +1,72 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"strconv"
+)
+
+// Well known VSOCK context IDs, see vsock(7).
+const (
+	// VsockCIDAny binds to any context ID.
+	VsockCIDAny = 0xffffffff
+	// VsockCIDHypervisor is the context ID of the hypervisor.
+	VsockCIDHypervisor = 0
+	// VsockCIDLocal is the context ID of the local loopback.
+	VsockCIDLocal = 1
+	// VsockCIDHost is the context ID of the host, as seen from a guest.
+	VsockCIDHost = 2
+)
+
+// VsockPortAny binds to an ephemeral VSOCK port.
+const VsockPortAny = 0xffffffff
+
+// VsockAddr represents the address of a VSOCK end point, a context ID
+// identifying the host or a virtual machine, and a port.
+type VsockAddr struct {
+	ContextID uint32
+	Port      uint32
+}
+
+// Network returns the address's network name, "vsock".
+func (a *VsockAddr) Network() string { return "vsock" }
+
+func (a *VsockAddr) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	return strconv.FormatUint(uint64(a.ContextID), 10) + ":" + strconv.FormatUint(uint64(a.Port), 10)
+}
+
+// ListenVsock announces on laddr with a VSOCK stream socket, for the
+// communication between a host and its virtual machines, with the
+// options of opts and the hooks of this package applied. A nil laddr
+// listens on an ephemeral port of any context ID. VSOCK ports cannot be
+// shared, so SO_REUSEADDR and SO_REUSEPORT are not set. Linux only.
+func ListenVsock(laddr *VsockAddr, opts ...Option) (net.Listener, error) {
+	return vsockConfig(opts).listenVsock(laddr)
+}
+
+// DialVsock connects to raddr from laddr with a VSOCK stream socket. see
+// DialVsockContext
+func DialVsock(laddr, raddr *VsockAddr, opts ...Option) (net.Conn, error) {
+	return DialVsockContext(context.Background(), laddr, raddr, opts...)
+}
+
+// DialVsockContext connects to raddr from laddr with a VSOCK stream
+// socket using the provided context. A nil laddr dials from an ephemeral
+// port. Linux only.
+func DialVsockContext(ctx context.Context, laddr, raddr *VsockAddr, opts ...Option) (net.Conn, error) {
+	if raddr == nil {
+		return nil, &net.OpError{Op: "dial", Net: "vsock", Err: &net.AddrError{Err: "missing address"}}
+	}
+	return vsockConfig(opts).dialVsock(ctx, laddr, raddr)
+}
+
+// vsockConfig returns the configuration of opts for VSOCK sockets, on
+// which the reuse options fail.
+func vsockConfig(opts []Option) *config {
+	c := newConfig(opts)
+	c.reuseAddr, c.reusePort = false, false
+	return c
+}
@@ -0,0 +1,198 @@
+package reuse
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func (c *config) listenVsock(laddr *VsockAddr) (net.Listener, error) {
+	if laddr == nil {
+		laddr = &VsockAddr{ContextID: VsockCIDAny, Port: VsockPortAny}
+	}
+	f, err := c.vsockSocket(laddr, nil, HookBind)
+	if err != nil {
+		return nil, classify(&net.OpError{Op: "listen", Net: "vsock", Addr: laddr, Err: err})
+	}
+	l := &vsockListener{f: f}
+	if l.rc, err = f.SyscallConn(); err == nil {
+		l.addr, err = vsockSockname(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, &net.OpError{Op: "listen", Net: "vsock", Addr: laddr, Err: err}
+	}
+	return c.listener(l), nil
+}
+
+func (c *config) dialVsock(ctx context.Context, laddr, raddr *VsockAddr) (net.Conn, error) {
+	points := []HookPoint{HookConnect}
+	if laddr != nil {
+		points = []HookPoint{HookBind, HookConnect}
+	}
+	f, err := c.vsockSocket(laddr, raddr, points...)
+	if err == nil {
+		if err = connectFile(ctx, f, &unix.SockaddrVM{CID: raddr.ContextID, Port: raddr.Port}); err != nil {
+			f.Close()
+		}
+	}
+	var src net.Addr
+	if laddr != nil {
+		src = laddr
+	}
+	if err != nil {
+		return nil, classify(&net.OpError{Op: "dial", Net: "vsock", Source: src, Addr: raddr, Err: err})
+	}
+	conn := &vsockConn{File: f, raddr: raddr}
+	if conn.laddr, err = vsockSockname(f); err != nil {
+		f.Close()
+		return nil, &net.OpError{Op: "dial", Net: "vsock", Source: src, Addr: raddr, Err: err}
+	}
+	return conn, nil
+}
+
+// vsockSocket returns a nonblocking VSOCK stream socket with the options
+// of c applied, bound to laddr unless nil and listening unless raddr is
+// set. The socket is closed on error.
+func (c *config) vsockSocket(laddr, raddr *VsockAddr, points ...HookPoint) (*os.File, error) {
+	s, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	f := os.NewFile(uintptr(s), "vsock")
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	address := ""
+	if raddr != nil {
+		address = raddr.String()
+	} else if laddr != nil {
+		address = laddr.String()
+	}
+	err = c.controlHooks("vsock", address, rc, points...)
+	if err == nil && laddr != nil {
+		err = sockControl(f, func(fd uintptr) error {
+			sa := &unix.SockaddrVM{CID: laddr.ContextID, Port: laddr.Port}
+			return os.NewSyscallError("bind", unix.Bind(int(fd), sa))
+		})
+	}
+	if err == nil && raddr == nil {
+		err = sockControl(f, func(fd uintptr) error {
+			return os.NewSyscallError("listen", unix.Listen(int(fd), unix.SOMAXCONN))
+		})
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// vsockSockname returns the local address of the socket of f.
+func vsockSockname(f *os.File) (*VsockAddr, error) {
+	var addr *VsockAddr
+	err := sockControl(f, func(fd uintptr) error {
+		sa, err := unix.Getsockname(int(fd))
+		if err != nil {
+			return os.NewSyscallError("getsockname", err)
+		}
+		addr = vsockAddrFrom(sa)
+		return nil
+	})
+	return addr, err
+}
+
+func vsockAddrFrom(sa unix.Sockaddr) *VsockAddr {
+	if sa, ok := sa.(*unix.SockaddrVM); ok {
+		return &VsockAddr{ContextID: sa.CID, Port: sa.Port}
+	}
+	return nil
+}
+
+// vsockListener is the listener of a VSOCK stream socket, which the net
+// package does not handle.
+type vsockListener struct {
+	f      *os.File
+	rc     syscall.RawConn
+	addr   *VsockAddr
+	closed atomic.Bool
+}
+
+func (l *vsockListener) Accept() (net.Conn, error) {
+	var s int
+	var rsa unix.Sockaddr
+	var aerr error
+	err := l.rc.Read(func(fd uintptr) bool {
+		for {
+			s, rsa, aerr = unix.Accept4(int(fd), unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+			// The connection was reset while queued, accept the next
+			// one.
+			if aerr != unix.ECONNABORTED {
+				return aerr != unix.EAGAIN
+			}
+		}
+	})
+	if err == nil {
+		err = os.NewSyscallError("accept", aerr)
+	}
+	if err != nil && l.closed.Load() {
+		err = net.ErrClosed
+	}
+	if err != nil {
+		return nil, &net.OpError{Op: "accept", Net: "vsock", Addr: l.addr, Err: err}
+	}
+	conn := &vsockConn{File: os.NewFile(uintptr(s), "vsock"), raddr: vsockAddrFrom(rsa)}
+	if conn.laddr, err = vsockSockname(conn.File); err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "accept", Net: "vsock", Addr: l.addr, Err: err}
+	}
+	return conn, nil
+}
+
+func (l *vsockListener) Close() error {
+	l.closed.Store(true)
+	return l.f.Close()
+}
+
+func (l *vsockListener) Addr() net.Addr {
+	return l.addr
+}
+
+// SetDeadline sets the deadline of Accept.
+func (l *vsockListener) SetDeadline(t time.Time) error {
+	return l.f.SetDeadline(t)
+}
+
+func (l *vsockListener) SyscallConn() (syscall.RawConn, error) {
+	return l.rc, nil
+}
+
+// vsockConn is a connection of a VSOCK stream socket, read and written
+// through the poller of the runtime as an *os.File.
+type vsockConn struct {
+	*os.File
+	laddr, raddr *VsockAddr
+}
+
+func (c *vsockConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *vsockConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// CloseWrite shuts down the writing side of the connection.
+func (c *vsockConn) CloseWrite() error {
+	return sockControl(c.File, func(fd uintptr) error {
+		return os.NewSyscallError("shutdown", unix.Shutdown(int(fd), unix.SHUT_WR))
+	})
+}
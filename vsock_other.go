@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package reuse
+
+import (
+	"context"
+	"net"
+)
+
+func (c *config) listenVsock(laddr *VsockAddr) (net.Listener, error) {
+	return nil, &net.OpError{Op: "listen", Net: "vsock", Err: unsupportedOption("AF_VSOCK")}
+}
+
+func (c *config) dialVsock(ctx context.Context, laddr, raddr *VsockAddr) (net.Conn, error) {
+	return nil, &net.OpError{Op: "dial", Net: "vsock", Err: unsupportedOption("AF_VSOCK")}
+}